@@ -27,6 +27,9 @@ import (
 
 var cfgFile string
 
+// configLoaded is set once a config file was read, the simulate command then runs the scenario it describes
+var configLoaded bool
+
 // rootCmd represents the base command when called without any sub commands
 var rootCmd = &cobra.Command{
 	Use:   "maze",
@@ -87,5 +90,6 @@ func initConfig() {
 	// If a config file is found, read it in.
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		configLoaded = true
 	}
 }
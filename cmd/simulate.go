@@ -19,10 +19,13 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"maze/common"
 	"maze/common/simulation"
+	"os"
 	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // simulateCmd represents the simulate command
@@ -36,20 +39,104 @@ Cobra is a CLI library for Go that empowers applications.
 This application is a tool to generate the needed files
 to quickly create a Cobra application.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("simulate called")
+		log.Println("simulate called")
+		sc, err := scenario(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var obs common.Observer = &BasicObserver{}
+		var writer *simulation.TraceWriter
+		switch sc.Output.Traces {
+		case "":
+		case "-":
+			writer = simulation.CreateTraceWriter(os.Stdout, sc.Output.Format)
+		default:
+			f, err := os.Create(sc.Output.Traces)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			writer = simulation.CreateTraceWriter(f, sc.Output.Format)
+		}
+		if writer != nil {
+			obs = writer
+		}
 		start := time.Now()
-		s := simulation.CreateCentralizedSimulation()
+		s := sc.Simulation()
 		s.Init()
+		if Restore != "" {
+			if err := restore(s, Restore); err != nil {
+				log.Fatal(err)
+			}
+		}
 		elapsed := time.Since(start)
-		s.Iterations = Iterations
 
-		s.Run(&BasicObserver{})
+		if err := s.Run(obs); err != nil {
+			log.Fatal(err)
+		}
 		//s.Stop()
+		if writer != nil && writer.Err() != nil {
+			log.Fatal(writer.Err())
+		}
+		if Checkpoint != "" {
+			if err := checkpoint(s, Checkpoint); err != nil {
+				log.Fatal(err)
+			}
+		}
 
-		fmt.Printf("Simulation took %s for %v iterations \n", elapsed, Iterations)
+		log.Printf("Simulation took %s for %v iterations", elapsed, sc.Duration)
 	},
 }
 
+// scenario reads the scenario of the config file, or the default one. The flags given on the command line take precedence,
+// and all flags apply without a config file
+func scenario(cmd *cobra.Command) (*simulation.Scenario, error) {
+	v := viper.New()
+	if configLoaded {
+		v = viper.GetViper()
+	}
+	sc, err := simulation.DecodeScenario(v)
+	if err != nil {
+		return nil, err
+	}
+	if !configLoaded || cmd.Flags().Changed("i") {
+		sc.Duration = Iterations
+	}
+	if !configLoaded || cmd.Flags().Changed("n") {
+		sc.SetRobots(NumRobots)
+	}
+	if !configLoaded || cmd.Flags().Changed("seed") {
+		sc.Seed = Seed
+	}
+	return sc, nil
+}
+
+// restore puts the simulation back in the state saved to the checkpoint file
+func restore(s common.Simulation, path string) error {
+	c, ok := s.(simulation.Checkpointer)
+	if !ok {
+		return fmt.Errorf("simulation %T can't be restored", s)
+	}
+	cp, err := simulation.LoadCheckpoint(path)
+	if err != nil {
+		return err
+	}
+	return c.Restore(cp)
+}
+
+// checkpoint saves the state of the simulation to the checkpoint file
+func checkpoint(s common.Simulation, path string) error {
+	c, ok := s.(simulation.Checkpointer)
+	if !ok {
+		return fmt.Errorf("simulation %T can't be saved", s)
+	}
+	cp, err := c.Checkpoint()
+	if err != nil {
+		return err
+	}
+	return simulation.SaveCheckpoint(cp, path)
+}
+
 type BasicObserver struct {
 }
 
@@ -67,8 +154,20 @@ var Iterations int
 // NumRobots is the flag for how many robots to assign on the network
 var NumRobots int
 
+// Seed is the flag for the seed of the simulation, runs with the same seed are identical
+var Seed int64
+
+// Restore is the flag for a checkpoint file to run on from, taken of a simulation of the same scenario
+var Restore string
+
+// Checkpoint is the flag for the file the state of the simulation is saved to once the run ends
+var Checkpoint string
+
 func init() {
 	rootCmd.AddCommand(simulateCmd)
 	simulateCmd.Flags().IntVar(&Iterations, "i", 100, "Setting for number of iterations in the simulation")
 	simulateCmd.Flags().IntVar(&NumRobots, "n", 3, "Setting for number of robots to spawn on the ground")
+	simulateCmd.Flags().Int64Var(&Seed, "seed", 1, "Setting for the seed of the simulation")
+	simulateCmd.Flags().StringVar(&Restore, "restore", "", "Setting for the checkpoint file to run on from")
+	simulateCmd.Flags().StringVar(&Checkpoint, "checkpoint", "", "Setting for the file to save the state of the simulation to once the run ends")
 }
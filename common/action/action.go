@@ -19,7 +19,6 @@ package action
 import (
 	"gonum.org/v1/gonum/graph"
 	"maze/common"
-	"reflect"
 )
 
 type MoveAction struct {
@@ -46,12 +45,20 @@ func (a *MoveAction) GetContent() interface{} {
 	return a
 }
 func (a *MoveAction) Equal(other common.Action) bool {
-	if a.GetType() == a.GetType() {
-		cast := other.(*MoveAction)
-		return cast.Start == a.Start && cast.End == a.End && reflect.DeepEqual(cast.Path, a.Path) && cast.child.Equal(a.child)
-	} else {
+	return equalChain(a, other)
+}
+
+func (a *MoveAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*MoveAction)
+	if !ok || cast == nil || !sameNode(cast.Start, a.Start) || !sameNode(cast.End, a.End) || len(cast.Path) != len(a.Path) {
 		return false
 	}
+	for i := range a.Path {
+		if !sameNode(cast.Path[i], a.Path[i]) {
+			return false
+		}
+	}
+	return true
 }
 
 func CreateMoveAction(start common.Location, end common.Location) *MoveAction {
@@ -70,10 +77,11 @@ func (a *MoveAction) SetStatus(s common.ActionStatus) {
 type BeginTaskAction struct {
 	child common.Action
 	here  common.Location
+	Timer
 }
 
 func CreateBeginTaskAction(here common.Location) *BeginTaskAction {
-	return &BeginTaskAction{nil, here}
+	return &BeginTaskAction{child: nil, here: here}
 }
 func (a *BeginTaskAction) GetChild() common.Action {
 	return a.child
@@ -91,17 +99,21 @@ func (a *BeginTaskAction) SetChild(c common.Action) {
 	a.child = c
 }
 func (a *BeginTaskAction) Equal(other common.Action) bool {
-	if a.GetType() == a.GetType() {
-		cast := other.(*BeginTaskAction)
-		return cast.here == a.here && cast.child.Equal(a.child)
-	} else {
+	return equalChain(a, other)
+}
+
+func (a *BeginTaskAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*BeginTaskAction)
+	if !ok || cast == nil {
 		return false
 	}
+	return sameNode(cast.here, a.here)
 }
 
 type EndTaskAction struct {
 	child common.Action
 	here  common.Location
+	Timer
 }
 
 func (a *EndTaskAction) GetChild() common.Action {
@@ -120,15 +132,18 @@ func (a *EndTaskAction) SetChild(c common.Action) {
 	a.child = c
 }
 func CreateEndTaskAction(here common.Location) *EndTaskAction {
-	return &EndTaskAction{nil, here}
+	return &EndTaskAction{child: nil, here: here}
 }
 func (a *EndTaskAction) Equal(other common.Action) bool {
-	if a.GetType() == a.GetType() {
-		cast := other.(*EndTaskAction)
-		return cast.here == a.here && cast.child.Equal(a.child)
-	} else {
+	return equalChain(a, other)
+}
+
+func (a *EndTaskAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*EndTaskAction)
+	if !ok || cast == nil {
 		return false
 	}
+	return sameNode(cast.here, a.here)
 }
 
 type NullAction struct {
@@ -157,6 +172,321 @@ func Null() NullAction {
 	return NullAction{}
 }
 func (n NullAction) Equal(other common.Action) bool {
-	return n.GetType() == n.GetType()
+	_, ok := other.(NullAction)
+	return ok
+}
+
+// PickAction loads Payload onto the robot at its current location. Item names what is picked, empty for any payload
+type PickAction struct {
+	child   common.Action
+	here    common.Location
+	Payload int
+	Item    string
+	Timer
+}
+
+func CreatePickAction(here common.Location, payload int) *PickAction {
+	return &PickAction{child: nil, here: here, Payload: payload}
+}
+
+// CreatePickItemAction picks a specific item
+func CreatePickItemAction(here common.Location, item string, payload int) *PickAction {
+	return &PickAction{child: nil, here: here, Payload: payload, Item: item}
+}
+func (a *PickAction) GetChild() common.Action {
+	return a.child
+}
+func (a *PickAction) GetType() common.ActionType {
+	return common.ActionTypePick
+}
+func (a *PickAction) HasChild() bool {
+	return a.child != nil
+}
+func (a *PickAction) GetContent() interface{} {
+	return a
+}
+func (a *PickAction) SetChild(c common.Action) {
+	a.child = c
+}
+func (a *PickAction) Equal(other common.Action) bool {
+	return equalChain(a, other)
+}
 
+func (a *PickAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*PickAction)
+	if !ok || cast == nil {
+		return false
+	}
+	return sameNode(cast.here, a.here) && cast.Payload == a.Payload && cast.Item == a.Item
 }
+
+// DropAction unloads Payload from the robot at its current location
+type DropAction struct {
+	child   common.Action
+	here    common.Location
+	Payload int
+	Timer
+}
+
+func CreateDropAction(here common.Location, payload int) *DropAction {
+	return &DropAction{child: nil, here: here, Payload: payload}
+}
+func (a *DropAction) GetChild() common.Action {
+	return a.child
+}
+func (a *DropAction) GetType() common.ActionType {
+	return common.ActionTypeDrop
+}
+func (a *DropAction) HasChild() bool {
+	return a.child != nil
+}
+func (a *DropAction) GetContent() interface{} {
+	return a
+}
+func (a *DropAction) SetChild(c common.Action) {
+	a.child = c
+}
+func (a *DropAction) Equal(other common.Action) bool {
+	return equalChain(a, other)
+}
+
+func (a *DropAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*DropAction)
+	if !ok || cast == nil {
+		return false
+	}
+	return sameNode(cast.here, a.here) && cast.Payload == a.Payload
+}
+
+// ChargeAction keeps the robot at a charging station until its battery is full
+type ChargeAction struct {
+	child  common.Action
+	here   common.Location
+	status common.ActionStatus
+}
+
+func CreateChargeAction(here common.Location) *ChargeAction {
+	return &ChargeAction{nil, here, common.PendingStatus}
+}
+func (a *ChargeAction) GetChild() common.Action {
+	return a.child
+}
+func (a *ChargeAction) GetType() common.ActionType {
+	return common.ActionTypeCharge
+}
+func (a *ChargeAction) HasChild() bool {
+	return a.child != nil
+}
+func (a *ChargeAction) GetContent() interface{} {
+	return a
+}
+func (a *ChargeAction) SetChild(c common.Action) {
+	a.child = c
+}
+func (a *ChargeAction) Equal(other common.Action) bool {
+	return equalChain(a, other)
+}
+
+func (a *ChargeAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*ChargeAction)
+	if !ok || cast == nil {
+		return false
+	}
+	return sameNode(cast.here, a.here)
+}
+func (a *ChargeAction) GetStatus() common.ActionStatus {
+	return a.status
+}
+func (a *ChargeAction) SetStatus(s common.ActionStatus) {
+	a.status = s
+}
+
+// RotateAction turns the robot in place from one heading to the other
+type RotateAction struct {
+	child common.Action
+	here  common.Location
+	From  common.Heading
+	To    common.Heading
+	Timer
+}
+
+func CreateRotateAction(here common.Location, from, to common.Heading) *RotateAction {
+	return &RotateAction{child: nil, here: here, From: from, To: to}
+}
+func (a *RotateAction) GetChild() common.Action {
+	return a.child
+}
+func (a *RotateAction) GetType() common.ActionType {
+	return common.ActionTypeRotate
+}
+func (a *RotateAction) HasChild() bool {
+	return a.child != nil
+}
+func (a *RotateAction) GetContent() interface{} {
+	return a
+}
+func (a *RotateAction) SetChild(c common.Action) {
+	a.child = c
+}
+func (a *RotateAction) Equal(other common.Action) bool {
+	return equalChain(a, other)
+}
+
+func (a *RotateAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*RotateAction)
+	if !ok || cast == nil {
+		return false
+	}
+	return sameNode(cast.here, a.here) && cast.From == a.From && cast.To == a.To
+}
+
+// WaitAction keeps the robot in place, for a number of ticks or until a given tick. It holds nothing in the world,
+// a robot waiting for a station slot queues on its dock or charge action instead
+type WaitAction struct {
+	child common.Action
+	here  common.Location
+	Ticks int
+	Until int
+	Timer
+}
+
+// CreateWaitAction waits for a number of ticks
+func CreateWaitAction(here common.Location, ticks int) *WaitAction {
+	return &WaitAction{child: nil, here: here, Ticks: ticks}
+}
+
+// CreateWaitUntilAction waits until the given tick, the child runs on that tick
+func CreateWaitUntilAction(here common.Location, tick int) *WaitAction {
+	return &WaitAction{child: nil, here: here, Until: tick}
+}
+func (a *WaitAction) GetChild() common.Action {
+	return a.child
+}
+func (a *WaitAction) GetType() common.ActionType {
+	return common.ActionTypeWait
+}
+func (a *WaitAction) HasChild() bool {
+	return a.child != nil
+}
+func (a *WaitAction) GetContent() interface{} {
+	return a
+}
+func (a *WaitAction) SetChild(c common.Action) {
+	a.child = c
+}
+func (a *WaitAction) Equal(other common.Action) bool {
+	return equalChain(a, other)
+}
+
+func (a *WaitAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*WaitAction)
+	if !ok || cast == nil {
+		return false
+	}
+	return sameNode(cast.here, a.here) && cast.Ticks == a.Ticks && cast.Until == a.Until
+}
+
+// Duration returns the ticks left to wait when the wait begins on the given tick
+func (a *WaitAction) Duration(now int) int {
+	if a.Until > 0 {
+		return a.Until - now
+	}
+	return a.Ticks
+}
+
+// DockAction docks the robot at the station on its current location, queuing until the charging network gives it a slot.
+// The robot stays docked until it moves again. The built-in planners never dock, custom planners put docks in their plans
+type DockAction struct {
+	child common.Action
+	here  common.Location
+	Timer
+}
+
+func CreateDockAction(here common.Location) *DockAction {
+	return &DockAction{child: nil, here: here}
+}
+func (a *DockAction) GetChild() common.Action {
+	return a.child
+}
+func (a *DockAction) GetType() common.ActionType {
+	return common.ActionTypeDock
+}
+func (a *DockAction) HasChild() bool {
+	return a.child != nil
+}
+func (a *DockAction) GetContent() interface{} {
+	return a
+}
+func (a *DockAction) SetChild(c common.Action) {
+	a.child = c
+}
+func (a *DockAction) Equal(other common.Action) bool {
+	return equalChain(a, other)
+}
+
+func (a *DockAction) sameStep(other common.Action) bool {
+	cast, ok := other.(*DockAction)
+	if !ok || cast == nil {
+		return false
+	}
+	return sameNode(cast.here, a.here)
+}
+
+// sameNode compares locations by ID, two missing locations are the same
+func sameNode(a, b graph.Node) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.ID() == b.ID()
+}
+
+// step is an action whose own fields compare apart from the rest of its chain
+type step interface {
+	common.Action
+	sameStep(other common.Action) bool
+}
+
+// equalChain walks two chains side by side and compares them step by step, two missing chains are equal.
+// A chain looping back on itself is never equal to another, walking it would not end
+func equalChain(a, b common.Action) bool {
+	seen := make(map[common.Action]bool)
+	for {
+		if a == nil || b == nil {
+			return a == nil && b == nil
+		}
+		s, ok := a.(step)
+		if !ok {
+			// null actions end the chain, and actions from other packages compare the rest of it themselves
+			return a.Equal(b)
+		}
+		if seen[a] || !s.sameStep(b) {
+			return false
+		}
+		seen[a] = true
+		a, b = a.GetChild(), b.GetChild()
+	}
+}
+
+// Here returns where the task begins
+func (a *BeginTaskAction) Here() common.Location { return a.here }
+
+// Here returns where the task ends
+func (a *EndTaskAction) Here() common.Location { return a.here }
+
+// Here returns where the payload is picked
+func (a *PickAction) Here() common.Location { return a.here }
+
+// Here returns where the payload is dropped
+func (a *DropAction) Here() common.Location { return a.here }
+
+// Here returns the node of the charging station
+func (a *ChargeAction) Here() common.Location { return a.here }
+
+// Here returns where the robot turns
+func (a *RotateAction) Here() common.Location { return a.here }
+
+// Here returns where the robot waits
+func (a *WaitAction) Here() common.Location { return a.here }
+
+// Here returns the node of the station
+func (a *DockAction) Here() common.Location { return a.here }
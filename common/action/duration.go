@@ -0,0 +1,131 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package action
+
+import (
+	"math"
+	"math/rand"
+	"maze/common"
+)
+
+// Duration is the number of ticks an action takes, fixed or sampled from a distribution
+type Duration interface {
+	Sample(r *rand.Rand) int
+}
+
+// Fixed is a duration of a set number of ticks
+type Fixed int
+
+func (d Fixed) Sample(r *rand.Rand) int {
+	return int(d)
+}
+
+func (d Fixed) Mean() float64 {
+	return float64(d)
+}
+
+// Uniform samples durations evenly between Min and Max ticks, both included
+type Uniform struct {
+	Min int
+	Max int
+}
+
+func (d Uniform) Sample(r *rand.Rand) int {
+	if d.Max <= d.Min {
+		return d.Min
+	}
+	return d.Min + r.Intn(d.Max-d.Min+1)
+}
+
+func (d Uniform) Mean() float64 {
+	if d.Max <= d.Min {
+		return float64(d.Min)
+	}
+	return float64(d.Min+d.Max) / 2
+}
+
+// Normal samples durations around Mean ticks, rounded to whole ticks
+type Normal struct {
+	Mean   float64
+	StdDev float64
+}
+
+func (d Normal) Sample(r *rand.Rand) int {
+	return int(math.Round(d.Mean + r.NormFloat64()*d.StdDev))
+}
+
+// Expected returns the mean number of ticks an action of the duration takes, at least one.
+// Durations without a mean are expected to take a tick
+func Expected(d Duration) float64 {
+	switch v := d.(type) {
+	case Normal:
+		return math.Max(1, v.Mean)
+	case interface{ Mean() float64 }:
+		return math.Max(1, v.Mean())
+	default:
+		return 1
+	}
+}
+
+// Ticks samples the duration, an action takes at least one tick. A nil duration is a single tick
+func Ticks(d Duration, r *rand.Rand) int {
+	if d == nil {
+		return 1
+	}
+	if n := d.Sample(r); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// Timer tracks the status of an action lasting several ticks, embedded in the timed actions
+type Timer struct {
+	status    common.ActionStatus
+	remaining int
+}
+
+func (t *Timer) GetStatus() common.ActionStatus {
+	return t.status
+}
+func (t *Timer) SetStatus(s common.ActionStatus) {
+	t.status = s
+}
+
+// Remaining returns the ticks left before the action ends
+func (t *Timer) Remaining() int {
+	return t.remaining
+}
+
+// SetRemaining sets the ticks left before the action ends, to resume an action in progress
+func (t *Timer) SetRemaining(n int) {
+	t.remaining = n
+}
+
+// Advance spends a tick on the action. A pending action becomes active for the number of ticks given by start.
+// It returns true once the action ends
+func (t *Timer) Advance(start func() int) bool {
+	if t.status == common.PendingStatus {
+		t.remaining = start()
+		t.status = common.ActiveStatus
+	}
+	t.remaining--
+	if t.remaining <= 0 {
+		t.remaining = 0
+		t.status = common.EndStatus
+		return true
+	}
+	return false
+}
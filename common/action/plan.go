@@ -0,0 +1,376 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maze/common"
+	"strings"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// located is an action taking place on a single node
+type located interface {
+	common.Action
+	Here() common.Location
+}
+
+var actionNames = map[common.ActionType]string{
+	common.ActionTypeMove:      "move",
+	common.ActionTypeStartTask: "begin",
+	common.ActionTypeEndTask:   "end",
+	common.ActionTypeNull:      "null",
+	common.ActionTypePick:      "pick",
+	common.ActionTypeDrop:      "drop",
+	common.ActionTypeCharge:    "charge",
+	common.ActionTypeRotate:    "rotate",
+	common.ActionTypeWait:      "wait",
+	common.ActionTypeDock:      "dock",
+}
+
+// Name returns the name of an action type, as used in serialized plans
+func Name(t common.ActionType) string {
+	if n, ok := actionNames[t]; ok {
+		return n
+	}
+	return fmt.Sprintf("action(%d)", t)
+}
+
+func actionType(name string) (common.ActionType, bool) {
+	for t, n := range actionNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// Flatten returns the actions of a chain in order, down to the null action ending it.
+// It fails on chains missing their null action or looping back on themselves
+func Flatten(a common.Action) ([]common.Action, error) {
+	var actions []common.Action
+	seen := make(map[common.Action]bool)
+	for a != nil {
+		if a.GetType() == common.ActionTypeNull {
+			return append(actions, a), nil
+		}
+		if seen[a] {
+			return nil, fmt.Errorf("step %d: %s loops back into the plan", len(actions), Name(a.GetType()))
+		}
+		seen[a] = true
+		actions = append(actions, a)
+		if !a.HasChild() {
+			return nil, fmt.Errorf("step %d: %s has no child, the plan must end with a null action", len(actions)-1, Name(a.GetType()))
+		}
+		a = a.GetChild()
+	}
+	return nil, errors.New("empty plan")
+}
+
+// ActionRecord is the serializable form of an action, locations are kept as node IDs
+type ActionRecord struct {
+	Type      string              `json:"type"`
+	At        *int64              `json:"at,omitempty"`
+	Start     *int64              `json:"start,omitempty"`
+	End       *int64              `json:"end,omitempty"`
+	Path      []int64             `json:"path,omitempty"`
+	Payload   int                 `json:"payload,omitempty"`
+	Item      string              `json:"item,omitempty"`
+	Ticks     int                 `json:"ticks,omitempty"`
+	Until     int                 `json:"until,omitempty"`
+	From      common.Heading      `json:"from,omitempty"`
+	To        common.Heading      `json:"to,omitempty"`
+	Status    common.ActionStatus `json:"status,omitempty"`
+	Remaining int                 `json:"remaining,omitempty"`
+}
+
+// PlanRecord is the serializable form of an action chain, in execution order
+type PlanRecord struct {
+	Actions []ActionRecord `json:"actions"`
+}
+
+func nodeID(n graph.Node) *int64 {
+	if n == nil {
+		return nil
+	}
+	id := n.ID()
+	return &id
+}
+
+func node(id *int64) graph.Node {
+	if id == nil {
+		return nil
+	}
+	return simple.Node(*id)
+}
+
+// EncodePlan converts an action chain into its serializable form
+func EncodePlan(a common.Action) (PlanRecord, error) {
+	actions, err := Flatten(a)
+	if err != nil {
+		return PlanRecord{}, err
+	}
+	var p PlanRecord
+	for _, a := range actions {
+		r := ActionRecord{Type: Name(a.GetType())}
+		switch v := a.(type) {
+		case *MoveAction:
+			r.Start, r.End, r.Status = nodeID(v.Start), nodeID(v.End), v.status
+			for _, n := range v.Path {
+				r.Path = append(r.Path, n.ID())
+			}
+		case *BeginTaskAction:
+			r.At, r.Status, r.Remaining = nodeID(v.here), v.status, v.remaining
+		case *EndTaskAction:
+			r.At, r.Status, r.Remaining = nodeID(v.here), v.status, v.remaining
+		case *PickAction:
+			r.At, r.Payload, r.Item, r.Status, r.Remaining = nodeID(v.here), v.Payload, v.Item, v.status, v.remaining
+		case *DropAction:
+			r.At, r.Payload, r.Status, r.Remaining = nodeID(v.here), v.Payload, v.status, v.remaining
+		case *ChargeAction:
+			r.At, r.Status = nodeID(v.here), v.status
+		case *RotateAction:
+			r.At, r.From, r.To, r.Status, r.Remaining = nodeID(v.here), v.From, v.To, v.status, v.remaining
+		case *WaitAction:
+			r.At, r.Ticks, r.Until, r.Status, r.Remaining = nodeID(v.here), v.Ticks, v.Until, v.status, v.remaining
+		case *DockAction:
+			r.At, r.Status, r.Remaining = nodeID(v.here), v.status, v.remaining
+		case NullAction:
+		default:
+			return PlanRecord{}, fmt.Errorf("action type %T can't be encoded", a)
+		}
+		p.Actions = append(p.Actions, r)
+	}
+	return p, nil
+}
+
+// DecodePlan rebuilds an action chain from its serializable form. Locations are restored as simple.Node
+func DecodePlan(p PlanRecord) (common.Action, error) {
+	var first, last common.Action
+	for i, r := range p.Actions {
+		t, ok := actionType(r.Type)
+		if !ok {
+			return nil, fmt.Errorf("step %d: unknown action %q", i, r.Type)
+		}
+		var a common.Action
+		switch t {
+		case common.ActionTypeMove:
+			m := CreateMoveAction(node(r.Start), node(r.End))
+			for _, id := range r.Path {
+				m.Path = append(m.Path, simple.Node(id))
+			}
+			m.status = r.Status
+			a = m
+		case common.ActionTypeStartTask:
+			b := CreateBeginTaskAction(node(r.At))
+			b.status, b.remaining = r.Status, r.Remaining
+			a = b
+		case common.ActionTypeEndTask:
+			e := CreateEndTaskAction(node(r.At))
+			e.status, e.remaining = r.Status, r.Remaining
+			a = e
+		case common.ActionTypePick:
+			pick := CreatePickItemAction(node(r.At), r.Item, r.Payload)
+			pick.status, pick.remaining = r.Status, r.Remaining
+			a = pick
+		case common.ActionTypeDrop:
+			drop := CreateDropAction(node(r.At), r.Payload)
+			drop.status, drop.remaining = r.Status, r.Remaining
+			a = drop
+		case common.ActionTypeCharge:
+			c := CreateChargeAction(node(r.At))
+			c.status = r.Status
+			a = c
+		case common.ActionTypeRotate:
+			rot := CreateRotateAction(node(r.At), r.From, r.To)
+			rot.status, rot.remaining = r.Status, r.Remaining
+			a = rot
+		case common.ActionTypeWait:
+			wait := &WaitAction{here: node(r.At), Ticks: r.Ticks, Until: r.Until}
+			wait.status, wait.remaining = r.Status, r.Remaining
+			a = wait
+		case common.ActionTypeDock:
+			dock := CreateDockAction(node(r.At))
+			dock.status, dock.remaining = r.Status, r.Remaining
+			a = dock
+		case common.ActionTypeNull:
+			if i != len(p.Actions)-1 {
+				return nil, fmt.Errorf("step %d: null action before the end of the plan", i)
+			}
+			a = Null()
+		}
+		if first == nil {
+			first = a
+		} else {
+			last.SetChild(a)
+		}
+		last = a
+	}
+	if last == nil || last.GetType() != common.ActionTypeNull {
+		return nil, errors.New("the plan must end with a null action")
+	}
+	return first, nil
+}
+
+// MarshalPlan serializes an action chain to JSON
+func MarshalPlan(a common.Action) ([]byte, error) {
+	p, err := EncodePlan(a)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(p)
+}
+
+// UnmarshalPlan rebuilds an action chain from JSON
+func UnmarshalPlan(data []byte) (common.Action, error) {
+	var p PlanRecord
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return DecodePlan(p)
+}
+
+// Validate checks an action chain planned from a location against the graph of the world: the chain ends with a null action,
+// every move starts where the robot stands and follows edges, and every other action takes place where the robot stands.
+// When the plan carries a task, it must begin the task at its origination and end it at its destination
+func Validate(a common.Action, g graph.Graph, from common.Location, t common.Task) error {
+	actions, err := Flatten(a)
+	if err != nil {
+		return err
+	}
+	here := from
+	begun, ended := false, false
+	for i, a := range actions {
+		switch v := a.(type) {
+		case *MoveAction:
+			if !sameNode(v.Start, here) {
+				return fmt.Errorf("step %d: move starts at %v, the robot is at %v", i, id(v.Start), id(here))
+			}
+			last := graph.Node(here)
+			for _, n := range v.Path {
+				if n == nil || g.Node(n.ID()) == nil {
+					return fmt.Errorf("step %d: move goes through %v, which is not in the world", i, id(n))
+				}
+				if !g.HasEdgeBetween(last.ID(), n.ID()) {
+					return fmt.Errorf("step %d: move jumps from %d to %d without an edge", i, last.ID(), n.ID())
+				}
+				last = n
+			}
+			if !sameNode(last, v.End) {
+				return fmt.Errorf("step %d: move ends at %v instead of %v", i, id(last), id(v.End))
+			}
+			here = v.End
+		case located:
+			if !sameNode(v.Here(), here) {
+				return fmt.Errorf("step %d: %s at %v, the robot is at %v", i, Name(a.GetType()), id(v.Here()), id(here))
+			}
+			switch a.GetType() {
+			case common.ActionTypeStartTask:
+				if begun {
+					return fmt.Errorf("step %d: the task begins twice", i)
+				}
+				if t != nil && !sameNode(here, t.GetOrigination()) {
+					return fmt.Errorf("step %d: the task begins at %v instead of its origination %v", i, id(here), id(t.GetOrigination()))
+				}
+				begun = true
+			case common.ActionTypeEndTask:
+				if !begun || ended {
+					return fmt.Errorf("step %d: the task ends without having begun", i)
+				}
+				if t != nil && !sameNode(here, t.GetDestination()) {
+					return fmt.Errorf("step %d: the task ends at %v instead of its destination %v", i, id(here), id(t.GetDestination()))
+				}
+				ended = true
+			}
+		}
+	}
+	if t != nil && !ended {
+		return errors.New("the plan doesn't carry out the task")
+	}
+	if begun && !ended {
+		return errors.New("the plan begins a task it never ends")
+	}
+	return nil
+}
+
+func id(n graph.Node) interface{} {
+	if n == nil {
+		return "nowhere"
+	}
+	return n.ID()
+}
+
+// Format pretty-prints an action chain, one numbered step per line
+func Format(a common.Action) string {
+	var b strings.Builder
+	seen := make(map[common.Action]bool)
+	for i := 0; a != nil; i++ {
+		fmt.Fprintf(&b, "%d. ", i)
+		switch v := a.(type) {
+		case *MoveAction:
+			fmt.Fprintf(&b, "move %v -> %v via %v", id(v.Start), id(v.End), pathIDs(v.Path))
+		case *PickAction:
+			if v.Item != "" {
+				fmt.Fprintf(&b, "pick %d of %s at %v", v.Payload, v.Item, id(v.here))
+			} else {
+				fmt.Fprintf(&b, "pick %d at %v", v.Payload, id(v.here))
+			}
+		case *WaitAction:
+			if v.Until > 0 {
+				fmt.Fprintf(&b, "wait at %v until %d", id(v.here), v.Until)
+			} else {
+				fmt.Fprintf(&b, "wait at %v for %d", id(v.here), v.Ticks)
+			}
+		case *DropAction:
+			fmt.Fprintf(&b, "drop %d at %v", v.Payload, id(v.here))
+		case *RotateAction:
+			fmt.Fprintf(&b, "rotate %d -> %d at %v", v.From, v.To, id(v.here))
+		case located:
+			fmt.Fprintf(&b, "%s at %v", Name(a.GetType()), id(v.Here()))
+		default:
+			b.WriteString(Name(a.GetType()))
+		}
+		b.WriteString("\n")
+		if a.GetType() == common.ActionTypeNull || seen[a] {
+			break
+		}
+		seen[a] = true
+		if !a.HasChild() {
+			b.WriteString("(no null action)\n")
+			break
+		}
+		a = a.GetChild()
+	}
+	return b.String()
+}
+
+func pathIDs(p []graph.Node) []interface{} {
+	ids := make([]interface{}, len(p))
+	for i, n := range p {
+		ids[i] = id(n)
+	}
+	return ids
+}
+
+// Equal compares two action chains structurally, nil chains are only equal to each other
+func Equal(a, b common.Action) bool {
+	return equalChain(a, b)
+}
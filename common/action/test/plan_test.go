@@ -0,0 +1,156 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/action"
+	"maze/common/methods"
+	"maze/common/task"
+	"maze/common/world"
+	"strings"
+	"testing"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+func TestPlanRoundTrip(t *testing.T) {
+	w := world.CreateWarehouseWorld()
+	g := w.GetGraph()
+	tasks := []common.Task{
+		task.NewTimePriorityTaskWithParameter(g.Node(2), g.Node(12)),
+		task.NewMultiStopTask(
+			common.TaskStop{Location: g.Node(5), Type: common.PickupStop, Payload: 2},
+			common.TaskStop{Location: g.Node(8), Type: common.DropStop, Payload: 2}),
+	}
+	for _, tk := range tasks {
+		plan, err := methods.PlanTaskAction(g, g.Node(1), tk)
+		if err != nil {
+			t.Fatalf("Expect the task planned, got %v", err)
+		}
+		if err := action.Validate(plan, g, g.Node(1), tk); err != nil {
+			t.Fatalf("Expect the planned chain to be valid, got %v\n%s", err, action.Format(plan))
+		}
+		data, err := action.MarshalPlan(plan)
+		if err != nil {
+			t.Fatalf("Failed to serialize the plan: %v", err)
+		}
+		decoded, err := action.UnmarshalPlan(data)
+		if err != nil {
+			t.Fatalf("Failed to deserialize the plan: %v", err)
+		}
+		if !action.Equal(plan, decoded) || !decoded.Equal(plan) {
+			t.Errorf("Expect the decoded plan to equal the original\n%s\n%s", action.Format(plan), action.Format(decoded))
+		}
+		if err := action.Validate(decoded, g, g.Node(1), tk); err != nil {
+			t.Errorf("Expect the decoded plan to stay valid, got %v", err)
+		}
+	}
+}
+
+func TestValidateRejectsBrokenPlans(t *testing.T) {
+	w := world.CreateWarehouseWorld()
+	g := w.GetGraph()
+	tk := task.NewTimePriorityTaskWithParameter(g.Node(1), g.Node(2))
+
+	jump := action.CreateMoveActionWithPath(g.Node(1), g.Node(12), []graph.Node{g.Node(12)})
+	jump.SetChild(action.Null())
+	dangling := action.CreateBeginTaskAction(g.Node(1))
+	misplaced := action.CreateBeginTaskAction(g.Node(3))
+	misplaced.SetChild(action.CreateEndTaskAction(g.Node(3)))
+	misplaced.GetChild().SetChild(action.Null())
+	cases := map[string]struct {
+		plan common.Action
+		task common.Task
+		want string
+	}{
+		"jump":      {jump, nil, "without an edge"},
+		"dangling":  {dangling, nil, "no child"},
+		"misplaced": {misplaced, tk, "robot is at 1"},
+	}
+	for name, c := range cases {
+		err := action.Validate(c.plan, g, g.Node(1), c.task)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expect an error about %q, got %v", name, c.want, err)
+		}
+	}
+	if _, err := action.MarshalPlan(dangling); err == nil {
+		t.Errorf("Expect plans without a null action to fail serialization")
+	}
+}
+
+func TestEqualDoesNotPanic(t *testing.T) {
+	w := world.CreateWarehouseWorld()
+	g := w.GetGraph()
+	move := action.CreateMoveActionWithPath(g.Node(1), g.Node(2), []graph.Node{g.Node(2)})
+	begin := action.CreateBeginTaskAction(g.Node(1))
+	end := action.CreateEndTaskAction(g.Node(1))
+	if move.Equal(begin) || begin.Equal(end) || end.Equal(move) || action.Null().Equal(move) || move.Equal(action.Null()) {
+		t.Errorf("Expect actions of different types to differ")
+	}
+	if !begin.Equal(action.CreateBeginTaskAction(g.Node(1))) || begin.Equal(action.CreateBeginTaskAction(g.Node(2))) {
+		t.Errorf("Expect childless actions to compare by location")
+	}
+	if action.Equal(move, nil) || !action.Equal(nil, nil) {
+		t.Errorf("Expect nil chains to only equal each other")
+	}
+	if !strings.Contains(action.Format(move), "move 1 -> 2 via [2]") {
+		t.Errorf("Unexpected formatting %q", action.Format(move))
+	}
+}
+
+func TestEqualStopsOnLoopingChains(t *testing.T) {
+	g := world.CreateWarehouseWorld().GetGraph()
+	a := action.CreateBeginTaskAction(g.Node(1))
+	b := action.CreateBeginTaskAction(g.Node(1))
+	a.SetChild(a)
+	b.SetChild(b)
+	if a.Equal(b) || action.Equal(a, b) {
+		t.Errorf("Expect chains looping back on themselves not to be equal")
+	}
+	c := action.CreateBeginTaskAction(g.Node(1))
+	c.SetChild(action.CreateEndTaskAction(g.Node(1)))
+	if c.Equal(a) || a.Equal(c) {
+		t.Errorf("Expect a looping chain not to equal a finite one")
+	}
+}
+
+func TestPlanRoundTripRicherActions(t *testing.T) {
+	w := world.CreateWarehouseWorld()
+	g := w.GetGraph()
+	wait := action.CreateWaitUntilAction(g.Node(1), 7)
+	pick := action.CreatePickItemAction(g.Node(1), "sku-42", 2)
+	rotate := action.CreateRotateAction(g.Node(1), common.North, common.East)
+	dock := action.CreateDockAction(g.Node(1))
+	wait.SetChild(pick)
+	pick.SetChild(rotate)
+	rotate.SetChild(dock)
+	dock.SetChild(action.Null())
+	if err := action.Validate(wait, g, g.Node(1), nil); err != nil {
+		t.Fatalf("Expect the chain to be valid, got %v", err)
+	}
+	data, err := action.MarshalPlan(wait)
+	if err != nil {
+		t.Fatalf("Failed to serialize the plan: %v", err)
+	}
+	decoded, err := action.UnmarshalPlan(data)
+	if err != nil || !action.Equal(wait, decoded) {
+		t.Errorf("Expect the decoded plan to equal the original, got %v\n%s", err, action.Format(decoded))
+	}
+	if !strings.Contains(action.Format(decoded), "pick 2 of sku-42 at 1") {
+		t.Errorf("Unexpected formatting\n%s", action.Format(decoded))
+	}
+}
@@ -0,0 +1,243 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package auction
+
+import (
+	"log"
+	"maze/common"
+	"sort"
+)
+
+// Mode selects the auction protocol
+type Mode int
+
+const (
+	// SingleItem auctions every task on its own, and each idle robot wins at most one task per round
+	SingleItem Mode = iota
+	// Sequential auctions all tasks in a round. Robots bid their marginal cost given the tasks they already won, and may win a bundle of tasks
+	Sequential
+)
+
+// Bid is the offer of a robot for a task
+type Bid struct {
+	Robot common.RobotID
+	Task  common.Task
+	Cost  float64
+}
+
+// Award is a task assigned to a robot by the auction, at the winning cost
+type Award = Bid
+
+// Auctioneer announces the available tasks of a world to its robots, collects their bids and awards the tasks
+type Auctioneer struct {
+	Mode Mode
+	// MaxBundle bounds how many tasks a robot may win per round in a sequential auction. 0 means no bound
+	MaxBundle int
+}
+
+func CreateAuctioneer(mode Mode) *Auctioneer {
+	return &Auctioneer{Mode: mode}
+}
+
+// Winner returns the lowest bid, ties broken by robot ID so every auction resolves the same way
+func Winner(bids []Bid) (Bid, bool) {
+	if len(bids) == 0 {
+		return Bid{}, false
+	}
+	best := bids[0]
+	for _, b := range bids[1:] {
+		if b.Cost < best.Cost || (b.Cost == best.Cost && b.Robot.String() < best.Robot.String()) {
+			best = b
+		}
+	}
+	return best, true
+}
+
+// Announce returns the tasks open for auction, oldest first
+func Announce(w common.World) []common.Task {
+	tasks := append([]common.Task{}, w.GetAllTasks()...)
+	sort.SliceStable(tasks, func(i, j int) bool {
+		pi, iok := tasks[i].(common.PriorityTask)
+		pj, jok := tasks[j].(common.PriorityTask)
+		if iok && jok && pi.Priority() != pj.Priority() {
+			return pi.Priority() < pj.Priority()
+		}
+		return tasks[i].GetTaskID().String() < tasks[j].GetTaskID().String()
+	})
+	return tasks
+}
+
+// Market is where an auction collects bids and hands out awards. The robots may sit in the same process or behind messages
+type Market interface {
+	// Participants returns the robots taking part in the auction, only the ones without work when idleOnly is set
+	Participants(idleOnly bool) []common.RobotID
+	RequestBid(rid common.RobotID, t common.Task) (cost float64, ok bool)
+	Award(rid common.RobotID, t common.Task) bool
+}
+
+// Run holds one auction round among the robots of the world and returns the awards
+func (a *Auctioneer) Run(w common.World) []Award {
+	return a.Hold(w, CreateWorldMarket(w))
+}
+
+// Hold holds one auction round on the market and returns the awards. Awarded tasks are claimed on the world and handed to the winners
+func (a *Auctioneer) Hold(w common.World, m Market) []Award {
+	switch a.Mode {
+	case Sequential:
+		return a.sequential(w, m)
+	default:
+		return a.singleItem(w, m)
+	}
+}
+
+func (a *Auctioneer) singleItem(w common.World, m Market) []Award {
+	idle := m.Participants(true)
+	var awards []Award
+	for _, t := range Announce(w) {
+		if len(idle) == 0 {
+			break
+		}
+		var bids []Bid
+		for _, rid := range idle {
+			if cost, ok := m.RequestBid(rid, t); ok {
+				bids = append(bids, Bid{rid, t, cost})
+			}
+		}
+		win, ok := Winner(bids)
+		if !ok || !award(w, m, win) {
+			continue
+		}
+		awards = append(awards, win)
+		idle = remove(idle, win.Robot)
+	}
+	return awards
+}
+
+func (a *Auctioneer) sequential(w common.World, m Market) []Award {
+	participants := m.Participants(false)
+	won := make(map[common.RobotID]int)
+	tasks := Announce(w)
+	var awards []Award
+	for len(tasks) > 0 {
+		var bids []Bid
+		for _, t := range tasks {
+			for _, rid := range participants {
+				if a.MaxBundle > 0 && won[rid] >= a.MaxBundle {
+					continue
+				}
+				if cost, ok := m.RequestBid(rid, t); ok {
+					bids = append(bids, Bid{rid, t, cost})
+				}
+			}
+		}
+		win, ok := Winner(bids)
+		if !ok {
+			break
+		}
+		if award(w, m, win) {
+			awards = append(awards, win)
+			won[win.Robot]++
+		}
+		tasks = removeTask(tasks, win.Task.GetTaskID())
+	}
+	return awards
+}
+
+func award(w common.World, m Market, win Bid) bool {
+	if success, err := w.ClaimTask(win.Task.GetTaskID(), win.Robot); !success {
+		log.Printf("Err %+v, auction move on", err)
+		return false
+	}
+	if !m.Award(win.Robot, win.Task) {
+		// the robot turned the task down, release it for the next round
+		if err := w.TaskUpdate(win.Task.GetTaskID(), common.Unassigned); err != nil {
+			log.Printf("Err %+v releasing a rejected award", err)
+		}
+		return false
+	}
+	return true
+}
+
+// worldMarket is a market over the robots of a world implementing the Bidder interface
+type worldMarket struct {
+	bidders map[common.RobotID]common.Bidder
+	order   []common.RobotID
+}
+
+// CreateWorldMarket creates a market where the bidding robots of the world are called directly
+func CreateWorldMarket(w common.World) Market {
+	m := &worldMarket{bidders: make(map[common.RobotID]common.Bidder)}
+	for _, r := range w.GetRobots() {
+		if b, ok := r.(common.Bidder); ok {
+			m.bidders[b.ID()] = b
+			m.order = append(m.order, b.ID())
+		}
+	}
+	sort.Slice(m.order, func(i, j int) bool { return m.order[i].String() < m.order[j].String() })
+	return m
+}
+
+func (m *worldMarket) Participants(idleOnly bool) []common.RobotID {
+	var ids []common.RobotID
+	for _, id := range m.order {
+		if idleOnly && !Idle(m.bidders[id]) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (m *worldMarket) RequestBid(rid common.RobotID, t common.Task) (float64, bool) {
+	return m.bidders[rid].Bid(t)
+}
+
+func (m *worldMarket) Award(rid common.RobotID, t common.Task) bool {
+	return m.bidders[rid].Assign(t)
+}
+
+// Idle checks whether a robot has neither a task nor a pending action
+func Idle(r common.Robot) bool {
+	if f, ok := r.(common.Faulty); ok {
+		if _, down := f.Fault(); down {
+			return false
+		}
+	}
+	act, t := r.GetStatus()
+	if rp, ok := r.(common.Repositioner); ok && rp.Repositioning() {
+		return t == nil
+	}
+	return t == nil && act.GetType() == common.ActionTypeNull
+}
+
+func remove(ids []common.RobotID, id common.RobotID) []common.RobotID {
+	for i, other := range ids {
+		if other == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+func removeTask(tasks []common.Task, id common.TaskID) []common.Task {
+	for i, t := range tasks {
+		if t.GetTaskID() == id {
+			return append(tasks[:i], tasks[i+1:]...)
+		}
+	}
+	return tasks
+}
@@ -0,0 +1,138 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"maze/common"
+	"maze/common/auction"
+	"maze/common/methods"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/world"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type robotSetter interface {
+	common.Bidder
+	SetSelfClaim(bool)
+}
+
+func setup(locations ...int64) (*world.WarehouseWorld, *task.SimulatedTaskManager, []common.Bidder) {
+	stm := task.CreateSimulatedTaskManager()
+	w := world.CreateWarehouseWorldWithTaskManager(stm)
+	var bidders []common.Bidder
+	for _, l := range locations {
+		var r robotSetter = robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(l), w)
+		r.SetSelfClaim(false)
+		w.AddRobot(r)
+		bidders = append(bidders, r)
+	}
+	return w, stm, bidders
+}
+
+func TestSingleItemAuctionAwardsNearestRobot(t *testing.T) {
+	w, stm, bidders := setup(1, 12)
+	near12 := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(11), w.GetGraph().Node(10))
+	near1 := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3))
+	w.AddTask(near12)
+	w.AddTask(near1)
+
+	awards := auction.CreateAuctioneer(auction.SingleItem).Run(w)
+	if len(awards) != 2 {
+		t.Fatalf("Expect both tasks to be awarded, actual %d", len(awards))
+	}
+	for _, a := range awards {
+		if a.Task == near12 && a.Robot != bidders[1].ID() || a.Task == near1 && a.Robot != bidders[0].ID() {
+			t.Errorf("Task should go to the nearest robot, actual %+v", a)
+		}
+	}
+	if stm.HasTasks() || stm.ActiveCount() != 2 {
+		t.Errorf("Awarded tasks should be claimed")
+	}
+	for i := 0; i < 10; i++ {
+		for _, b := range bidders {
+			b.Run()
+		}
+	}
+	if stm.FinishedCount() != 2 {
+		t.Errorf("Robots should carry out awarded tasks, finished %d", stm.FinishedCount())
+	}
+}
+
+func TestSequentialAuctionAwardsBundles(t *testing.T) {
+	w, stm, bidders := setup(1, 12)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(2)))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(4)))
+
+	awards := auction.CreateAuctioneer(auction.Sequential).Run(w)
+	if len(awards) != 3 {
+		t.Fatalf("Expect all tasks to be awarded, actual %d", len(awards))
+	}
+	for _, a := range awards {
+		if a.Robot != bidders[0].ID() {
+			t.Errorf("Chained tasks should be bundled on the robot at node 1, actual %+v", a)
+		}
+	}
+	for i := 0; i < 15; i++ {
+		bidders[0].Run()
+	}
+	if stm.FinishedCount() != 3 {
+		t.Errorf("Robot should carry out the whole bundle, finished %d", stm.FinishedCount())
+	}
+}
+
+func TestSelectTaskByDistance(t *testing.T) {
+	w, _, bidders := setup(12)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(2)))
+	near := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(11), w.GetGraph().Node(2))
+	w.AddTask(near)
+	selected, p, err := methods.SelectTaskByDistance(task.CreateSimulatedTaskManager(), bidders[0], w)
+	if selected != nil || err != nil {
+		t.Errorf("Expect nothing selected on an empty task manager, got %+v", selected)
+	}
+	tm := task.CreateSimulatedTaskManager()
+	tm.AddTasks(w.GetAllTasks())
+	selected, p, err = methods.SelectTaskByDistance(tm, bidders[0], w)
+	if err != nil || selected.GetTaskID() != near.GetTaskID() || len(p) != 2 {
+		t.Errorf("Expect the task at node 11 to be selected, got %+v, path %+v, err %+v", selected, p, err)
+	}
+}
+
+// rejectingMarket collects bids from the world's robots, but every robot turns its award down
+type rejectingMarket struct {
+	auction.Market
+}
+
+func (rejectingMarket) Award(rid common.RobotID, t common.Task) bool {
+	return false
+}
+
+func TestRejectedAwardReleasesClaim(t *testing.T) {
+	w, stm, _ := setup(1)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+
+	awards := auction.CreateAuctioneer(auction.SingleItem).Hold(w, rejectingMarket{auction.CreateWorldMarket(w)})
+	if len(awards) != 0 {
+		t.Errorf("Expect no awards when the robot rejects, actual %d", len(awards))
+	}
+	if !stm.HasTasks() || stm.ActiveCount() != 0 {
+		t.Errorf("Expect the rejected task to be released for the next auction")
+	}
+}
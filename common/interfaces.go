@@ -36,8 +36,42 @@ const (
 	ActionTypeStartTask
 	ActionTypeEndTask
 	ActionTypeNull
+	ActionTypePick
+	ActionTypeDrop
+	ActionTypeCharge
+	ActionTypeRotate
+	ActionTypeWait
+	ActionTypeDock
 )
 
+// Heading is the direction a robot faces, in steps of 45 degrees clockwise from north
+type Heading int
+
+const (
+	// NoHeading is the heading of robots which don't track where they face
+	NoHeading Heading = iota
+	North
+	NorthEast
+	East
+	SouthEast
+	South
+	SouthWest
+	West
+	NorthWest
+)
+
+// Turns returns the smallest number of 45 degree steps to rotate from one heading to the other
+func Turns(from, to Heading) int {
+	if from == NoHeading || to == NoHeading {
+		return 0
+	}
+	d := (int(to) - int(from) + 8) % 8
+	if d > 4 {
+		d = 8 - d
+	}
+	return d
+}
+
 type Action interface {
 	GetType() ActionType
 	GetContent() interface{}
@@ -52,10 +86,46 @@ type DurationAction interface {
 	SetStatus(ActionStatus)
 }
 
+// TimedAction is an action lasting a number of ticks, going from pending to active to end
+type TimedAction interface {
+	Action
+	DurationAction
+	// Advance spends a tick on the action, start gives the number of ticks when it begins. It returns true once the action ends
+	Advance(start func() int) bool
+	Remaining() int
+}
+
+// Capability is a tag for what a robot can do, such as "lift-pallet"
+type Capability string
+
+// RobotType describes a model of robot shared by many robots of a fleet
+type RobotType interface {
+	GetName() string
+	GetCapabilities() []Capability
+	// GetSpeed returns the number of edges the robot moves per tick
+	GetSpeed() float64
+	// CanTraverse checks whether robots of the type may move along the edge between two nodes
+	CanTraverse(from, to graph.Node) bool
+}
+
+// FaultMode defines how a broken down robot misbehaves until it is repaired
+type FaultMode int
+
+const (
+	// FaultStopped robots stay in place, blocking their node
+	FaultStopped FaultMode = iota
+	// FaultDegraded robots keep working at a fraction of their speed
+	FaultDegraded
+	// FaultLostComm robots carry on with their plan, but can neither claim nor report tasks
+	FaultLostComm
+)
+
 // RobotID is an alias to UUID for disambiguation purpose
 type RobotID = uuid.UUID
 type Robot interface {
 	ID() RobotID
+	Type() RobotType
+	Capabilities() []Capability
 	Init() bool
 	Run() Trace
 	Location() graph.Node
@@ -64,6 +134,21 @@ type Robot interface {
 	GetStatus() (Action, Task)
 }
 
+// Carrier extends the Robot interface for robots that carry payload. Load never exceeds Capacity
+type Carrier interface {
+	Robot
+	Capacity() int
+	Load() int
+}
+
+// Bidder extends the Robot interface for robots taking part in task auctions.
+// Bid returns the cost estimate of the robot to carry out the task, or false when it can't take the task. Assign hands an awarded task to the robot
+type Bidder interface {
+	Robot
+	Bid(t Task) (cost float64, ok bool)
+	Assign(t Task) bool
+}
+
 type TraceType int
 
 const (
@@ -82,13 +167,39 @@ type TaskStatus int
 
 // Unassigned defines task which are not assigned to any worker
 // Assigned defines task that has been assigned to a worker, either in progress or not
-// Completed refers to task that are complemented and should no longer be available in task queue, but traceable (TTL implementation subject to detail)
+// Completed refers to task that are complemented and should no longer be available in task queue, but traceable in the archive of the task manager, as long as its retention allows
 const (
 	Unassigned = iota
 	Assigned
 	Completed
 )
 
+// Faulty extends the Robot interface for robots which can break down and be repaired
+type Faulty interface {
+	Robot
+	// Fail breaks the robot down for the given number of ticks. Factor scales the speed of degraded robots
+	Fail(mode FaultMode, duration int, factor float64)
+	Repair()
+	// Fault returns the current failure of the robot, false when it works
+	Fault() (FaultMode, bool)
+}
+
+// Repositioner extends the Robot interface for robots moving to a better spot while idle. They stay available for tasks on the way
+type Repositioner interface {
+	Robot
+	Repositioning() bool
+}
+
+// ObstructedWorld extends the World interface with nodes blocked for a while, such as by a broken down robot.
+// Planners route around blocked nodes
+type ObstructedWorld interface {
+	World
+	Block(n graph.Node, by RobotID)
+	Unblock(n graph.Node, by RobotID)
+	IsBlocked(n graph.Node) bool
+	Blocked() []graph.Node
+}
+
 //TaskID is the alias name for a UUID, for disambiguation purpose
 type TaskID = uuid.UUID
 
@@ -107,6 +218,34 @@ type Task interface {
 	GetStatus() TaskStatus
 }
 
+// StopType defines what a robot does once it reaches a stop of a multi-stop task
+type StopType int
+
+const (
+	PickupStop StopType = iota
+	DropStop
+)
+
+// TaskStop is a single stop of a multi-stop task. Payload is the amount picked up or dropped at Location, Item names what is picked up, if any
+type TaskStop struct {
+	Location graph.Node
+	Type     StopType
+	Payload  int
+	Item     string
+}
+
+// MultiStopTask extends the Task interface with an ordered list of stops. The origination is the first stop and the destination is the last stop
+type MultiStopTask interface {
+	Task
+	GetStops() []TaskStop
+}
+
+// CapabilityTask extends the Task interface for tasks which only robots with the required capabilities can claim
+type CapabilityTask interface {
+	Task
+	RequiredCapabilities() []Capability
+}
+
 //TaskManager defines task manager interfaces. All task generator, coordinator must follow this type
 type TaskManager interface {
 	GetBroadcastInfo() interface{}
@@ -122,7 +261,34 @@ type TaskManager interface {
 // PassiveTaskManager extends the TaskManager interface and allows robots to claim tasks
 type PassiveTaskManager interface {
 	TaskManager
-	//	ClaimTask(Task, RobotID) error
+	ClaimTask(taskID TaskID, robotID RobotID) error
+}
+
+// ETA is the predicted completion tick of an assigned task. Initial is the first prediction for the robot carrying it, Latest the most recent one
+type ETA struct {
+	Robot   RobotID
+	Initial int
+	Latest  int
+}
+
+// ETATaskManager extends the TaskManager interface with the predicted completion of assigned tasks
+type ETATaskManager interface {
+	TaskManager
+	SetETA(taskID TaskID, robotID RobotID, tick int)
+	ETA(taskID TaskID) (ETA, bool)
+	ETAs() map[TaskID]ETA
+}
+
+// Estimate is the predicted time, in ticks, and energy for a robot to carry out its remaining actions
+type Estimate struct {
+	Ticks  float64
+	Energy float64
+}
+
+// Estimator extends the Robot interface for robots able to predict when they are done with their current actions
+type Estimator interface {
+	Robot
+	Estimate() Estimate
 }
 type Location graph.Node
 
@@ -151,6 +317,13 @@ type Simulation interface {
 	Init()
 	Run(obs Observer) error
 	Stop() bool
+	// Pause holds the run before its next tick, Resume lets it go on
+	Pause()
+	Resume()
+	// Step runs a single tick of the simulation and pauses it again, returning once the tick is done
+	Step()
+	// SetSpeed paces the run at a multiple of real time, zero runs it as fast as possible
+	SetSpeed(multiple float64)
 }
 type Actor interface {
 	Init()
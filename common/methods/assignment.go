@@ -0,0 +1,167 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package methods
+
+import "math"
+
+// HungarianAssign solves the assignment problem on a rows×columns cost matrix, minimizing the total cost.
+// It returns the column assigned to each row, -1 when a row is left out (more rows than columns, or only infeasible columns).
+// Infeasible pairs are marked with +Inf cost
+func HungarianAssign(cost [][]float64) []int {
+	n := len(cost)
+	if n == 0 || len(cost[0]) == 0 {
+		return unassigned(n)
+	}
+	m := len(cost[0])
+	if n > m {
+		transposed := make([][]float64, m)
+		for j := range transposed {
+			transposed[j] = make([]float64, n)
+			for i := range cost {
+				transposed[j][i] = cost[i][j]
+			}
+		}
+		res := unassigned(n)
+		for j, i := range HungarianAssign(transposed) {
+			if i >= 0 {
+				res[i] = j
+			}
+		}
+		return res
+	}
+	// infeasible pairs get a cost larger than any feasible assignment, and are dropped afterwards
+	big := 1.0
+	for _, row := range cost {
+		for _, c := range row {
+			if !math.IsInf(c, 1) {
+				big += math.Abs(c)
+			}
+		}
+	}
+	at := func(i, j int) float64 {
+		if math.IsInf(cost[i][j], 1) {
+			return big
+		}
+		return cost[i][j]
+	}
+	// potentials method, rows and columns are 1-indexed, column 0 is a sentinel
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)
+	way := make([]int, m+1)
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		used := make([]bool, m+1)
+		for {
+			used[j0] = true
+			i0 := p[j0]
+			delta := math.Inf(1)
+			j1 := 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				cur := at(i0-1, j-1) - u[i0] - v[j]
+				if cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+	res := unassigned(n)
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 && !math.IsInf(cost[p[j]-1][j-1], 1) {
+			res[p[j]-1] = j - 1
+		}
+	}
+	return res
+}
+
+// GreedyAssign lets every row, in order, take its cheapest column not taken yet
+func GreedyAssign(cost [][]float64) []int {
+	res := unassigned(len(cost))
+	taken := make(map[int]bool)
+	for i, row := range cost {
+		best := math.Inf(1)
+		for j, c := range row {
+			if !taken[j] && c < best {
+				best = c
+				res[i] = j
+			}
+		}
+		if res[i] >= 0 {
+			taken[res[i]] = true
+		}
+	}
+	return res
+}
+
+// AssignmentCost sums the cost of an assignment returned by HungarianAssign or GreedyAssign
+func AssignmentCost(cost [][]float64, assignment []int) float64 {
+	total := 0.0
+	for i, j := range assignment {
+		if j >= 0 {
+			total += cost[i][j]
+		}
+	}
+	return total
+}
+
+// AssignmentSize counts the rows assigned a column
+func AssignmentSize(assignment []int) int {
+	n := 0
+	for _, j := range assignment {
+		if j >= 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func unassigned(n int) []int {
+	res := make([]int, n)
+	for i := range res {
+		res[i] = -1
+	}
+	return res
+}
@@ -16,37 +16,49 @@
 package methods
 
 import (
+	"container/heap"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/path"
 	"gonum.org/v1/gonum/graph/simple"
 	"log"
+	"math"
 	"math/rand"
 	"maze/common"
 	"maze/common/action"
 	"maze/common/task"
 	"maze/common/trace"
+	"sort"
 )
 
-// TaskGenerator is the generator function for randomly producing tasks
-func TaskGenerator(maxTasks int, w common.World) []common.Task {
+// TaskGenerator is the generator function for randomly producing tasks, drawing from the given random stream
+func TaskGenerator(rnd *rand.Rand, maxTasks int, w common.World) []common.Task {
 
 	n := w.GetGraph().Nodes().Len()
 	var tList []common.Task
 	for i := 0; i < maxTasks; i++ {
-		if rand.Intn(2) > 0 {
-			uid, _ := uuid.NewUUID()
+		if rnd.Intn(2) > 0 {
 			tList = append(tList, task.TimePriorityTask{
-				ID:          uid,
-				Origin:      w.GetGraph().Node((int64)(rand.Intn(n))),
-				Destination: w.GetGraph().Node((int64)(rand.Intn(n))),
+				ID:          RandomID(rnd),
+				Origin:      w.GetGraph().Node((int64)(rnd.Intn(n) + 1)),
+				Destination: w.GetGraph().Node((int64)(rnd.Intn(n) + 1)),
 			})
 		}
 	}
 	return tList
 }
 
+// RandomID draws a version 4 UUID from the random stream, so seeded runs name robots and tasks the same way
+func RandomID(rnd *rand.Rand) uuid.UUID {
+	var id uuid.UUID
+	rnd.Read(id[:])
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return id
+}
+
 func NoMove(r common.Robot, t int) common.Trace {
 	return &trace.MoveTrace{
 		RobotID:   r.ID(),
@@ -66,7 +78,7 @@ func NoMove(r common.Robot, t int) common.Trace {
 // RandMove is a basic function, robot takes a random move that it can move to.
 // if there is only one path, robot will move
 // this is stateless, regardless of previous move taken
-func RandMove(w common.World, r common.Robot, t int) common.Trace {
+func RandMove(rnd *rand.Rand, w common.World, r common.Robot, t int) common.Trace {
 	locs := w.GetGraph().From(r.Location().ID())
 
 	bufs := graph.NodesOf(locs)
@@ -74,7 +86,7 @@ func RandMove(w common.World, r common.Robot, t int) common.Trace {
 	rTrace := &trace.MoveTrace{
 		RobotID:   r.ID(),
 		Source:    r.Location(),
-		Target:    bufs[rand.Intn(len(bufs))],
+		Target:    bufs[rnd.Intn(len(bufs))],
 		Timestamp: t,
 	}
 	// r.Location() = trace.Target
@@ -85,19 +97,101 @@ func NextMove(graph simple.DirectedGraph, start graph.Node) graph.Node {
 	// path, ok =
 	return graph.From(start.ID()).Node()
 }
+
+// GetPath returns a shortest path between two locations, without the starting one, and an error when the end can't be reached
 func GetPath(start, end common.Location, g graph.Graph) ([]graph.Node, error) {
-	pt, ok := path.BellmanFordFrom(start, g)
-	if ok {
-		p, _ := pt.To(end.ID())
-		if len(p) == 0 {
-			panic("No Path")
+	p, _ := Shortest(g, start, end)
+	if p == nil {
+		return nil, fmt.Errorf("no path from %d to %d", start.ID(), end.ID())
+	}
+	return p, nil
+}
+
+// Shortest returns a shortest path between two locations, without the starting one, and its weight.
+// Among paths of equal weight it always picks the same one, whatever the order the graph lists its nodes in.
+// The path is nil and the weight +Inf when the end can't be reached
+func Shortest(g graph.Graph, from, to common.Location) ([]graph.Node, float64) {
+	if from.ID() == to.ID() {
+		return []graph.Node{}, 0
+	}
+	dist := map[int64]float64{from.ID(): 0}
+	prev := make(map[int64]int64)
+	q := &nodeQueue{{from.ID(), 0}}
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(nodeItem)
+		if cur.dist > dist[cur.id] {
+			continue
 		}
-		return p[1:], nil
-	} else {
-		return nil, errors.New("negative cycle")
+		if cur.id == to.ID() {
+			var p []graph.Node
+			for id := cur.id; id != from.ID(); id = prev[id] {
+				p = append([]graph.Node{g.Node(id)}, p...)
+			}
+			return p, cur.dist
+		}
+		neighbors := graph.NodesOf(g.From(cur.id))
+		sort.Slice(neighbors, func(i, j int) bool { return neighbors[i].ID() < neighbors[j].ID() })
+		for _, n := range neighbors {
+			d := cur.dist + weight(g, cur.id, n.ID())
+			if old, seen := dist[n.ID()]; !seen || d < old {
+				dist[n.ID()] = d
+				prev[n.ID()] = cur.id
+				heap.Push(q, nodeItem{n.ID(), d})
+			}
+		}
+	}
+	return nil, math.Inf(1)
+}
+
+func weight(g graph.Graph, from, to int64) float64 {
+	if wg, ok := g.(graph.Weighted); ok {
+		if w, ok := wg.Weight(from, to); ok {
+			return w
+		}
+	}
+	return 1
+}
+
+type nodeItem struct {
+	id   int64
+	dist float64
+}
+
+// nodeQueue orders nodes by distance, then by ID
+type nodeQueue []nodeItem
+
+func (q nodeQueue) Len() int { return len(q) }
+func (q nodeQueue) Less(i, j int) bool {
+	if q[i].dist != q[j].dist {
+		return q[i].dist < q[j].dist
 	}
+	return q[i].id < q[j].id
 }
-func PlanTaskAction(g graph.Graph, location common.Location, task common.Task) common.Action {
+func (q nodeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *nodeQueue) Push(x interface{}) { *q = append(*q, x.(nodeItem)) }
+func (q *nodeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// PlanTaskAction moves to the origin of the task, then carries it to its destination along shortest paths.
+// It returns an error when a leg of the task can't be reached
+func PlanTaskAction(g graph.Graph, location common.Location, task common.Task) (common.Action, error) {
+	return PlanTaskActionWith(location, task, func(from, to common.Location) ([]graph.Node, error) {
+		return GetPath(from, to, g)
+	})
+}
+
+// Router returns the nodes leading from one location to the other, without the starting one
+type Router func(from, to common.Location) ([]graph.Node, error)
+
+// PlanTaskActionWith plans the task like PlanTaskAction, moving along the paths of the router
+func PlanTaskActionWith(location common.Location, task common.Task, route Router) (common.Action, error) {
+	if ms, ok := task.(common.MultiStopTask); ok {
+		return PlanMultiStopTaskActionWith(location, ms, route)
+	}
 	var start common.Action
 	var current common.Action
 	if location == task.GetOrigination() {
@@ -105,21 +199,79 @@ func PlanTaskAction(g graph.Graph, location common.Location, task common.Task) c
 		current = start
 	} else {
 		start = action.CreateMoveAction(location, task.GetOrigination())
-		pat, err := GetPath(location, task.GetOrigination(), g)
+		pat, err := route(location, task.GetOrigination())
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		start.(*action.MoveAction).Path = pat
-		start.SetChild(action.CreateBeginTaskAction(location))
+		start.SetChild(action.CreateBeginTaskAction(task.GetOrigination()))
 		current = start.GetChild()
 	}
 
-	p, _ := GetPath(task.GetOrigination(), task.GetDestination(), g)
+	p, err := route(task.GetOrigination(), task.GetDestination())
+	if err != nil {
+		return nil, err
+	}
 	current.SetChild(action.CreateMoveActionWithPath(task.GetOrigination(), task.GetDestination(), p))
 	current.GetChild().SetChild(action.CreateEndTaskAction(task.GetDestination()))
 	current.GetChild().GetChild().SetChild(action.Null())
 
-	return start
+	return start, nil
+}
+
+// PlanMultiStopTaskAction chains moves between the stops of the task, with a pick or drop action at every stop.
+// The task begins at the first stop and ends at the last one. It returns an error when a stop can't be reached
+func PlanMultiStopTaskAction(g graph.Graph, location common.Location, task common.MultiStopTask) (common.Action, error) {
+	return PlanMultiStopTaskActionWith(location, task, func(from, to common.Location) ([]graph.Node, error) {
+		return GetPath(from, to, g)
+	})
+}
+
+// PlanMultiStopTaskActionWith plans the task like PlanMultiStopTaskAction, moving along the paths of the router
+func PlanMultiStopTaskActionWith(location common.Location, task common.MultiStopTask, route Router) (common.Action, error) {
+	stops := task.GetStops()
+	if len(stops) == 0 {
+		return action.Null(), nil
+	}
+	head := &chain{}
+	here := location
+	for i, stop := range stops {
+		if here != stop.Location {
+			p, err := route(here, stop.Location)
+			if err != nil {
+				return nil, err
+			}
+			head.append(action.CreateMoveActionWithPath(here, stop.Location, p))
+			here = stop.Location
+		}
+		if i == 0 {
+			head.append(action.CreateBeginTaskAction(here))
+		}
+		switch stop.Type {
+		case common.PickupStop:
+			head.append(action.CreatePickItemAction(here, stop.Item, stop.Payload))
+		case common.DropStop:
+			head.append(action.CreateDropAction(here, stop.Payload))
+		}
+	}
+	head.append(action.CreateEndTaskAction(here))
+	head.append(action.Null())
+	return head.first, nil
+}
+
+// chain is a helper to build linked action sequences
+type chain struct {
+	first common.Action
+	last  common.Action
+}
+
+func (c *chain) append(a common.Action) {
+	if c.first == nil {
+		c.first = a
+	} else {
+		c.last.SetChild(a)
+	}
+	c.last = a
 }
 
 // SelectTaskByDistance returns a task from queue, and returns that task. If there is an error, return err
@@ -131,20 +283,49 @@ func SelectTaskByDistance(tm common.PassiveTaskManager, robot common.Robot, worl
 	}
 	//claiming task
 	var tMin common.PriorityTask
-	minWeight := 0.0
+	minWeight := math.Inf(1)
 	var weight float64
 	var p, pMin []graph.Node
-	pt, _ := path.BellmanFordFrom(robot.Location(), world.GetGraph())
 	for _, t := range tq {
-
-		p, weight = pt.To(t.GetOrigination().ID())
+		pTask, ok := t.(common.PriorityTask)
+		if !ok {
+			continue
+		}
+		p, weight = Shortest(world.GetGraph(), robot.Location(), t.GetOrigination())
+		p = append([]graph.Node{robot.Location()}, p...)
 
 		if weight < minWeight {
 			minWeight = weight
-			tMin = t.(task.TimePriorityTask)
+			tMin = pTask
 			pMin = p
 		}
 	}
+	if tMin == nil {
+		return nil, nil, errors.New("no reachable task")
+	}
 	// err := tm.ClaimTask(tMin, robot.ID())
 	return tMin, pMin, nil
 }
+
+// Distance returns the shortest path weight between two locations, +Inf if unreachable
+func Distance(g graph.Graph, from, to common.Location) float64 {
+	if from.ID() == to.ID() {
+		return 0
+	}
+	_, weight := path.DijkstraFrom(from, g).To(to.ID())
+	return weight
+}
+
+// TaskDistance returns the travel needed to carry out a task starting at a given location, visiting every stop in order
+func TaskDistance(g graph.Graph, from common.Location, t common.Task) float64 {
+	if ms, ok := t.(common.MultiStopTask); ok {
+		total := 0.0
+		here := from
+		for _, s := range ms.GetStops() {
+			total += Distance(g, here, s.Location)
+			here = s.Location
+		}
+		return total
+	}
+	return Distance(g, from, t.GetOrigination()) + Distance(g, t.GetOrigination(), t.GetDestination())
+}
@@ -0,0 +1,87 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package methods
+
+import (
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/iterator"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// restrictedGraph is a view of a graph where only the edges accepted by allow can be traversed
+type restrictedGraph struct {
+	graph.Graph
+	allow func(from, to graph.Node) bool
+}
+
+// Restrict returns a view of the graph where an edge from one node to another exists only if allow accepts it.
+// Edge weights of the underlying graph are kept, graphs without weights count 1 per edge
+func Restrict(g graph.Graph, allow func(from, to graph.Node) bool) graph.Weighted {
+	return &restrictedGraph{g, allow}
+}
+
+func (r *restrictedGraph) From(id int64) graph.Nodes {
+	from := r.Graph.Node(id)
+	if from == nil {
+		return graph.Empty
+	}
+	var nodes []graph.Node
+	for _, to := range graph.NodesOf(r.Graph.From(id)) {
+		if r.allow(from, to) {
+			nodes = append(nodes, to)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID() < nodes[j].ID() })
+	return iterator.NewOrderedNodes(nodes)
+}
+
+func (r *restrictedGraph) HasEdgeBetween(xid, yid int64) bool {
+	return r.Edge(xid, yid) != nil || r.Edge(yid, xid) != nil
+}
+
+func (r *restrictedGraph) Edge(uid, vid int64) graph.Edge {
+	e := r.Graph.Edge(uid, vid)
+	if e == nil || !r.allow(r.Graph.Node(uid), r.Graph.Node(vid)) {
+		return nil
+	}
+	return e
+}
+
+func (r *restrictedGraph) WeightedEdge(uid, vid int64) graph.WeightedEdge {
+	e := r.Edge(uid, vid)
+	if e == nil {
+		return nil
+	}
+	if w, ok := r.Graph.(graph.Weighted); ok {
+		return w.WeightedEdge(uid, vid)
+	}
+	return simple.WeightedEdge{F: e.From(), T: e.To(), W: 1}
+}
+
+func (r *restrictedGraph) Weight(xid, yid int64) (float64, bool) {
+	if xid == yid {
+		return 0, true
+	}
+	if r.Edge(xid, yid) == nil {
+		return 0, false
+	}
+	if w, ok := r.Graph.(graph.Weighted); ok {
+		return w.Weight(xid, yid)
+	}
+	return 1, true
+}
@@ -0,0 +1,58 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"math"
+	"maze/common/methods"
+	"testing"
+)
+
+func TestHungarianAssignBeatsGreedy(t *testing.T) {
+	cost := [][]float64{
+		{1, 2},
+		{1, 10},
+	}
+	optimal := methods.HungarianAssign(cost)
+	if optimal[0] != 1 || optimal[1] != 0 || methods.AssignmentCost(cost, optimal) != 3 {
+		t.Errorf("Expect optimal assignment [1 0] with cost 3, actual %+v", optimal)
+	}
+	greedy := methods.GreedyAssign(cost)
+	if methods.AssignmentCost(cost, greedy) != 11 {
+		t.Errorf("Expect greedy assignment with cost 11, actual %+v", greedy)
+	}
+}
+
+func TestHungarianAssignRectangular(t *testing.T) {
+	inf := math.Inf(1)
+	cost := [][]float64{
+		{4, 1, 3},
+		{2, 0, 5},
+		{3, 2, 2},
+		{inf, inf, inf},
+	}
+	res := methods.HungarianAssign(cost)
+	if res[3] != -1 {
+		t.Errorf("Row with infeasible columns should be left out, actual %+v", res)
+	}
+	if methods.AssignmentCost(cost, res) != 5 {
+		t.Errorf("Expect total cost 5, actual %+v", res)
+	}
+	wide := methods.HungarianAssign([][]float64{{5, 1, 4}})
+	if wide[0] != 1 {
+		t.Errorf("Single row should take the cheapest column, actual %+v", wide)
+	}
+}
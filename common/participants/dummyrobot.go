@@ -16,17 +16,53 @@
 
 package participants
 
-// // DummyBot serves as a reference implementation for robot type participants
-// type DummyBot struct {
-// 	observationChannel
-// }
+import (
+	"maze/common"
+	"sort"
+)
 
-// // Announce broad cast its location, movement and observations to others via pre-defined channels.
-// func (b DummyBot) Announce() {
+// DummyBot serves as a reference implementation for robot type participants. It keeps the latest intent heard from every neighbor
+type DummyBot struct {
+	id                 common.RobotID
+	network            *Network
+	observationChannel chan Intent
+	known              map[common.RobotID]Intent
+}
 
-// }
+// Announce broad cast its location, movement and observations to others via pre-defined channels.
+func (b *DummyBot) Announce(i Intent) {
+	i.Robot = b.id
+	b.network.Broadcast(i)
+}
 
-// // Observe takes information and other observations from pre-defined channels
-// func (b DummyBot) Observe() {
+// Observe takes information and other observations from pre-defined channels, and returns the latest intent of every neighbor heard so far
+func (b *DummyBot) Observe() []Intent {
+	for {
+		select {
+		case i := <-b.observationChannel:
+			if last, ok := b.known[i.Robot]; !ok || last.Tick <= i.Tick {
+				b.known[i.Robot] = i
+			}
+		default:
+			var intents []Intent
+			for _, i := range b.known {
+				intents = append(intents, i)
+			}
+			sort.Slice(intents, func(x, y int) bool { return intents[x].Robot.String() < intents[y].Robot.String() })
+			return intents
+		}
+	}
+}
 
-// }
+// Forget drops the intents heard before the tick
+func (b *DummyBot) Forget(before int) {
+	for id, i := range b.known {
+		if i.Tick < before {
+			delete(b.known, id)
+		}
+	}
+}
+
+func (b *DummyBot) ID() common.RobotID {
+	return b.id
+}
@@ -0,0 +1,102 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package participants
+
+import (
+	"maze/common"
+	"sync"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/path"
+)
+
+// Intent is what a robot tells its neighbors: where it stands, and the path it is about to follow
+type Intent struct {
+	Robot    common.RobotID
+	Tick     int
+	Location graph.Node
+	Path     []graph.Node
+	// Busy is set while the robot carries out a task
+	Busy bool
+}
+
+// Next returns the node the robot moves to next, false when it stays
+func (i Intent) Next() (graph.Node, bool) {
+	if len(i.Path) == 0 {
+		return nil, false
+	}
+	return i.Path[0], true
+}
+
+// Outranks checks whether the robot of the intent goes first over the other robot. Robots busy with a task go
+// before idle ones, then the lowest ID goes first
+func (i Intent) Outranks(other common.RobotID, otherBusy bool) bool {
+	if i.Busy != otherBusy {
+		return i.Busy
+	}
+	return i.Robot.String() < other.String()
+}
+
+// InboxSize is the number of messages a bot holds before it misses new ones
+const InboxSize = 64
+
+// Network delivers the intents of a robot to the robots within Range edges of it. Robots out of range, and robots
+// with a full inbox, miss the message
+type Network struct {
+	Range     float64
+	distances path.AllShortest
+	bots      map[common.RobotID]*DummyBot
+	locations map[common.RobotID]int64
+	m         sync.Mutex
+}
+
+func CreateNetwork(g graph.Graph, commRange float64) *Network {
+	return &Network{
+		Range:     commRange,
+		distances: path.DijkstraAllPaths(g),
+		bots:      make(map[common.RobotID]*DummyBot),
+		locations: make(map[common.RobotID]int64),
+	}
+}
+
+// Join returns the bot the robot at the location talks to its neighbors through
+func (n *Network) Join(id common.RobotID, at graph.Node) *DummyBot {
+	n.m.Lock()
+	defer n.m.Unlock()
+	b := &DummyBot{id, n, make(chan Intent, InboxSize), make(map[common.RobotID]Intent)}
+	n.bots[id] = b
+	n.locations[id] = at.ID()
+	return b
+}
+
+// Broadcast sends the intent to the robots in range of its location
+func (n *Network) Broadcast(i Intent) {
+	n.m.Lock()
+	defer n.m.Unlock()
+	n.locations[i.Robot] = i.Location.ID()
+	for id, b := range n.bots {
+		at, ok := n.locations[id]
+		if id == i.Robot || !ok || n.distances.Weight(i.Location.ID(), at) > n.Range {
+			continue
+		}
+		select {
+		case b.observationChannel <- i:
+		default:
+			// inbox full, the message is lost
+		}
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package participants
+
+import (
+	"fmt"
+	"maze/common"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// IntentState is the serializable form of an intent, nodes are kept as their IDs
+type IntentState struct {
+	Robot    common.RobotID `json:"robot"`
+	Tick     int            `json:"tick"`
+	Location int64          `json:"location"`
+	Path     []int64        `json:"path,omitempty"`
+	Busy     bool           `json:"busy,omitempty"`
+}
+
+// BotState is the serializable state of a bot: the intents waiting in its inbox, and the latest intents heard from its neighbors
+type BotState struct {
+	Inbox []IntentState `json:"inbox,omitempty"`
+	Known []IntentState `json:"known,omitempty"`
+}
+
+// NetworkState is the serializable state of a network: where every robot last broadcast from, and the messages of every bot
+type NetworkState struct {
+	Locations map[common.RobotID]int64    `json:"locations"`
+	Bots      map[common.RobotID]BotState `json:"bots"`
+}
+
+// Snapshot saves the messages in flight between the robots. The network must not be broadcasting meanwhile
+func (n *Network) Snapshot() NetworkState {
+	n.m.Lock()
+	defer n.m.Unlock()
+	s := NetworkState{Locations: make(map[common.RobotID]int64), Bots: make(map[common.RobotID]BotState)}
+	for id, at := range n.locations {
+		s.Locations[id] = at
+	}
+	for id, b := range n.bots {
+		var bs BotState
+		// the inbox is read in full and filled again in the same order
+		inbox := drain(b.observationChannel)
+		for _, i := range inbox {
+			b.observationChannel <- i
+			bs.Inbox = append(bs.Inbox, snapshotIntent(i))
+		}
+		for _, i := range b.known {
+			bs.Known = append(bs.Known, snapshotIntent(i))
+		}
+		sort.Slice(bs.Known, func(x, y int) bool { return bs.Known[x].Robot.String() < bs.Known[y].Robot.String() })
+		s.Bots[id] = bs
+	}
+	return s
+}
+
+// Restore puts the messages in flight back, on the bots of the robots which joined the network the saved state was taken of
+func (n *Network) Restore(s NetworkState, g graph.Graph) error {
+	n.m.Lock()
+	defer n.m.Unlock()
+	if len(s.Bots) != len(n.bots) {
+		return fmt.Errorf("the network has %d bots, the saved state %d", len(n.bots), len(s.Bots))
+	}
+	inboxes := make(map[common.RobotID][]Intent)
+	known := make(map[common.RobotID]map[common.RobotID]Intent)
+	for id, bs := range s.Bots {
+		if _, ok := n.bots[id]; !ok {
+			return fmt.Errorf("robot %s didn't join the network", id)
+		}
+		known[id] = make(map[common.RobotID]Intent)
+		for _, is := range bs.Inbox {
+			i, err := restoreIntent(is, g)
+			if err != nil {
+				return err
+			}
+			inboxes[id] = append(inboxes[id], i)
+		}
+		for _, is := range bs.Known {
+			i, err := restoreIntent(is, g)
+			if err != nil {
+				return err
+			}
+			known[id][i.Robot] = i
+		}
+	}
+	n.locations = make(map[common.RobotID]int64)
+	for id, at := range s.Locations {
+		n.locations[id] = at
+	}
+	for id, b := range n.bots {
+		drain(b.observationChannel)
+		for _, i := range inboxes[id] {
+			b.observationChannel <- i
+		}
+		b.known = known[id]
+	}
+	return nil
+}
+
+// drain empties an inbox, returning its intents in the order they arrived
+func drain(inbox chan Intent) []Intent {
+	var intents []Intent
+	for {
+		select {
+		case i := <-inbox:
+			intents = append(intents, i)
+		default:
+			return intents
+		}
+	}
+}
+
+func snapshotIntent(i Intent) IntentState {
+	s := IntentState{Robot: i.Robot, Tick: i.Tick, Location: i.Location.ID(), Busy: i.Busy}
+	for _, n := range i.Path {
+		s.Path = append(s.Path, n.ID())
+	}
+	return s
+}
+
+func restoreIntent(s IntentState, g graph.Graph) (Intent, error) {
+	i := Intent{Robot: s.Robot, Tick: s.Tick, Busy: s.Busy}
+	if i.Location = g.Node(s.Location); i.Location == nil {
+		return Intent{}, fmt.Errorf("intent of robot %s from unknown node %d", s.Robot, s.Location)
+	}
+	for _, id := range s.Path {
+		n := g.Node(id)
+		if n == nil {
+			return Intent{}, fmt.Errorf("intent of robot %s through unknown node %d", s.Robot, id)
+		}
+		i.Path = append(i.Path, n)
+	}
+	return i, nil
+}
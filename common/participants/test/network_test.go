@@ -0,0 +1,63 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"maze/common/participants"
+	"maze/common/task"
+	"maze/common/world"
+	"testing"
+
+	"github.com/google/uuid"
+	"gonum.org/v1/gonum/graph"
+)
+
+func TestBroadcastReachesNeighborsInRange(t *testing.T) {
+	w := world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManager())
+	g := w.GetGraph()
+	network := participants.CreateNetwork(g, 2)
+	speaker := network.Join(uuid.New(), g.Node(1))
+	near := network.Join(uuid.New(), g.Node(3))
+	far := network.Join(uuid.New(), g.Node(12))
+
+	speaker.Announce(participants.Intent{Tick: 1, Location: g.Node(1), Path: []graph.Node{g.Node(2)}})
+	heard := near.Observe()
+	if len(heard) != 1 || heard[0].Robot != speaker.ID() {
+		t.Errorf("Expect the robot two edges away to hear the intent, got %+v", heard)
+	}
+	if next, ok := heard[0].Next(); !ok || next.ID() != 2 {
+		t.Errorf("Expect the intent to carry the next node")
+	}
+	if len(far.Observe()) != 0 || len(speaker.Observe()) != 0 {
+		t.Errorf("Expect robots out of range, and the speaker itself, not to hear the intent")
+	}
+
+	near.Forget(2)
+	if len(near.Observe()) != 0 {
+		t.Errorf("Expect old intents to be forgotten")
+	}
+}
+
+func TestIntentRanks(t *testing.T) {
+	low, high := uuid.MustParse("00000000-0000-0000-0000-000000000001"), uuid.MustParse("00000000-0000-0000-0000-000000000002")
+	if !(participants.Intent{Robot: low}).Outranks(high, false) {
+		t.Errorf("Expect the lowest ID to go first")
+	}
+	if (participants.Intent{Robot: low}).Outranks(high, true) {
+		t.Errorf("Expect busy robots to go before idle ones")
+	}
+}
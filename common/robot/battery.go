@@ -0,0 +1,217 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"log"
+	"math"
+	"maze/common"
+	"maze/common/action"
+	"maze/common/methods"
+	"maze/common/trace"
+	"maze/common/world"
+	"sort"
+)
+
+// LowBatteryPolicy decides what a robot does with its task when the battery runs low
+type LowBatteryPolicy int
+
+const (
+	// FinishTask carries out the current task before heading to a charger
+	FinishTask LowBatteryPolicy = iota
+	// AbandonTask releases the current task back to the task manager, unless the robot carries payload, and heads to a charger
+	AbandonTask
+)
+
+// Battery is the energy model of a robot. Consumption is charged per edge moved, per unit of payload per edge moved, and per tick spent on anything else.
+// The robot heads to the nearest charger once Level drops to LowThreshold
+type Battery struct {
+	Capacity     float64
+	Level        float64
+	PerDistance  float64
+	PerLoad      float64
+	PerIdle      float64
+	LowThreshold float64
+	Policy       LowBatteryPolicy
+}
+
+// NewBattery creates a fully charged battery
+func NewBattery(capacity, perDistance, perLoad, perIdle, lowThreshold float64) *Battery {
+	return &Battery{capacity, capacity, perDistance, perLoad, perIdle, lowThreshold, FinishTask}
+}
+
+// Low checks whether the level reached the low threshold
+func (b *Battery) Low() bool {
+	return b.Level <= b.LowThreshold
+}
+
+// Full checks whether the battery is at capacity
+func (b *Battery) Full() bool {
+	return b.Level >= b.Capacity
+}
+
+func (b *Battery) drain(amount float64) {
+	b.Level = math.Max(0, b.Level-amount)
+}
+
+func (b *Battery) charge(amount float64) {
+	b.Level = math.Min(b.Capacity, b.Level+amount)
+}
+
+// BatteryPenalty is the cost added to a bid by a fully drained battery, scaled down linearly with the battery level
+const BatteryPenalty = 5.0
+
+// SetBattery equips the robot with a battery, to be charged on the chargers of the network. A robot without battery never runs out of energy
+func (r *simpleWarehouseRobot) SetBattery(b *Battery, chargers *world.ChargingNetwork) {
+	r.battery = b
+	r.chargers = chargers
+}
+
+// Battery returns the battery of the robot, nil if it has none
+func (r *simpleWarehouseRobot) Battery() *Battery {
+	return r.battery
+}
+
+// batteryPenalty returns the bid penalty for the current battery level, and false when the battery is too low to take a task
+func (r *simpleWarehouseRobot) batteryPenalty() (float64, bool) {
+	if r.battery == nil {
+		return 0, true
+	}
+	if r.battery.Low() {
+		return 0, false
+	}
+	return BatteryPenalty * (1 - r.battery.Level/r.battery.Capacity), true
+}
+
+// planCharge routes the robot to the nearest charger once the battery is low, following the low battery policy for the current task.
+// A charger the robot finds no route to is passed over for the next nearest one
+func (r *simpleWarehouseRobot) planCharge() {
+	if r.battery == nil || r.chargers == nil || r.charging || !r.battery.Low() {
+		return
+	}
+	if r.task != nil {
+		if r.battery.Policy != AbandonTask || r.load > 0 {
+			return
+		}
+		log.Printf("Robot %s abandons %s on low battery", r.id.String()[4:8], r.task.GetTaskID().String()[4:8])
+		r.release()
+		r.act = action.Null()
+	}
+	if r.act.GetType() != common.ActionTypeNull {
+		return
+	}
+	g := r.graph()
+	stations := r.chargers.Stations()
+	distance := make(map[*world.ChargingStation]float64, len(stations))
+	for _, s := range stations {
+		distance[s] = methods.Distance(g, r.location, s.Node)
+	}
+	sort.SliceStable(stations, func(i, j int) bool { return distance[stations[i]] < distance[stations[j]] })
+	// head to the nearest charger the robot finds a route to
+	for _, s := range stations {
+		if math.IsInf(distance[s], 1) {
+			break
+		}
+		charge := action.CreateChargeAction(s.Node)
+		charge.SetChild(action.Null())
+		if r.location.ID() == s.Node.ID() {
+			r.act = charge
+			r.charging = true
+			return
+		}
+		p, err := r.route(g, s.Node)
+		if err != nil {
+			log.Printf("Err %+v, robot %s tries the next charger", err, r.id.String()[4:8])
+			continue
+		}
+		move := action.CreateMoveActionWithPath(r.location, s.Node, p)
+		move.SetChild(charge)
+		r.act = move
+		r.charging = true
+		return
+	}
+	log.Printf("Robot %s finds no route to a charger", r.id.String()[4:8])
+}
+
+// strand stops a robot with a depleted battery where it stands, as a stopped robot does: it hands its tasks back to the task manager,
+// so the fleet carries them out, and blocks its node for the planners of the other robots.
+// What the robot carries is written off, the released tasks start over from their first stop
+func (r *simpleWarehouseRobot) strand() {
+	if r.stranded {
+		return
+	}
+	log.Printf("Robot %s runs out of battery", r.id.String()[4:8])
+	r.stranded = true
+	r.release()
+	r.act = action.Null()
+	r.repositioning = false
+	r.charging = false
+	r.load = 0
+	r.progress = 0
+	if ow, ok := r.World.(common.ObstructedWorld); ok {
+		ow.Block(r.location, r.id)
+	}
+}
+
+// revive puts a stranded robot whose battery got energy again back to work, lifting its blockage
+func (r *simpleWarehouseRobot) revive() {
+	r.stranded = false
+	if ow, ok := r.World.(common.ObstructedWorld); ok {
+		ow.Unblock(r.location, r.id)
+	}
+}
+
+// Stranded checks whether the battery of the robot ran out away from a charger
+func (r *simpleWarehouseRobot) Stranded() bool {
+	return r.stranded
+}
+
+// consumption returns the energy spent executing an action for one tick
+func (r *simpleWarehouseRobot) consumption(t common.ActionType) float64 {
+	switch t {
+	case common.ActionTypeMove:
+		return (r.battery.PerDistance + r.battery.PerLoad*float64(r.load)) * r.speed()
+	case common.ActionTypeCharge:
+		return 0
+	default:
+		return r.battery.PerIdle
+	}
+}
+
+// executeCharge takes a slot on the charger, or waits for one, and charges the battery until full
+func (r *simpleWarehouseRobot) executeCharge() common.Trace {
+	charge := r.act.(*action.ChargeAction)
+	rTrace := &trace.ChargeTrace{RobotID: r.id, Location: r.location, Timestamp: r.tick}
+	if charge.GetStatus() == common.PendingStatus {
+		if !r.chargers.Reserve(r.location, r.id) {
+			rTrace.Event = trace.ChargeQueued
+			rTrace.Level = r.battery.Level
+			return rTrace
+		}
+		charge.SetStatus(common.ActiveStatus)
+	}
+	r.battery.charge(r.chargers.At(r.location).Rate)
+	rTrace.Event = trace.ChargeCharging
+	if r.battery.Full() {
+		r.chargers.Release(r.location, r.id)
+		charge.SetStatus(common.EndStatus)
+		r.act = r.act.GetChild()
+		r.charging = false
+		rTrace.Event = trace.ChargeFull
+	}
+	rTrace.Level = r.battery.Level
+	return rTrace
+}
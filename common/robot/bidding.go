@@ -0,0 +1,59 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"maze/common"
+	"maze/common/methods"
+)
+
+// LoadPenalty is the cost added to a bid for every unit of payload the robot carries
+const LoadPenalty = 1.0
+
+// Bid estimates the cost for the robot to carry out the task after the tasks it already holds.
+// The estimate is the travel distance from where the robot will be free, plus penalties on its current load and its spent battery
+func (r *simpleWarehouseRobot) Bid(t common.Task) (float64, bool) {
+	if r.fault != nil || !r.eligible(t) {
+		return 0, false
+	}
+	penalty, ok := r.batteryPenalty()
+	if !ok {
+		return 0, false
+	}
+	g := r.graph()
+	from := r.location
+	if r.task != nil {
+		from = r.task.GetDestination()
+	}
+	if len(r.queue) > 0 {
+		from = r.queue[len(r.queue)-1].GetDestination()
+	}
+	return methods.TaskDistance(g, from, t) + LoadPenalty*float64(r.load) + penalty, true
+}
+
+// Assign appends an awarded task to the queue of the robot
+func (r *simpleWarehouseRobot) Assign(t common.Task) bool {
+	if r.fault != nil || !r.eligible(t) {
+		return false
+	}
+	r.queue = append(r.queue, t)
+	return true
+}
+
+// SetSelfClaim toggles whether the robot pulls tasks from the world on its own, or only carries out assigned tasks
+func (r *simpleWarehouseRobot) SetSelfClaim(selfClaim bool) {
+	r.selfClaim = selfClaim
+}
@@ -0,0 +1,81 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"maze/common/action"
+	"maze/common/participants"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// YieldPatience is the number of ticks in a row a robot yields to its neighbors before moving on anyway
+const YieldPatience = 3
+
+// announce tells the neighbors where the robot stands and where it goes next
+func (r *simpleWarehouseRobot) announce() {
+	if r.comm == nil || r.offline() {
+		return
+	}
+	intent := participants.Intent{Tick: r.tick, Location: r.location, Busy: r.task != nil}
+	if move, ok := r.act.(*action.MoveAction); ok {
+		intent.Path = append([]graph.Node{}, move.Path...)
+	}
+	r.comm.Announce(intent)
+	r.comm.Forget(r.tick - 1)
+}
+
+// mustYield checks the intents of the neighbors before moving to the next node. The robot gives way to a robot with a higher rank
+// heading to the same node, or leaving the node for somewhere else than where the robot stands
+func (r *simpleWarehouseRobot) mustYield(next graph.Node) bool {
+	if r.comm == nil || r.offline() {
+		return false
+	}
+	if r.yielded >= YieldPatience {
+		r.yielded = 0
+		return false
+	}
+	for _, i := range r.comm.Observe() {
+		if i.Tick < r.tick-1 || !i.Outranks(r.id, r.task != nil) {
+			continue
+		}
+		n, moving := i.Next()
+		if !moving {
+			continue
+		}
+		sameTarget := n.ID() == next.ID()
+		leaving := i.Location.ID() == next.ID() && n.ID() != r.location.ID()
+		if sameTarget || leaving {
+			r.yielded++
+			return true
+		}
+	}
+	r.yielded = 0
+	return false
+}
+
+// SetComm connects the robot to its neighbors
+func (r *simpleWarehouseRobot) SetComm(bot *participants.DummyBot) {
+	r.comm = bot
+}
+
+// Intents returns the latest intents heard from the neighbors
+func (r *simpleWarehouseRobot) Intents() []participants.Intent {
+	if r.comm == nil {
+		return nil
+	}
+	return r.comm.Observe()
+}
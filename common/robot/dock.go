@@ -0,0 +1,87 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"maze/common"
+	"maze/common/action"
+	"maze/common/trace"
+)
+
+// executeWait keeps the robot in place until the wait is over
+func (r *simpleWarehouseRobot) executeWait() common.Trace {
+	wait := r.act.(*action.WaitAction)
+	if wait.Advance(func() int { return wait.Duration(r.tick) }) {
+		r.act = wait.GetChild()
+	}
+	return &trace.WaitTrace{RobotID: r.id, Location: r.location, Remaining: wait.Remaining(), Until: wait.Until, Timestamp: r.tick}
+}
+
+// executeDock takes a slot at the station on the node, or waits for one, and docks in the handling time of the robot type.
+// Nodes without a charging station take any number of docked robots
+func (r *simpleWarehouseRobot) executeDock() common.Trace {
+	dock := r.act.(*action.DockAction)
+	rTrace := &trace.DockTrace{RobotID: r.id, Location: r.location, Timestamp: r.tick}
+	if dock.GetStatus() == common.PendingStatus && r.chargers != nil && r.chargers.At(r.location) != nil {
+		if !r.chargers.Reserve(r.location, r.id) {
+			rTrace.Event = trace.DockQueued
+			return rTrace
+		}
+	}
+	if !dock.Advance(func() int { return action.Ticks(r.typ.Handling.Dock, r.rand) }) {
+		rTrace.Event = trace.Docking
+		rTrace.Remaining = dock.Remaining()
+		return rTrace
+	}
+	r.docked = true
+	r.act = dock.GetChild()
+	rTrace.Event = trace.Docked
+	return rTrace
+}
+
+// undock leaves the station, freeing its slot
+func (r *simpleWarehouseRobot) undock() common.Trace {
+	r.docked = false
+	if r.chargers != nil && !r.charging {
+		r.chargers.Release(r.location, r.id)
+	}
+	return &trace.DockTrace{RobotID: r.id, Location: r.location, Event: trace.Undocked, Timestamp: r.tick}
+}
+
+// chargeDocked tops up the battery of a robot docked at a charging station
+func (r *simpleWarehouseRobot) chargeDocked() {
+	if !r.docked || r.chargers == nil {
+		return
+	}
+	if s := r.chargers.At(r.location); s != nil {
+		r.battery.charge(s.Rate)
+	}
+}
+
+// Docked checks whether the robot sits at a station
+func (r *simpleWarehouseRobot) Docked() bool {
+	return r.docked
+}
+
+// ChargerUser is a robot which may take or free slots of a charging network shared with other robots
+type ChargerUser interface {
+	UsesChargers() bool
+}
+
+// UsesChargers checks whether the robot is on a charging network. Charging, docking and leaving a station all go through it
+func (r *simpleWarehouseRobot) UsesChargers() bool {
+	return r.chargers != nil
+}
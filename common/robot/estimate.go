@@ -0,0 +1,167 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"math"
+	"maze/common"
+	"maze/common/action"
+)
+
+// CongestionDelay is the expected delay, in ticks, of passing a node another robot stands on
+const CongestionDelay = 1.0
+
+// Estimate predicts the time and energy for the robot to carry out its current action chain
+func (r *simpleWarehouseRobot) Estimate() common.Estimate {
+	return r.EstimatePlan(r.act)
+}
+
+// EstimatePlan predicts the time and energy for the robot to carry out an action chain from where it stands.
+// Moves take the length of their edges over the speed of the robot, plus CongestionDelay for every other robot on their way.
+// Other actions take the expected handling times of the robot type, or what is left of them once started
+func (r *simpleWarehouseRobot) EstimatePlan(a common.Action) common.Estimate {
+	var e common.Estimate
+	if r.fault != nil && r.fault.mode == common.FaultStopped {
+		e.Ticks += float64(r.fault.remaining)
+		e.Energy += r.idleEnergy(float64(r.fault.remaining))
+	}
+	speed := r.speed()
+	if speed <= 0 {
+		speed = r.typ.GetSpeed()
+	}
+	congestion := make(map[int64]int)
+	for _, other := range r.World.GetRobots() {
+		if other.ID() != r.id && other.Location() != nil {
+			congestion[other.Location().ID()]++
+		}
+	}
+	g := r.World.GetGraph()
+	load := r.load
+	heading := r.heading
+	docked := r.docked
+	steps := 0
+	for ; a != nil && a.GetType() != common.ActionTypeNull && steps < maxEstimatedSteps; a = a.GetChild() {
+		steps++
+		switch v := a.(type) {
+		case *action.MoveAction:
+			if docked {
+				e.Ticks++
+				e.Energy += r.idleEnergy(1)
+				docked = false
+			}
+			last := r.location
+			if v.Start != nil && v.GetStatus() == common.PendingStatus {
+				last = v.Start
+			}
+			perTick := r.moveEnergy(load) * speed
+			for _, n := range v.Path {
+				if r.layout != nil {
+					if h, ok := r.layout.Heading(last, n); ok {
+						turn := float64(common.Turns(heading, h)) * action.Expected(r.typ.TurnTime)
+						e.Ticks += turn
+						e.Energy += r.idleEnergy(turn)
+						heading = h
+					}
+				}
+				w := edgeWeight(g, last, n)
+				delay := CongestionDelay * float64(congestion[n.ID()])
+				e.Ticks += w/speed + delay
+				e.Energy += r.moveEnergy(load)*w + perTick*delay
+				last = n
+			}
+		case *action.ChargeAction:
+			e.Ticks += r.chargeTicks(v.Here(), e.Energy)
+		case *action.WaitAction:
+			ticks := 1.0
+			if v.GetStatus() == common.ActiveStatus {
+				ticks = float64(v.Remaining())
+			} else if n := v.Duration(r.tick + int(math.Ceil(e.Ticks))); n > 1 {
+				ticks = float64(n)
+			}
+			e.Ticks += ticks
+			e.Energy += r.idleEnergy(ticks)
+		case common.TimedAction:
+			ticks := r.expectedTicks(v)
+			e.Ticks += ticks
+			e.Energy += r.idleEnergy(ticks)
+			switch t := a.(type) {
+			case *action.PickAction:
+				load += t.Payload
+			case *action.DropAction:
+				load -= t.Payload
+			case *action.RotateAction:
+				heading = t.To
+			case *action.DockAction:
+				docked = true
+			}
+		}
+	}
+	return e
+}
+
+// maxEstimatedSteps bounds the actions looked at, so a chain looping on itself still gets an estimate
+const maxEstimatedSteps = 1024
+
+// expectedTicks returns what is left of a started timed action, or the expected handling time of a pending one
+func (r *simpleWarehouseRobot) expectedTicks(a common.TimedAction) float64 {
+	if a.GetStatus() == common.ActiveStatus {
+		return float64(a.Remaining())
+	}
+	h := r.typ.Handling
+	switch v := a.(type) {
+	case *action.BeginTaskAction:
+		return action.Expected(h.Begin)
+	case *action.EndTaskAction:
+		return action.Expected(h.End)
+	case *action.PickAction:
+		return action.Expected(h.Pick)
+	case *action.DropAction:
+		return action.Expected(h.Drop)
+	case *action.DockAction:
+		return action.Expected(h.Dock)
+	case *action.RotateAction:
+		return math.Max(1, float64(common.Turns(v.From, v.To))*action.Expected(r.typ.TurnTime))
+	default:
+		return 1
+	}
+}
+
+// chargeTicks returns the ticks to fill the battery at the charger, once the energy of the actions before is spent
+func (r *simpleWarehouseRobot) chargeTicks(at common.Location, spent float64) float64 {
+	if r.battery == nil || r.chargers == nil || at == nil {
+		return 1
+	}
+	s := r.chargers.At(at)
+	if s == nil || s.Rate <= 0 {
+		return 1
+	}
+	level := math.Max(0, r.battery.Level-spent)
+	return math.Max(1, math.Ceil((r.battery.Capacity-level)/s.Rate))
+}
+
+func (r *simpleWarehouseRobot) moveEnergy(load int) float64 {
+	if r.battery == nil {
+		return 0
+	}
+	return r.battery.PerDistance + r.battery.PerLoad*float64(load)
+}
+
+func (r *simpleWarehouseRobot) idleEnergy(ticks float64) float64 {
+	if r.battery == nil {
+		return 0
+	}
+	return r.battery.PerIdle * ticks
+}
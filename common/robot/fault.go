@@ -0,0 +1,119 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"log"
+	"maze/common"
+	"maze/common/action"
+	"maze/common/trace"
+)
+
+// fault is the failure a robot suffers until it is repaired
+type fault struct {
+	mode      common.FaultMode
+	remaining int
+	factor    float64
+}
+
+// Fail breaks the robot down for the given number of ticks. A stopped robot releases its tasks and blocks its node,
+// a degraded robot moves at factor times its speed, and a robot out of communication can neither claim nor complete tasks
+func (r *simpleWarehouseRobot) Fail(mode common.FaultMode, duration int, factor float64) {
+	if r.fault != nil {
+		r.Repair()
+	}
+	r.fault = &fault{mode, duration, factor}
+	log.Printf("Robot %s breaks down in mode %d for %d ticks", r.id.String()[4:8], mode, duration)
+	if mode != common.FaultStopped {
+		return
+	}
+	r.release()
+	if r.charging {
+		r.chargers.Release(r.location, r.id)
+		r.charging = false
+	}
+	r.act = action.Null()
+	r.repositioning = false
+	// the released tasks start over from their first stop, so what the robot carries is picked up again at its origin
+	// by the next robot. The load of the broken robot is written off rather than handed over
+	r.load = 0
+	r.progress = 0
+	if ow, ok := r.World.(common.ObstructedWorld); ok {
+		ow.Block(r.location, r.id)
+	}
+}
+
+// Repair puts the robot back to work, lifting the blockage of a stopped robot
+func (r *simpleWarehouseRobot) Repair() {
+	if r.fault == nil {
+		return
+	}
+	if ow, ok := r.World.(common.ObstructedWorld); ok && r.fault.mode == common.FaultStopped {
+		ow.Unblock(r.location, r.id)
+	}
+	r.fault = nil
+}
+
+// Fault returns the current failure of the robot, false when it works
+func (r *simpleWarehouseRobot) Fault() (common.FaultMode, bool) {
+	if r.fault == nil {
+		return 0, false
+	}
+	return r.fault.mode, true
+}
+
+// release hands the current and queued tasks back to the task manager
+func (r *simpleWarehouseRobot) release() {
+	tasks := r.queue
+	if r.task != nil {
+		tasks = append([]common.Task{r.task}, tasks...)
+	}
+	for _, t := range tasks {
+		if err := r.World.TaskUpdate(t.GetTaskID(), common.Unassigned); err != nil {
+			log.Printf("Err %+v, move on", err)
+		}
+	}
+	r.task = nil
+	r.queue = nil
+}
+
+// offline checks whether the robot can't reach the task manager
+func (r *simpleWarehouseRobot) offline() bool {
+	return r.fault != nil && r.fault.mode == common.FaultLostComm
+}
+
+// speed returns the edges per tick the robot currently moves, slowed down by a degraded failure
+func (r *simpleWarehouseRobot) speed() float64 {
+	if r.fault != nil && r.fault.mode == common.FaultDegraded {
+		return r.typ.GetSpeed() * r.fault.factor
+	}
+	return r.typ.GetSpeed()
+}
+
+// executeFault counts down the failure of the robot. It returns a trace when the failure keeps the robot from acting this tick
+func (r *simpleWarehouseRobot) executeFault() common.Trace {
+	rTrace := &trace.FaultTrace{RobotID: r.id, Location: r.location, Mode: r.fault.mode, Event: trace.FaultOngoing, Timestamp: r.tick}
+	r.fault.remaining--
+	if r.fault.remaining <= 0 {
+		r.Repair()
+		rTrace.Event = trace.FaultRepaired
+		return rTrace
+	}
+	if r.fault.mode == common.FaultStopped || (r.offline() && r.act.GetType() == common.ActionTypeEndTask) {
+		return rTrace
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"container/heap"
+	"errors"
+	"maze/common"
+	"maze/common/action"
+	"maze/common/methods"
+	"maze/common/trace"
+	"maze/common/world"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// OrientedPlanner is a PathPlanner which accounts for the heading of the robot
+type OrientedPlanner interface {
+	PathPlanner
+	PlanOriented(g graph.Graph, from graph.Node, heading common.Heading, t common.Task) (common.Action, error)
+	RouteOriented(g graph.Graph, from graph.Node, heading common.Heading, to graph.Node) ([]graph.Node, error)
+}
+
+// TurnAware plans over node × heading, so a path with fewer turns wins over a slightly shorter one.
+// TurnCost is the cost of a 45 degree turn, against the weight of the edges
+type TurnAware struct {
+	Layout   world.Layout
+	TurnCost float64
+}
+
+// Plan plans the task for a robot facing nowhere in particular, its first turn is free
+func (p TurnAware) Plan(g graph.Graph, from graph.Node, t common.Task) (common.Action, error) {
+	return p.PlanOriented(g, from, common.NoHeading, t)
+}
+
+func (p TurnAware) Route(g graph.Graph, from, to graph.Node) ([]graph.Node, error) {
+	return p.RouteOriented(g, from, common.NoHeading, to)
+}
+
+// PlanOriented plans the task for a robot facing the heading, every leg starts with the heading the previous one ends with
+func (p TurnAware) PlanOriented(g graph.Graph, from graph.Node, heading common.Heading, t common.Task) (common.Action, error) {
+	return methods.PlanTaskActionWith(from, t, func(a, b common.Location) ([]graph.Node, error) {
+		route, err := p.RouteOriented(g, a, heading, b)
+		if err != nil {
+			return nil, err
+		}
+		heading = p.arrival(a, route, heading)
+		return route, nil
+	})
+}
+
+// arrival returns the heading at the end of the route
+func (p TurnAware) arrival(from graph.Node, route []graph.Node, heading common.Heading) common.Heading {
+	last := from
+	for _, n := range route {
+		if h, ok := p.Layout.Heading(last, n); ok {
+			heading = h
+		}
+		last = n
+	}
+	return heading
+}
+
+// pose is a node of the search, where a robot stands and where it faces
+type pose struct {
+	node    int64
+	heading common.Heading
+}
+
+type poseItem struct {
+	pose pose
+	cost float64
+}
+
+// poseQueue orders poses by cost, then node and heading so the search is stable
+type poseQueue []poseItem
+
+func (q poseQueue) Len() int { return len(q) }
+func (q poseQueue) Less(i, j int) bool {
+	if q[i].cost != q[j].cost {
+		return q[i].cost < q[j].cost
+	}
+	if q[i].pose.node != q[j].pose.node {
+		return q[i].pose.node < q[j].pose.node
+	}
+	return q[i].pose.heading < q[j].pose.heading
+}
+func (q poseQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *poseQueue) Push(x interface{}) { *q = append(*q, x.(poseItem)) }
+func (q *poseQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// RouteOriented runs Dijkstra over poses. Moving costs the weight of the edge, turning costs TurnCost per 45 degrees
+func (p TurnAware) RouteOriented(g graph.Graph, from graph.Node, heading common.Heading, to graph.Node) ([]graph.Node, error) {
+	if from.ID() == to.ID() {
+		return nil, nil
+	}
+	start := pose{from.ID(), heading}
+	cost := map[pose]float64{start: 0}
+	prev := make(map[pose]pose)
+	q := &poseQueue{{start, 0}}
+	for q.Len() > 0 {
+		cur := heap.Pop(q).(poseItem)
+		if cur.cost > cost[cur.pose] {
+			continue
+		}
+		if cur.pose.node == to.ID() {
+			var route []graph.Node
+			for at := cur.pose; at != start; at = prev[at] {
+				route = append([]graph.Node{g.Node(at.node)}, route...)
+			}
+			return route, nil
+		}
+		here := g.Node(cur.pose.node)
+		neighbors := graph.NodesOf(g.From(cur.pose.node))
+		sort.Slice(neighbors, func(i, j int) bool { return neighbors[i].ID() < neighbors[j].ID() })
+		for _, n := range neighbors {
+			h, ok := p.Layout.Heading(here, n)
+			if !ok {
+				h = cur.pose.heading
+			}
+			next := pose{n.ID(), h}
+			c := cur.cost + edgeWeight(g, here, n) + p.TurnCost*float64(common.Turns(cur.pose.heading, h))
+			if old, seen := cost[next]; !seen || c < old {
+				cost[next] = c
+				prev[next] = cur.pose
+				heap.Push(q, poseItem{next, c})
+			}
+		}
+	}
+	return nil, errors.New("no path")
+}
+
+func edgeWeight(g graph.Graph, from, to graph.Node) float64 {
+	if wg, ok := g.(graph.Weighted); ok {
+		if w, ok := wg.Weight(from.ID(), to.ID()); ok {
+			return w
+		}
+	}
+	return 1
+}
+
+// WithLayout lets the robot track where it faces on the layout. It starts facing north, and turns in place before changing direction
+func WithLayout(l world.Layout) Option {
+	return func(r *simpleWarehouseRobot) {
+		r.layout = l
+		r.heading = common.North
+	}
+}
+
+// Heading returns where the robot faces, NoHeading when it doesn't track it
+func (r *simpleWarehouseRobot) Heading() common.Heading {
+	return r.heading
+}
+
+// plan plans the task with the planner of the robot, from its heading when the planner accounts for it
+func (r *simpleWarehouseRobot) plan(g graph.Graph, t common.Task) (common.Action, error) {
+	if op, ok := r.planner.(OrientedPlanner); ok && r.layout != nil {
+		return op.PlanOriented(g, r.location, r.heading, t)
+	}
+	return r.planner.Plan(g, r.location, t)
+}
+
+// route finds the way to the node with the planner of the robot, from its heading when the planner accounts for it
+func (r *simpleWarehouseRobot) route(g graph.Graph, to graph.Node) ([]graph.Node, error) {
+	if op, ok := r.planner.(OrientedPlanner); ok && r.layout != nil {
+		return op.RouteOriented(g, r.location, r.heading, to)
+	}
+	return r.planner.Route(g, r.location, to)
+}
+
+// turnToward puts a rotation in front of the move when the robot doesn't face the next node, and returns whether it did
+func (r *simpleWarehouseRobot) turnToward(move *action.MoveAction, next graph.Node) bool {
+	if r.layout == nil {
+		return false
+	}
+	want, ok := r.layout.Heading(r.location, next)
+	if !ok || want == r.heading {
+		return false
+	}
+	rotate := action.CreateRotateAction(r.location, r.heading, want)
+	rotate.SetChild(move)
+	r.act = rotate
+	return true
+}
+
+// executeRotate turns the robot, each 45 degrees taking the turn time of its type
+func (r *simpleWarehouseRobot) executeRotate() common.Trace {
+	rotate := r.act.(*action.RotateAction)
+	done := rotate.Advance(func() int {
+		ticks := 0
+		for i := 0; i < common.Turns(rotate.From, rotate.To); i++ {
+			ticks += action.Ticks(r.typ.TurnTime, r.rand)
+		}
+		return ticks
+	})
+	if done {
+		r.heading = rotate.To
+		r.act = rotate.GetChild()
+	}
+	return &trace.ActionTrace{
+		RobotID:   r.id,
+		Location:  r.location,
+		Action:    common.ActionTypeRotate,
+		Status:    rotate.GetStatus(),
+		Remaining: rotate.Remaining(),
+		Timestamp: r.tick,
+	}
+}
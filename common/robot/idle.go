@@ -0,0 +1,261 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"math"
+	"maze/common"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/path"
+)
+
+// IdleStrategy picks where a robot without work waits for its next task. Strategies are shared by the robots of a simulation
+type IdleStrategy interface {
+	// Reposition returns the node the robot should head to, false to stay where it is
+	Reposition(r common.Robot, w common.World) (graph.Node, bool)
+}
+
+// claims remembers the node every robot heads to, so robots don't pile up on the same node
+type claims struct {
+	targets map[common.RobotID]int64
+	m       sync.Mutex
+}
+
+// taken returns the nodes other robots stand on or reposition to
+func (c *claims) taken(r common.Robot, w common.World) map[int64]bool {
+	taken := make(map[int64]bool)
+	for _, o := range w.GetRobots() {
+		if o.ID() == r.ID() {
+			continue
+		}
+		taken[o.Location().ID()] = true
+		if rp, ok := o.(common.Repositioner); ok && rp.Repositioning() {
+			if t, ok := c.targets[o.ID()]; ok {
+				taken[t] = true
+			}
+		}
+	}
+	return taken
+}
+
+func (c *claims) claim(r common.Robot, n graph.Node) (graph.Node, bool) {
+	if c.targets == nil {
+		c.targets = make(map[common.RobotID]int64)
+	}
+	c.targets[r.ID()] = n.ID()
+	return n, n.ID() != r.Location().ID()
+}
+
+// graphOf returns the graph the robot moves on, restricted to its zones and edges and routing around blocked nodes,
+// or the world graph for robots without their own
+func graphOf(r common.Robot, w common.World) graph.Graph {
+	if n, ok := r.(Navigator); ok {
+		return n.Graph()
+	}
+	return w.GetGraph()
+}
+
+// sortedNodes returns the nodes of the graph ordered by ID
+func sortedNodes(g graph.Graph) []graph.Node {
+	nodes := graph.NodesOf(g.Nodes())
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID() < nodes[j].ID() })
+	return nodes
+}
+
+// NearestParking sends idle robots to the nearest free parking node
+type NearestParking struct {
+	Nodes []int64
+	claims
+}
+
+func CreateNearestParking(nodes ...int64) *NearestParking {
+	return &NearestParking{Nodes: nodes}
+}
+
+func (p *NearestParking) Reposition(r common.Robot, w common.World) (graph.Node, bool) {
+	p.m.Lock()
+	defer p.m.Unlock()
+	g := w.GetGraph()
+	taken := p.taken(r, w)
+	shortest := path.DijkstraFrom(r.Location(), graphOf(r, w))
+	var best graph.Node
+	bestDist := math.Inf(1)
+	for _, id := range p.Nodes {
+		if id == r.Location().ID() {
+			// already parked
+			return p.claim(r, r.Location())
+		}
+		if taken[id] {
+			continue
+		}
+		if d := shortest.WeightTo(id); d < bestDist {
+			best, bestDist = g.Node(id), d
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return p.claim(r, best)
+}
+
+// DemandHotspots pre-positions idle robots on the nodes where most tasks showed up. Demand decays by Decay for every new task,
+// so recent tasks weigh more
+type DemandHotspots struct {
+	Decay  float64
+	demand map[int64]float64
+	seen   map[common.TaskID]bool
+	claims
+}
+
+func CreateDemandHotspots(decay float64) *DemandHotspots {
+	return &DemandHotspots{Decay: decay, demand: make(map[int64]float64), seen: make(map[common.TaskID]bool)}
+}
+
+// observe accounts for the origins of the tasks not seen yet, in a stable order. Tasks no longer waiting are forgotten,
+// so the seen tasks don't grow over a run
+func (h *DemandHotspots) observe(w common.World) {
+	tasks := w.GetAllTasks()
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].GetTaskID().String() < tasks[j].GetTaskID().String() })
+	waiting := make(map[common.TaskID]bool, len(tasks))
+	for _, t := range tasks {
+		waiting[t.GetTaskID()] = true
+	}
+	for id := range h.seen {
+		if !waiting[id] {
+			delete(h.seen, id)
+		}
+	}
+	for _, t := range tasks {
+		if h.seen[t.GetTaskID()] || t.GetOrigination() == nil {
+			continue
+		}
+		h.seen[t.GetTaskID()] = true
+		for id := range h.demand {
+			h.demand[id] *= h.Decay
+		}
+		h.demand[t.GetOrigination().ID()]++
+	}
+}
+
+// Demand returns the demand predicted on the node
+func (h *DemandHotspots) Demand(n graph.Node) float64 {
+	h.m.Lock()
+	defer h.m.Unlock()
+	return h.demand[n.ID()]
+}
+
+// HotspotState is the serializable demand learned by the hotspots, Seen lists the tasks already accounted for
+type HotspotState struct {
+	Demand map[int64]float64 `json:"demand"`
+	Seen   []common.TaskID   `json:"seen"`
+}
+
+// Snapshot saves the demand learned so far
+func (h *DemandHotspots) Snapshot() HotspotState {
+	h.m.Lock()
+	defer h.m.Unlock()
+	s := HotspotState{Demand: make(map[int64]float64)}
+	for id, d := range h.demand {
+		s.Demand[id] = d
+	}
+	for id := range h.seen {
+		s.Seen = append(s.Seen, id)
+	}
+	sort.Slice(s.Seen, func(i, j int) bool { return s.Seen[i].String() < s.Seen[j].String() })
+	return s
+}
+
+// Restore replaces the demand learned so far with the saved one
+func (h *DemandHotspots) Restore(s HotspotState) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.demand = make(map[int64]float64)
+	for id, d := range s.Demand {
+		h.demand[id] = d
+	}
+	h.seen = make(map[common.TaskID]bool)
+	for _, id := range s.Seen {
+		h.seen[id] = true
+	}
+}
+
+func (h *DemandHotspots) Reposition(r common.Robot, w common.World) (graph.Node, bool) {
+	h.m.Lock()
+	defer h.m.Unlock()
+	h.observe(w)
+	g := w.GetGraph()
+	taken := h.taken(r, w)
+	shortest := path.DijkstraFrom(r.Location(), graphOf(r, w))
+	var best graph.Node
+	bestDemand, bestDist := 0.0, math.Inf(1)
+	for _, n := range sortedNodes(g) {
+		d := h.demand[n.ID()]
+		if d <= 0 || taken[n.ID()] {
+			continue
+		}
+		dist := shortest.WeightTo(n.ID())
+		if math.IsInf(dist, 1) {
+			// the robot can't get there
+			continue
+		}
+		if d > bestDemand || (d == bestDemand && dist < bestDist) {
+			best, bestDemand, bestDist = n, d, dist
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	return h.claim(r, best)
+}
+
+// SpreadOut sends idle robots away from each other, to the node farthest from the other robots, so the fleet covers the world
+type SpreadOut struct {
+	claims
+}
+
+func CreateSpreadOut() *SpreadOut {
+	return &SpreadOut{}
+}
+
+func (s *SpreadOut) Reposition(r common.Robot, w common.World) (graph.Node, bool) {
+	s.m.Lock()
+	defer s.m.Unlock()
+	g := w.GetGraph()
+	taken := s.taken(r, w)
+	if len(taken) == 0 {
+		return nil, false
+	}
+	all := path.DijkstraAllPaths(g)
+	reach := path.DijkstraFrom(r.Location(), graphOf(r, w))
+	// coverage is the distance from a node to the nearest other robot
+	coverage := func(n graph.Node) float64 {
+		c := math.Inf(1)
+		for id := range taken {
+			c = math.Min(c, all.Weight(n.ID(), id))
+		}
+		return c
+	}
+	best, bestCoverage := r.Location(), coverage(r.Location())
+	for _, n := range sortedNodes(g) {
+		if c := coverage(n); c > bestCoverage && !math.IsInf(c, 1) && !math.IsInf(reach.WeightTo(n.ID()), 1) {
+			best, bestCoverage = n, c
+		}
+	}
+	return s.claim(r, best)
+}
@@ -0,0 +1,175 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"errors"
+	"fmt"
+	"maze/common"
+	"maze/common/action"
+	"maze/common/task"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// FaultState is the serializable form of the failure of a robot
+type FaultState struct {
+	Mode      common.FaultMode `json:"mode"`
+	Remaining int              `json:"remaining"`
+	Factor    float64          `json:"factor,omitempty"`
+}
+
+// State is the serializable state of a robot, locations are kept as node IDs. The type, strategies and random stream
+// of the robot are part of the setup of a simulation, they are not saved
+type State struct {
+	ID            common.RobotID    `json:"id"`
+	Location      int64             `json:"location"`
+	Tick          int               `json:"tick"`
+	Plan          action.PlanRecord `json:"plan"`
+	Task          *task.TaskRecord  `json:"task,omitempty"`
+	Queue         []task.TaskRecord `json:"queue,omitempty"`
+	Progress      float64           `json:"progress,omitempty"`
+	Fault         *FaultState       `json:"fault,omitempty"`
+	Repositioning bool              `json:"repositioning,omitempty"`
+	Yielded       int               `json:"yielded,omitempty"`
+	Docked        bool              `json:"docked,omitempty"`
+	Heading       common.Heading    `json:"heading,omitempty"`
+	Load          int               `json:"load,omitempty"`
+	Battery       *float64          `json:"battery,omitempty"`
+	Charging      bool              `json:"charging,omitempty"`
+	// Reserved is set while the robot takes a slot of the charging station it stands on
+	Reserved bool `json:"reserved,omitempty"`
+	Stranded bool `json:"stranded,omitempty"`
+}
+
+// Snapshotter saves and restores the state of a robot. Tasks are restored through the lookup, so the robot shares them
+// with the task manager, and decoded from the state when the lookup doesn't know them
+type Snapshotter interface {
+	common.Robot
+	Snapshot() (State, error)
+	Restore(s State, lookup func(common.TaskID) (common.Task, bool)) error
+}
+
+// Snapshot saves the state of the robot
+func (r *simpleWarehouseRobot) Snapshot() (State, error) {
+	plan, err := action.EncodePlan(r.act)
+	if err != nil {
+		return State{}, err
+	}
+	s := State{
+		ID:            r.id,
+		Location:      r.location.ID(),
+		Tick:          r.tick,
+		Plan:          plan,
+		Progress:      r.progress,
+		Repositioning: r.repositioning,
+		Yielded:       r.yielded,
+		Docked:        r.docked,
+		Heading:       r.heading,
+		Load:          r.load,
+		Charging:      r.charging,
+		Stranded:      r.stranded,
+	}
+	if r.task != nil {
+		t, err := task.EncodeTask(r.task)
+		if err != nil {
+			return State{}, err
+		}
+		s.Task = &t
+	}
+	for _, q := range r.queue {
+		t, err := task.EncodeTask(q)
+		if err != nil {
+			return State{}, err
+		}
+		s.Queue = append(s.Queue, t)
+	}
+	if r.fault != nil {
+		s.Fault = &FaultState{r.fault.mode, r.fault.remaining, r.fault.factor}
+	}
+	if r.battery != nil {
+		level := r.battery.Level
+		s.Battery = &level
+	}
+	s.Reserved = r.chargers != nil && r.chargers.Holds(r.location, r.id)
+	return s, nil
+}
+
+// Restore puts the robot back in a saved state. The robot must be the one the state was saved from, set up the same way
+func (r *simpleWarehouseRobot) Restore(s State, lookup func(common.TaskID) (common.Task, bool)) error {
+	if s.ID != r.id {
+		return fmt.Errorf("state of robot %s can't be restored onto robot %s", s.ID, r.id)
+	}
+	location := r.World.GetGraph().Node(s.Location)
+	if location == nil {
+		return fmt.Errorf("robot %s stands on unknown node %d", r.id, s.Location)
+	}
+	if s.Battery != nil && r.battery == nil {
+		return fmt.Errorf("robot %s has no battery to restore", r.id)
+	}
+	if s.Reserved && r.chargers == nil {
+		return fmt.Errorf("robot %s has no chargers to take a slot of", r.id)
+	}
+	act, err := action.DecodePlan(s.Plan)
+	if err != nil {
+		return err
+	}
+	restore := func(rec task.TaskRecord) (common.Task, error) {
+		if t, ok := lookup(rec.ID); ok {
+			return t, nil
+		}
+		return task.DecodeTask(rec)
+	}
+	var current common.Task
+	if s.Task != nil {
+		if current, err = restore(*s.Task); err != nil {
+			return err
+		}
+	}
+	var queue []common.Task
+	for _, rec := range s.Queue {
+		t, err := restore(rec)
+		if err != nil {
+			return err
+		}
+		queue = append(queue, t)
+	}
+	r.location, r.tick, r.act, r.task, r.queue = location, s.Tick, act, current, queue
+	r.progress, r.repositioning, r.yielded, r.docked = s.Progress, s.Repositioning, s.Yielded, s.Docked
+	r.heading, r.load, r.charging, r.stranded = s.Heading, s.Load, s.Charging, s.Stranded
+	r.fault = nil
+	if s.Fault != nil {
+		r.fault = &fault{s.Fault.Mode, s.Fault.Remaining, s.Fault.Factor}
+	}
+	if s.Battery != nil {
+		r.battery.Level = *s.Battery
+	}
+	if s.Reserved && !r.chargers.Reserve(r.location, r.id) {
+		return errors.New("no slot left on the charging station of robot " + r.id.String())
+	}
+	// the idle strategy keeps robots from heading to the node another robot repositions to
+	if c, ok := r.idle.(claimer); ok && r.repositioning {
+		if move, ok := r.act.(*action.MoveAction); ok {
+			c.claim(r, move.End)
+		}
+	}
+	return nil
+}
+
+// claimer is an idle strategy remembering where robots reposition to
+type claimer interface {
+	claim(r common.Robot, n graph.Node) (graph.Node, bool)
+}
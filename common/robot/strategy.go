@@ -0,0 +1,163 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"math"
+	"maze/common"
+	"maze/common/methods"
+	"maze/common/participants"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// TaskSelector picks the task a robot claims among the available ones
+type TaskSelector interface {
+	// Select returns the task the robot should claim, nil when none suits it. Eligible tells the tasks the robot is able to carry out
+	Select(r common.Robot, w common.World, eligible func(common.Task) bool) common.Task
+}
+
+// PathPlanner turns tasks and destinations into actions on the graph the robot may use. Custom planners may add waits and docks
+// to the moves and task actions of the default one
+type PathPlanner interface {
+	// Plan returns the chain of actions carrying out the task from the location, an error when the robot can't reach the task
+	Plan(g graph.Graph, from graph.Node, t common.Task) (common.Action, error)
+	// Route returns the nodes leading from one node to the other, without the starting node
+	Route(g graph.Graph, from, to graph.Node) ([]graph.Node, error)
+}
+
+// Actuator is the robot as seen by its executor
+type Actuator interface {
+	common.Robot
+	Action() common.Action
+	SetAction(a common.Action)
+	// Step carries out the current action for a tick, the built-in way
+	Step() common.Trace
+}
+
+// Executor carries out the current action of a robot for a tick. Custom executors can handle some actions themselves
+// and leave the others to Step
+type Executor interface {
+	Execute(a Actuator) common.Trace
+}
+
+// FirstAvailable is the default selector, it takes the next task of the task manager, or the first one the robot is able to carry out
+type FirstAvailable struct{}
+
+func (FirstAvailable) Select(r common.Robot, w common.World, eligible func(common.Task) bool) common.Task {
+	if t := w.GetNextTask(); t != nil && eligible(t) {
+		return t
+	}
+	for _, t := range w.GetAllTasks() {
+		if eligible(t) {
+			return t
+		}
+	}
+	return nil
+}
+
+// NearestTask selects the task whose origin is the closest to the robot, ties broken by task ID
+type NearestTask struct{}
+
+func (NearestTask) Select(r common.Robot, w common.World, eligible func(common.Task) bool) common.Task {
+	tasks := w.GetAllTasks()
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].GetTaskID().String() < tasks[j].GetTaskID().String() })
+	var nearest common.Task
+	best := math.Inf(1)
+	for _, t := range tasks {
+		if !eligible(t) {
+			continue
+		}
+		if d := methods.Distance(w.GetGraph(), r.Location(), t.GetOrigination()); d < best {
+			nearest, best = t, d
+		}
+	}
+	return nearest
+}
+
+// ShortestPath is the default planner, it moves along shortest paths
+type ShortestPath struct{}
+
+func (ShortestPath) Plan(g graph.Graph, from graph.Node, t common.Task) (common.Action, error) {
+	return methods.PlanTaskAction(g, from, t)
+}
+
+func (ShortestPath) Route(g graph.Graph, from, to graph.Node) ([]graph.Node, error) {
+	return methods.GetPath(from, to, g)
+}
+
+// StepExecutor is the default executor, it carries out every action the built-in way
+type StepExecutor struct{}
+
+func (StepExecutor) Execute(a Actuator) common.Trace {
+	return a.Step()
+}
+
+// Option customizes a robot at creation
+type Option func(r *simpleWarehouseRobot)
+
+// WithTaskSelector sets how the robot picks its tasks
+func WithTaskSelector(s TaskSelector) Option {
+	return func(r *simpleWarehouseRobot) {
+		r.selector = s
+	}
+}
+
+// WithPathPlanner sets how the robot plans its moves
+func WithPathPlanner(p PathPlanner) Option {
+	return func(r *simpleWarehouseRobot) {
+		r.planner = p
+	}
+}
+
+// WithClock makes the robot read its tick from a simulation clock, instead of counting its own runs
+func WithClock(clock func() int) Option {
+	return func(r *simpleWarehouseRobot) {
+		r.clock = clock
+	}
+}
+
+// WithExecutor sets how the robot carries out its actions
+func WithExecutor(e Executor) Option {
+	return func(r *simpleWarehouseRobot) {
+		r.executor = e
+	}
+}
+
+// WithIdleStrategy sets where the robot waits while it has no work
+func WithIdleStrategy(idle IdleStrategy) Option {
+	return func(r *simpleWarehouseRobot) {
+		r.idle = idle
+	}
+}
+
+// WithComm lets the robot tell its intents to its neighbors and yield to theirs
+func WithComm(bot *participants.DummyBot) Option {
+	return func(r *simpleWarehouseRobot) {
+		r.comm = bot
+	}
+}
+
+// Action returns the current action of the robot
+func (r *simpleWarehouseRobot) Action() common.Action {
+	return r.act
+}
+
+// SetAction replaces the current action of the robot
+func (r *simpleWarehouseRobot) SetAction(a common.Action) {
+	r.act = a
+}
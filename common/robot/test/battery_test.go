@@ -0,0 +1,165 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"errors"
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"maze/common/world"
+	"testing"
+
+	"github.com/google/uuid"
+	"gonum.org/v1/gonum/graph"
+)
+
+func TestRobotChargesAfterTask(t *testing.T) {
+	setup()
+	chargers := world.CreateChargingNetwork()
+	chargers.AddStation(w.GetGraph().Node(3), 1, 2)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	r.SetBattery(robot.NewBattery(4, 1, 0, 0, 1), chargers)
+	// 3 edges from 1 to 4 leave the battery low, with just enough energy to reach the charger on 3
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(4)))
+
+	var events []trace.ChargeEvent
+	for i := 0; i < 10; i++ {
+		if c, ok := r.Run().(*trace.ChargeTrace); ok {
+			events = append(events, c.Event)
+		}
+	}
+	if stm.FinishedCount() != 1 {
+		t.Errorf("Robot should finish its task before charging")
+	}
+	if len(events) == 0 || events[len(events)-1] != trace.ChargeFull || r.Battery().Level != 4 {
+		t.Errorf("Robot should go charging and leave with a full battery, events %+v, level %f", events, r.Battery().Level)
+	}
+	if r.Location() != w.GetGraph().Node(3) {
+		t.Errorf("Robot should have charged at node 3, actual %+v", r.Location())
+	}
+}
+
+func TestRobotAbandonsTaskOnLowBattery(t *testing.T) {
+	setup()
+	chargers := world.CreateChargingNetwork()
+	chargers.AddStation(w.GetGraph().Node(1), 1, 1)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	b := robot.NewBattery(10, 1, 0, 0, 2)
+	b.Policy = robot.AbandonTask
+	r.SetBattery(b, chargers)
+	addT4()
+	r.Run()
+	if stm.HasTasks() {
+		t.Fatalf("Robot should have claimed the task")
+	}
+	b.Level = 2
+	r.Run()
+	if !stm.HasTasks() {
+		t.Errorf("Task should be released back on low battery")
+	}
+	if _, task := r.GetStatus(); task != nil {
+		t.Errorf("Robot should drop its task, actual %+v", task)
+	}
+}
+
+func TestChargerSlotsAreLimited(t *testing.T) {
+	setup()
+	chargers := world.CreateChargingNetwork()
+	chargers.AddStation(w.GetGraph().Node(1), 1, 1)
+	var queued, charging int
+	for _, i := range robots {
+		i.(interface {
+			SetBattery(*robot.Battery, *world.ChargingNetwork)
+		}).SetBattery(robot.NewBattery(10, 1, 0, 0, 5), chargers)
+		i.(interface{ Battery() *robot.Battery }).Battery().Level = 1
+	}
+	for _, i := range robots {
+		switch i.Run().(*trace.ChargeTrace).Event {
+		case trace.ChargeQueued:
+			queued++
+		case trace.ChargeCharging:
+			charging++
+		}
+	}
+	if queued != 1 || charging != 1 || chargers.Occupied(w.GetGraph().Node(1)) != 1 {
+		t.Errorf("Expect 1 robot charging and 1 queued on a single slot, actual %d and %d", charging, queued)
+	}
+}
+
+// unreachable is a planner finding no route to one node
+type unreachable struct {
+	robot.ShortestPath
+	node int64
+}
+
+func (u unreachable) Route(g graph.Graph, from, to graph.Node) ([]graph.Node, error) {
+	if to.ID() == u.node {
+		return nil, errors.New("no route")
+	}
+	return u.ShortestPath.Route(g, from, to)
+}
+
+func TestRobotPassesOverUnreachableCharger(t *testing.T) {
+	setup()
+	chargers := world.CreateChargingNetwork()
+	chargers.AddStation(w.GetGraph().Node(2), 1, 1)
+	chargers.AddStation(w.GetGraph().Node(4), 1, 1)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w, robot.WithPathPlanner(unreachable{node: 2}))
+	b := robot.NewBattery(10, 1, 0, 0, 5)
+	b.Level = 5
+	r.SetBattery(b, chargers)
+	for i := 0; i < 3; i++ {
+		r.Run()
+	}
+	if r.Location() != w.GetGraph().Node(4) {
+		t.Errorf("Robot should head to the charger on 4 when it finds no route to 2, actual %+v", r.Location())
+	}
+}
+
+func TestDepletedRobotReleasesTask(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	b := robot.NewBattery(10, 1, 0, 0, 0)
+	b.Level = 1
+	r.SetBattery(b, nil)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(4)))
+	var last common.Trace
+	for i := 0; i < 5; i++ {
+		last = r.Run()
+	}
+	if c, ok := last.(*trace.ChargeTrace); !ok || c.Event != trace.ChargeDepleted {
+		t.Fatalf("Robot should run out of battery on the way, got %+v", last)
+	}
+	if _, tk := r.GetStatus(); tk != nil || stm.ActiveCount() != 0 || !stm.HasTasks() {
+		t.Errorf("Robot with a depleted battery should release its task")
+	}
+	ow := w.(common.ObstructedWorld)
+	if !r.Stranded() || !ow.IsBlocked(r.Location()) {
+		t.Errorf("Robot with a depleted battery should be stranded, blocking its node")
+	}
+	r.Run()
+	if _, tk := r.GetStatus(); tk != nil || !stm.HasTasks() {
+		t.Errorf("Stranded robot should not claim the task again")
+	}
+
+	b.Level = 5
+	r.Run()
+	if r.Stranded() || ow.IsBlocked(r.Location()) {
+		t.Errorf("Robot whose battery has energy again should lift its blockage")
+	}
+}
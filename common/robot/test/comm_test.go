@@ -0,0 +1,69 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common/participants"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"testing"
+
+	"github.com/google/uuid"
+	"gonum.org/v1/gonum/graph"
+)
+
+func TestRobotYieldsToHigherRankedIntent(t *testing.T) {
+	setup()
+	g := w.GetGraph()
+	network := participants.CreateNetwork(g, 3)
+	peer := network.Join(uuid.MustParse("00000000-0000-0000-0000-000000000001"), g.Node(5))
+	id := uuid.MustParse("ffffffff-0000-0000-0000-000000000000")
+	r := robot.NewSimpleWarehouseRobot(id, g.Node(1), w, robot.WithComm(network.Join(id, g.Node(1))))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(g.Node(2), g.Node(3)))
+
+	// the peer heads to 2 as well, and goes first
+	peer.Announce(participants.Intent{Tick: 0, Location: g.Node(5), Path: []graph.Node{g.Node(2)}, Busy: true})
+	if m := r.Run().(*trace.MoveTrace); m.Target.ID() != 1 {
+		t.Errorf("Expect the robot to give way, got %+v", m)
+	}
+	if intents := r.Intents(); len(intents) != 1 {
+		t.Errorf("Expect the robot to know the intent of its neighbor, got %+v", intents)
+	}
+	// the peer went quiet, its intent is outdated
+	if m := r.Run().(*trace.MoveTrace); m.Target.ID() != 2 {
+		t.Errorf("Expect the robot to move on, got %+v", m)
+	}
+}
+
+func TestRobotYieldsWithLimitedPatience(t *testing.T) {
+	setup()
+	g := w.GetGraph()
+	network := participants.CreateNetwork(g, 3)
+	peer := network.Join(uuid.MustParse("00000000-0000-0000-0000-000000000001"), g.Node(5))
+	id := uuid.MustParse("ffffffff-0000-0000-0000-000000000000")
+	r := robot.NewSimpleWarehouseRobot(id, g.Node(1), w, robot.WithComm(network.Join(id, g.Node(1))))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(g.Node(2), g.Node(3)))
+
+	var m *trace.MoveTrace
+	for tick := 0; tick <= robot.YieldPatience; tick++ {
+		peer.Announce(participants.Intent{Tick: tick, Location: g.Node(5), Path: []graph.Node{g.Node(2)}, Busy: true})
+		m = r.Run().(*trace.MoveTrace)
+	}
+	if m.Target.ID() != 2 {
+		t.Errorf("Expect the robot to stop yielding after %d ticks, got %+v", robot.YieldPatience, m)
+	}
+}
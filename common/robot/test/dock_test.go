@@ -0,0 +1,101 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/action"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"maze/common/world"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestWaitKeepsRobotInPlace(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	wait := action.CreateWaitUntilAction(w.GetGraph().Node(1), 4)
+	wait.SetChild(action.Null())
+	r.SetAction(wait)
+	for tick := 1; tick <= 3; tick++ {
+		if wt, ok := r.Run().(*trace.WaitTrace); !ok || wt.Until != 4 || wt.Remaining != 3-tick {
+			t.Fatalf("Expect the robot to wait on tick %d, got %+v", tick, wt)
+		}
+	}
+	if _, ok := r.Run().(trace.TaskNullActionTrace); !ok || r.Location().ID() != 1 {
+		t.Errorf("Expect the wait to be over on tick 4")
+	}
+}
+
+func TestDockTakesStationSlot(t *testing.T) {
+	setup()
+	chargers := world.CreateChargingNetwork()
+	chargers.AddStation(w.GetGraph().Node(1), 1, 1)
+	typ := &robot.Type{Name: "docking", Speed: 1, Capacity: 1, Handling: robot.HandlingTimes{Dock: action.Fixed(2)}}
+	first := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, typ, nil)
+	second := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, typ, nil)
+	for _, r := range []interface {
+		SetBattery(*robot.Battery, *world.ChargingNetwork)
+		SetAction(common.Action)
+	}{first, second} {
+		r.SetBattery(robot.NewBattery(100, 0, 0, 0, 0), chargers)
+		dock := action.CreateDockAction(w.GetGraph().Node(1))
+		dock.SetChild(action.Null())
+		r.SetAction(dock)
+	}
+
+	events := func(r common.Robot) trace.DockEvent {
+		d, ok := r.Run().(*trace.DockTrace)
+		if !ok {
+			t.Fatalf("Expect a dock trace")
+		}
+		return d.Event
+	}
+	if events(first) != trace.Docking || events(first) != trace.Docked || !first.Docked() {
+		t.Fatalf("Expect the first robot to dock in two ticks")
+	}
+	if events(second) != trace.DockQueued || chargers.Occupied(w.GetGraph().Node(1)) != 1 {
+		t.Fatalf("Expect the second robot to wait for the slot")
+	}
+
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+	if events(first) != trace.Undocked || first.Docked() || chargers.Occupied(w.GetGraph().Node(1)) != 0 {
+		t.Errorf("Expect the first robot to leave the station before taking the task")
+	}
+	if events(second) != trace.Docking {
+		t.Errorf("Expect the second robot to take the free slot")
+	}
+}
+
+func TestPickSpecificItem(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	w.AddTask(task.NewMultiStopTask(
+		common.TaskStop{Location: w.GetGraph().Node(1), Type: common.PickupStop, Payload: 1, Item: "sku-42"},
+		common.TaskStop{Location: w.GetGraph().Node(2), Type: common.DropStop, Payload: 1}))
+	for i := 0; i < 5; i++ {
+		if p, ok := r.Run().(*trace.PayloadTrace); ok && p.Payload > 0 {
+			if p.Item != "sku-42" {
+				t.Errorf("Expect the pick to record the item, got %+v", p)
+			}
+			return
+		}
+	}
+	t.Errorf("Expect the robot to pick the item")
+}
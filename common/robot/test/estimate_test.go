@@ -0,0 +1,64 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"maze/common/world"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestEstimateMatchesExecution(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	r.SetBattery(robot.NewBattery(100, 1, 0, 0.5, 0), world.CreateChargingNetwork())
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+	r.Run()
+
+	e := r.Estimate()
+	if e.Ticks != 3 || e.Energy != 2 {
+		t.Fatalf("Expect a begin, a move and an end left for 3 ticks and 2 energy, got %+v", e)
+	}
+	for tick := 1; tick <= 3; tick++ {
+		if done, ok := r.Run().(trace.TaskExecutionTrace); ok && done.Status == 2 {
+			if tick != 3 {
+				t.Errorf("Expect the task to complete on the third tick, completed on tick %d", tick)
+			}
+			return
+		}
+	}
+	t.Errorf("Expect the task to complete as estimated")
+}
+
+func TestEstimateAccountsForCongestion(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+	r.Run()
+	free := r.Estimate().Ticks
+	w.AddRobot(robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(3), w))
+	if congested := r.Estimate().Ticks; congested != free+robot.CongestionDelay {
+		t.Errorf("Expect a robot on the way to delay the estimate, %v against %v", congested, free)
+	}
+	if r.EstimatePlan(nil) != (common.Estimate{}) {
+		t.Errorf("Expect an empty plan to take no time")
+	}
+}
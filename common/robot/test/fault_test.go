@@ -0,0 +1,115 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestStoppedRobotReleasesTaskAndBlocksNode(t *testing.T) {
+	setup()
+	broken := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(2), w)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+	broken.Run()
+	if stm.ActiveCount() != 1 {
+		t.Fatalf("Robot should have claimed the task")
+	}
+
+	broken.Fail(common.FaultStopped, 3, 0)
+	if _, tk := broken.GetStatus(); tk != nil || stm.ActiveCount() != 0 || !w.HasTasks() {
+		t.Errorf("Stopped robot should release its task")
+	}
+	if !w.(common.ObstructedWorld).IsBlocked(w.GetGraph().Node(2)) {
+		t.Errorf("Stopped robot should block its node")
+	}
+
+	// the only short way from 1 to 3 goes through 2, the other robot has to go around and leaves the released task alone
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(3)))
+	other := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	other.Run() // claim and start at 1
+	m, ok := other.Run().(*trace.MoveTrace)
+	if !ok || m.Target.ID() == 2 {
+		t.Errorf("Robot should route around the blocked node, got %+v", m)
+	}
+
+	var last common.Trace
+	for i := 0; i < 3; i++ {
+		last = broken.Run()
+	}
+	if f, ok := last.(*trace.FaultTrace); !ok || f.Event != trace.FaultRepaired {
+		t.Errorf("Robot should be repaired after the duration, got %+v", last)
+	}
+	if w.(common.ObstructedWorld).IsBlocked(w.GetGraph().Node(2)) {
+		t.Errorf("Repaired robot should unblock its node")
+	}
+}
+
+func TestDegradedRobotSlowsDown(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(4)))
+	r.Fail(common.FaultDegraded, 10, 0.5)
+
+	first := r.Run().(*trace.MoveTrace)
+	second := r.Run().(*trace.MoveTrace)
+	if first.Target.ID() != 1 || second.Target.ID() != 2 {
+		t.Errorf("Degraded robot should move at half speed, got %+v then %+v", first.Target, second.Target)
+	}
+}
+
+func TestRobotOutOfCommunicationHoldsCompletion(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(2)))
+	r.Run() // claim and start
+	r.Fail(common.FaultLostComm, 4, 0)
+	for i := 0; i < 3; i++ {
+		r.Run()
+	}
+	if stm.FinishedCount() != 0 {
+		t.Errorf("Robot out of communication should not report completion")
+	}
+	r.Run()
+	r.Run()
+	if stm.FinishedCount() != 1 {
+		t.Errorf("Robot should report completion once communication is back")
+	}
+}
+
+func TestStoppedRobotReleasesQueuedTasks(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	queued := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(4))
+	w.AddTask(queued)
+	if ok, err := w.ClaimTask(queued.GetTaskID(), r.ID()); !ok {
+		t.Fatal(err)
+	}
+	if !r.Assign(queued) {
+		t.Fatalf("Idle robot should accept the award")
+	}
+
+	// the robot breaks down before it starts the queued task
+	r.Fail(common.FaultStopped, 3, 0)
+	if stm.ActiveCount() != 0 || !w.HasTasks() {
+		t.Errorf("Stopped robot should release the tasks in its queue")
+	}
+}
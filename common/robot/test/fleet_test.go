@@ -0,0 +1,112 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestTypeRegistry(t *testing.T) {
+	reg := robot.CreateTypeRegistry()
+	if err := reg.Register(&robot.Type{Name: "lifter", Speed: 1, Capacity: 2}); err != nil {
+		t.Errorf("Expect the type to register, got %v", err)
+	}
+	if err := reg.Register(&robot.Type{Name: "lifter"}); err == nil {
+		t.Errorf("Expect duplicate type names to be rejected")
+	}
+	if err := reg.Register(&robot.Type{}); err == nil {
+		t.Errorf("Expect types without a name to be rejected")
+	}
+	if typ, ok := reg.Get("lifter"); !ok || typ.Capacity != 2 {
+		t.Errorf("Expect to find the registered type, got %+v", typ)
+	}
+}
+
+func TestOnlyCapableRobotClaimsTask(t *testing.T) {
+	setup()
+	lifter := &robot.Type{Name: "lifter", Speed: 1, Capacity: 1, Capabilities: []common.Capability{"lift"}}
+	plain := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	capable := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, lifter, nil)
+	mt := task.NewMultiStopTask(
+		common.TaskStop{Location: w.GetGraph().Node(1), Type: common.PickupStop, Payload: 1},
+		common.TaskStop{Location: w.GetGraph().Node(2), Type: common.DropStop, Payload: 1},
+	)
+	mt.Requires = []common.Capability{"lift"}
+	w.AddTask(mt)
+
+	plain.Run()
+	if _, tk := plain.GetStatus(); tk != nil {
+		t.Errorf("Robot without the capability should not claim the task")
+	}
+	capable.Run()
+	if _, tk := capable.GetStatus(); tk == nil || tk.GetTaskID() != mt.GetTaskID() {
+		t.Errorf("Robot with the capability should claim the task")
+	}
+	if capable.Type().GetName() != "lifter" || len(capable.Capabilities()) != 1 {
+		t.Errorf("Robot should expose its type and capabilities")
+	}
+}
+
+func TestFastRobotMovesSeveralEdges(t *testing.T) {
+	setup()
+	fast := &robot.Type{Name: "fast", Speed: 2, Capacity: 1}
+	r := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, fast, nil)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(4)))
+
+	// 1 -> 2 -> 3 in a single tick
+	m, ok := r.Run().(*trace.MoveTrace)
+	if !ok || m.Source.ID() != 1 || m.Target.ID() != 3 {
+		t.Errorf("Fast robot should move two edges per tick, got %+v", m)
+	}
+}
+
+func TestSlowRobotWaitsBetweenEdges(t *testing.T) {
+	setup()
+	slow := &robot.Type{Name: "slow", Speed: 0.5, Capacity: 1}
+	r := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, slow, nil)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+
+	first := r.Run().(*trace.MoveTrace)
+	second := r.Run().(*trace.MoveTrace)
+	if first.Target.ID() != 1 || second.Target.ID() != 2 {
+		t.Errorf("Slow robot should take two ticks per edge, got %+v then %+v", first.Target, second.Target)
+	}
+}
+
+func TestZoneRestrictsTasks(t *testing.T) {
+	setup()
+	zoned := &robot.Type{Name: "zoned", Speed: 1, Capacity: 1, Zones: []robot.Zone{{Name: "dock", Nodes: []int64{1, 2, 5, 6}}}}
+	r := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, zoned, nil)
+	outside := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(4))
+	w.AddTask(outside)
+
+	r.Run()
+	if _, tk := r.GetStatus(); tk != nil {
+		t.Errorf("Robot should not claim a task outside its zone")
+	}
+	inside := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(5), w.GetGraph().Node(6))
+	w.AddTask(inside)
+	r.Run()
+	if _, tk := r.GetStatus(); tk == nil || tk.GetTaskID() != inside.GetTaskID() {
+		t.Errorf("Robot should claim the task inside its zone")
+	}
+}
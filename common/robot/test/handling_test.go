@@ -0,0 +1,72 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"math/rand"
+	"maze/common"
+	"maze/common/action"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHandlingTakesSeveralTicks(t *testing.T) {
+	setup()
+	slowHands := &robot.Type{Name: "careful", Speed: 1, Capacity: 1, Handling: robot.HandlingTimes{Begin: action.Fixed(3)}}
+	r := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, slowHands, nil)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(2)))
+
+	for remaining := 2; remaining > 0; remaining-- {
+		a, ok := r.Run().(*trace.ActionTrace)
+		if !ok || a.Action != common.ActionTypeStartTask || a.Status != common.ActiveStatus || a.Remaining != remaining {
+			t.Fatalf("Expect the task to be beginning with %d ticks left, got %+v", remaining, a)
+		}
+	}
+	if e, ok := r.Run().(trace.TaskExecutionTrace); !ok || e.Status != 1 {
+		t.Errorf("Expect the task to begin on the third tick, got %+v", e)
+	}
+}
+
+func TestSampledDurations(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	d := action.Uniform{Min: 2, Max: 4}
+	for i := 0; i < 100; i++ {
+		if n := action.Ticks(d, rnd); n < 2 || n > 4 {
+			t.Fatalf("Sampled duration %d out of bounds", n)
+		}
+	}
+	if action.Ticks(nil, rnd) != 1 || action.Ticks(action.Normal{Mean: -5}, rnd) != 1 {
+		t.Errorf("Expect actions to take at least one tick")
+	}
+}
+
+func TestTimerTransitions(t *testing.T) {
+	setup()
+	pick := action.CreatePickAction(w.GetGraph().Node(1), 1)
+	if pick.GetStatus() != common.PendingStatus {
+		t.Errorf("Expect new actions to be pending")
+	}
+	if pick.Advance(func() int { return 2 }) || pick.GetStatus() != common.ActiveStatus {
+		t.Errorf("Expect the action to be active after its first tick")
+	}
+	if !pick.Advance(func() int { return 2 }) || pick.GetStatus() != common.EndStatus {
+		t.Errorf("Expect the action to end after its second tick")
+	}
+}
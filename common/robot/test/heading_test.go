@@ -0,0 +1,101 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"maze/common/world"
+	"testing"
+
+	"github.com/google/uuid"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+func TestLayoutHeadings(t *testing.T) {
+	setup()
+	l := world.WarehouseLayout()
+	g := w.GetGraph()
+	cases := []struct {
+		from, to int64
+		want     common.Heading
+	}{{1, 2, common.South}, {2, 1, common.North}, {1, 5, common.East}, {5, 1, common.West}, {1, 6, common.SouthEast}, {6, 1, common.NorthWest}}
+	for _, c := range cases {
+		if h, ok := l.Heading(g.Node(c.from), g.Node(c.to)); !ok || h != c.want {
+			t.Errorf("Expect heading %d from %d to %d, got %d", c.want, c.from, c.to, h)
+		}
+	}
+	if common.Turns(common.North, common.South) != 4 || common.Turns(common.NorthWest, common.NorthEast) != 2 || common.Turns(common.NoHeading, common.East) != 0 {
+		t.Errorf("Expect turns to count the smallest number of 45 degree steps")
+	}
+}
+
+func TestRobotTurnsBeforeMoving(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w, robot.WithLayout(world.WarehouseLayout()))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+
+	rotations := 0
+	for i := 0; i < 10; i++ {
+		switch tr := r.Run().(type) {
+		case *trace.ActionTrace:
+			if tr.Action == common.ActionTypeRotate {
+				rotations++
+			}
+		case *trace.MoveTrace:
+			if rotations != 4 {
+				t.Errorf("Expect a half turn to take 4 ticks before moving, took %d", rotations)
+			}
+			if tr.Heading != common.South || tr.Target.ID() != 2 {
+				t.Errorf("Expect the robot to face south on node 2, got %+v", tr)
+			}
+			return
+		}
+	}
+	t.Errorf("Expect the robot to move after turning")
+}
+
+func TestTurnAwarePrefersFewerTurns(t *testing.T) {
+	// 1 - 2 - 3
+	// |   |   |
+	// 4 - 5 - 6
+	g := simple.NewWeightedUndirectedGraph(0, 0)
+	l := world.Layout{}
+	for i := int64(1); i <= 6; i++ {
+		g.AddNode(simple.Node(i))
+		l[i] = world.Point{X: int((i - 1) % 3), Y: int((i - 1) / 3)}
+	}
+	for _, e := range [][2]int64{{1, 2}, {2, 3}, {4, 5}, {5, 6}, {1, 4}, {2, 5}, {3, 6}} {
+		g.SetWeightedEdge(g.NewWeightedEdge(g.Node(e[0]), g.Node(e[1]), 1))
+	}
+	p := robot.TurnAware{Layout: l, TurnCost: 1}
+	route, err := p.RouteOriented(g, g.Node(1), common.East, g.Node(6))
+	if err != nil || len(route) != 3 || route[0].ID() != 2 || route[1].ID() != 3 {
+		t.Errorf("Expect the robot facing east to go along the top row, got %v", route)
+	}
+	route, err = p.RouteOriented(g, g.Node(1), common.South, g.Node(6))
+	if err != nil || len(route) != 3 || route[0].ID() != 4 || route[1].ID() != 5 {
+		t.Errorf("Expect the robot facing south to go along the bottom row, got %v", route)
+	}
+	if _, err := p.RouteOriented(g, g.Node(1), common.North, simple.Node(7)); err == nil {
+		t.Errorf("Expect no route to a node outside the graph")
+	}
+	if _, err := p.Plan(g, g.Node(1), task.NewTimePriorityTaskWithParameter(g.Node(2), simple.Node(7))); err == nil {
+		t.Errorf("Expect no plan for a task leaving the graph")
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestIdleRobotsParkOnFreeNodes(t *testing.T) {
+	setup()
+	parking := robot.CreateNearestParking(4, 9)
+	first := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	second := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	first.SetIdleStrategy(parking)
+	second.SetIdleStrategy(parking)
+	w.AddRobot(first)
+	w.AddRobot(second)
+
+	// 9 is two edges away and 4 three, the second robot leaves 9 to the first one
+	if m, ok := first.Run().(*trace.MoveTrace); !ok || m.Target.ID() != 5 || !first.Repositioning() {
+		t.Errorf("Expect the first robot to head to parking 9, got %+v", m)
+	}
+	if m, ok := second.Run().(*trace.MoveTrace); !ok || m.Target.ID() != 2 {
+		t.Errorf("Expect the second robot to head to parking 4, got %+v", m)
+	}
+	for i := 0; i < 3; i++ {
+		first.Run()
+		second.Run()
+	}
+	if first.Location().ID() != 9 || second.Location().ID() != 4 || first.Repositioning() {
+		t.Errorf("Expect robots parked on 9 and 4, actual %d and %d", first.Location().ID(), second.Location().ID())
+	}
+}
+
+func TestRepositioningGivesWayToTasks(t *testing.T) {
+	setup()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	r.SetIdleStrategy(robot.CreateNearestParking(12))
+	w.AddRobot(r)
+	r.Run()
+	if !r.Repositioning() {
+		t.Fatalf("Expect the idle robot to head to parking")
+	}
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(2)))
+	r.Run()
+	if _, tk := r.GetStatus(); tk == nil || r.Repositioning() {
+		t.Errorf("Expect the robot to drop repositioning for the task")
+	}
+}
+
+func TestIdleRobotsGoToDemandHotspots(t *testing.T) {
+	setup()
+	hotspots := robot.CreateDemandHotspots(0.9)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	r.SetSelfClaim(false)
+	r.SetIdleStrategy(hotspots)
+	w.AddRobot(r)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(1)))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(9), w.GetGraph().Node(1)))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(9), w.GetGraph().Node(2)))
+
+	for i := 0; i < 3; i++ {
+		r.Run()
+	}
+	if r.Location().ID() != 9 || hotspots.Demand(w.GetGraph().Node(9)) <= hotspots.Demand(w.GetGraph().Node(3)) {
+		t.Errorf("Expect the robot to wait on the busiest origin 9, actual %d", r.Location().ID())
+	}
+}
+
+func TestIdleRobotsParkWithinReach(t *testing.T) {
+	setup()
+	zoned := &robot.Type{Name: "zoned", Speed: 1, Capacity: 1, Zones: []robot.Zone{{Name: "north", Nodes: []int64{1, 2, 3, 4}}}}
+	r := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, zoned, nil)
+	r.SetIdleStrategy(robot.CreateNearestParking(4, 9))
+	w.AddRobot(r)
+
+	// 9 is nearer on the world graph but outside the zone of the robot
+	if m, ok := r.Run().(*trace.MoveTrace); !ok || m.Target.ID() != 2 {
+		t.Errorf("Expect the robot to head to parking 4 in its zone, got %+v", m)
+	}
+}
+
+func TestDemandHotspotsForgetTakenTasks(t *testing.T) {
+	setup()
+	hotspots := robot.CreateDemandHotspots(0.9)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	r.SetSelfClaim(false)
+	r.SetIdleStrategy(hotspots)
+	w.AddRobot(r)
+	taken := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(1))
+	w.AddTask(taken)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(9), w.GetGraph().Node(1)))
+
+	r.Run()
+	if seen := hotspots.Snapshot().Seen; len(seen) != 2 {
+		t.Fatalf("Expect both waiting tasks seen, actual %d", len(seen))
+	}
+	if ok, err := w.ClaimTask(taken.GetTaskID(), r.ID()); !ok {
+		t.Fatalf("Expect the task claimed, err %+v", err)
+	}
+	hotspots.Reposition(r, w)
+	if s := hotspots.Snapshot(); len(s.Seen) != 1 || s.Demand[3] == 0 {
+		t.Errorf("Expect the taken task forgotten but its demand kept, actual %+v", s)
+	}
+}
+
+func TestIdleRobotsSpreadOut(t *testing.T) {
+	setup()
+	spread := robot.CreateSpreadOut()
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	r.SetIdleStrategy(spread)
+	w.AddRobot(r)
+	w.AddRobot(robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w))
+
+	for i := 0; i < 5; i++ {
+		r.Run()
+	}
+	// 11 and 12 are the farthest nodes from 1, four edges away
+	if r.Location().ID() != 11 {
+		t.Errorf("Expect the robot to move away from the other one, actual %d", r.Location().ID())
+	}
+}
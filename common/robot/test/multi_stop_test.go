@@ -0,0 +1,126 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/action"
+	"maze/common/methods"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func multiStopTask() *task.MultiStopTask {
+	return task.NewMultiStopTask(
+		common.TaskStop{Location: w.GetGraph().Node(2), Type: common.PickupStop, Payload: 1},
+		common.TaskStop{Location: w.GetGraph().Node(3), Type: common.PickupStop, Payload: 1},
+		common.TaskStop{Location: w.GetGraph().Node(4), Type: common.DropStop, Payload: 2},
+	)
+}
+
+func TestPlanMultiStopTaskAction(t *testing.T) {
+	setup()
+	ms := multiStopTask()
+	act, err := methods.PlanTaskAction(w.GetGraph(), w.GetGraph().Node(1), ms)
+	if err != nil {
+		t.Fatalf("Expect the task planned, got %v", err)
+	}
+	expected := []common.ActionType{
+		common.ActionTypeMove,
+		common.ActionTypeStartTask,
+		common.ActionTypePick,
+		common.ActionTypeMove,
+		common.ActionTypePick,
+		common.ActionTypeMove,
+		common.ActionTypeDrop,
+		common.ActionTypeEndTask,
+		common.ActionTypeNull,
+	}
+	for i, e := range expected {
+		if act.GetType() != e {
+			t.Fatalf("Action %d should be of type %d, actual %+v", i, e, act)
+		}
+		act = act.GetChild()
+	}
+}
+
+func TestRobotExecuteMultiStopTask(t *testing.T) {
+	setup()
+	ms := multiStopTask()
+	w.AddTask(ms)
+	r := robot.NewSimpleWarehouseRobotWithCapacity(uuid.New(), w.GetGraph().Node(1), w, 2)
+	peak := 0
+	for i := 0; i < 20; i++ {
+		if p, ok := r.Run().(*trace.PayloadTrace); ok && p.Load > peak {
+			peak = p.Load
+		}
+	}
+	if peak != 2 {
+		t.Errorf("Robot should carry 2 units at peak, actual %d", peak)
+	}
+	if r.Load() != 0 {
+		t.Errorf("Robot should be empty after the last drop, actual load %d", r.Load())
+	}
+	if stm.FinishedCount() != 1 {
+		t.Errorf("Multi-stop task should be finished, finished count %d", stm.FinishedCount())
+	}
+}
+
+func TestRobotSkipsTaskOverCapacity(t *testing.T) {
+	setup()
+	w.AddTask(multiStopTask())
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	r.Run()
+	if _, rT := r.GetStatus(); rT != nil {
+		t.Errorf("Robot with capacity %d should not claim a task with peak payload 2", r.Capacity())
+	}
+	if !stm.HasTasks() {
+		t.Error("Task should remain available for robots with enough capacity")
+	}
+}
+
+func TestRobotSkipsTaskDroppingBeforePickup(t *testing.T) {
+	setup()
+	w.AddTask(task.NewMultiStopTask(
+		common.TaskStop{Location: w.GetGraph().Node(2), Type: common.DropStop, Payload: 1},
+		common.TaskStop{Location: w.GetGraph().Node(3), Type: common.PickupStop, Payload: 1},
+	))
+	r := robot.NewSimpleWarehouseRobotWithCapacity(uuid.New(), w.GetGraph().Node(1), w, 2)
+	r.Run()
+	if _, rT := r.GetStatus(); rT != nil {
+		t.Errorf("Robot should not claim a task dropping payload before picking it up")
+	}
+}
+
+func TestRobotGivesUpDropOverLoad(t *testing.T) {
+	setup()
+	ms := multiStopTask()
+	w.AddTask(ms)
+	r := robot.NewSimpleWarehouseRobotWithCapacity(uuid.New(), w.GetGraph().Node(1), w, 2)
+	r.Run()
+	if _, rT := r.GetStatus(); rT == nil {
+		t.Fatalf("Robot should claim the task")
+	}
+	r.SetAction(action.CreateDropAction(w.GetGraph().Node(1), 1))
+	r.Step()
+	if _, rT := r.GetStatus(); rT != nil || stm.ActiveCount() != 0 || !stm.HasTasks() {
+		t.Errorf("Robot should give up a task it can't carry out and hand it back")
+	}
+}
@@ -0,0 +1,98 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/world"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRobotStateRoundTrip(t *testing.T) {
+	setup()
+	id := uuid.New()
+	r := robot.NewSimpleWarehouseRobot(id, w.GetGraph().Node(1), w)
+	w.AddRobot(r)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(12)))
+	for i := 0; i < 3; i++ {
+		r.Run()
+	}
+	s, err := r.Snapshot()
+	if err != nil {
+		t.Fatalf("Expect the robot to be saved, got %v", err)
+	}
+	tasks, err := stm.Snapshot()
+	if err != nil {
+		t.Fatalf("Expect the tasks to be saved, got %v", err)
+	}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded robot.State
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+
+	stm2 := task.CreateSimulatedTaskManager()
+	if err := stm2.Restore(tasks); err != nil {
+		t.Fatalf("Expect the tasks to be restored, got %v", err)
+	}
+	w2 := world.CreateWarehouseWorldWithTaskManager(stm2)
+	other := robot.NewSimpleWarehouseRobot(uuid.New(), w2.GetGraph().Node(1), w2)
+	if err := other.Restore(loaded, stm2.Task); err == nil {
+		t.Errorf("Expect the state of a robot to be refused by another robot")
+	}
+	r2 := robot.NewSimpleWarehouseRobot(id, w2.GetGraph().Node(1), w2)
+	w2.AddRobot(r2)
+	if err := r2.Restore(loaded, stm2.Task); err != nil {
+		t.Fatalf("Expect the robot to be restored, got %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if expected, actual := fmt.Sprintf("%+v", r.Run()), fmt.Sprintf("%+v", r2.Run()); expected != actual {
+			t.Fatalf("tick %d: expect the restored robot to run on like the original, %s instead of %s", i, actual, expected)
+		}
+	}
+	if stm.FinishedCount() != 1 || stm2.FinishedCount() != 1 {
+		t.Errorf("Expect both robots to complete the task")
+	}
+}
+
+func TestHotspotStateRoundTrip(t *testing.T) {
+	setup()
+	hotspots := robot.CreateDemandHotspots(0.9)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	r.SetSelfClaim(false)
+	r.SetIdleStrategy(hotspots)
+	w.AddRobot(r)
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(1)))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(9), w.GetGraph().Node(1)))
+	r.Run()
+
+	restored := robot.CreateDemandHotspots(0.9)
+	restored.Restore(hotspots.Snapshot())
+	for _, id := range []int64{3, 9} {
+		n := w.GetGraph().Node(id)
+		if restored.Demand(n) == 0 || restored.Demand(n) != hotspots.Demand(n) {
+			t.Errorf("Expect the demand on %d to be restored, %f instead of %f", id, restored.Demand(n), hotspots.Demand(n))
+		}
+	}
+}
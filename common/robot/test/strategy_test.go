@@ -0,0 +1,106 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/action"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"testing"
+
+	"github.com/google/uuid"
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+func TestNearestTaskSelector(t *testing.T) {
+	setup()
+	far := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(12), w.GetGraph().Node(1))
+	near := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3))
+	w.AddTask(far)
+	w.AddTask(near)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w, robot.WithTaskSelector(robot.NearestTask{}))
+	r.Run()
+	if _, tk := r.GetStatus(); tk == nil || tk.GetTaskID() != near.GetTaskID() {
+		t.Errorf("Expect the robot to claim the nearest task")
+	}
+}
+
+// countingExecutor counts the ticks, and leaves the robot waiting on every other tick
+type countingExecutor struct {
+	ticks int
+}
+
+func (e *countingExecutor) Execute(a robot.Actuator) common.Trace {
+	e.ticks++
+	if e.ticks%2 == 0 {
+		return trace.TaskNullActionTrace{}
+	}
+	return a.Step()
+}
+
+// detourPlanner always goes through node 6 before the origin of the task
+type detourPlanner struct {
+	robot.ShortestPath
+}
+
+func (p detourPlanner) Plan(g graph.Graph, from graph.Node, t common.Task) (common.Action, error) {
+	rest, err := p.ShortestPath.Plan(g, g.Node(6), t)
+	if err != nil {
+		return nil, err
+	}
+	move := action.CreateMoveActionWithPath(from, g.Node(6), []graph.Node{g.Node(6)})
+	move.SetChild(rest)
+	return move, nil
+}
+
+func TestCustomPlannerAndExecutor(t *testing.T) {
+	setup()
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+	exec := &countingExecutor{}
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w, robot.WithPathPlanner(detourPlanner{}), robot.WithExecutor(exec))
+
+	if m, ok := r.Run().(*trace.MoveTrace); !ok || m.Target.ID() != 6 {
+		t.Errorf("Expect the robot to follow the custom plan, got %+v", m)
+	}
+	if _, ok := r.Run().(trace.TaskNullActionTrace); !ok || r.Location().ID() != 6 {
+		t.Errorf("Expect the custom executor to hold the robot")
+	}
+	if m, ok := r.Run().(*trace.MoveTrace); !ok || m.Target.ID() != 2 || exec.ticks != 3 {
+		t.Errorf("Expect the robot to resume through the executor, got %+v", m)
+	}
+}
+
+func TestRobotSkipsTaskItCantReach(t *testing.T) {
+	setup()
+	lost := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), simple.Node(99))
+	w.AddTask(lost)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	w.AddRobot(r)
+
+	r.Run()
+	if _, tk := r.GetStatus(); tk != nil || r.Action().GetType() != common.ActionTypeNull {
+		t.Errorf("Expect the robot to give up the task it can't plan, got %+v", tk)
+	}
+	if tasks := w.GetAllTasks(); len(tasks) != 1 || tasks[0].GetTaskID() != lost.GetTaskID() {
+		t.Errorf("Expect the task handed back, got %+v", tasks)
+	}
+	if _, err := (robot.ShortestPath{}).Plan(w.GetGraph(), w.GetGraph().Node(1), lost); err == nil {
+		t.Errorf("Expect no plan to a node outside the graph")
+	}
+}
@@ -16,6 +16,7 @@
 package test
 
 import (
+	"errors"
 	"maze/common"
 	"maze/common/action"
 	"maze/common/methods"
@@ -110,7 +111,7 @@ func TestRobotGenerateActionPlan(t *testing.T) {
 		t.Errorf("The location of the robot initialized is incorrect")
 		t.Fail()
 	}
-	act := methods.PlanTaskAction(w.GetGraph(), r.Location(), t3)
+	act, _ := methods.PlanTaskAction(w.GetGraph(), r.Location(), t3)
 	if act.GetType() == common.ActionTypeMove && act.HasChild() && (act.(*action.MoveAction).Start == w.GetGraph().Node(1)) && (act.(*action.MoveAction).End == w.GetGraph().Node(2)) && len(act.(*action.MoveAction).Path) == 1 {
 
 	} else {
@@ -145,7 +146,7 @@ func TestRobotCanExecuteTaskPlan(t *testing.T) {
 	addT3()
 	r := robots[0]
 
-	act := methods.PlanTaskAction(w.GetGraph(), r.Location(), t3)
+	act, _ := methods.PlanTaskAction(w.GetGraph(), r.Location(), t3)
 	if act.GetType() == common.ActionTypeMove {
 
 	} else {
@@ -316,3 +317,33 @@ func TestRobotCanExecuteMoveInSimulation(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+// unrecordedTaskManager fails to record completions, as a task manager whose log can't be written does
+type unrecordedTaskManager struct {
+	*task.SimulatedTaskManager
+	failed int
+}
+
+func (m *unrecordedTaskManager) TaskUpdate(taskID common.TaskID, status common.TaskStatus) error {
+	if status == common.Completed {
+		m.failed++
+		return errors.New("completion not recorded")
+	}
+	return m.SimulatedTaskManager.TaskUpdate(taskID, status)
+}
+
+func TestRobotReleasesTaskWhenCompletionFails(t *testing.T) {
+	tm := &unrecordedTaskManager{SimulatedTaskManager: task.CreateSimulatedTaskManager()}
+	uw := world.CreateWarehouseWorldWithTaskManager(tm)
+	uw.AddTask(task.NewTimePriorityTaskWithParameter(uw.GetGraph().Node(1), uw.GetGraph().Node(2)))
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), uw.GetGraph().Node(1), uw)
+	for i := 0; i < 20 && tm.failed == 0; i++ {
+		r.Run()
+	}
+	if tm.failed == 0 {
+		t.Fatalf("Robot should have completed the task")
+	}
+	if _, tk := r.GetStatus(); tk != nil || tm.ActiveCount() != 0 || !tm.HasTasks() {
+		t.Errorf("Robot should hand back a task whose completion can't be recorded")
+	}
+}
@@ -0,0 +1,179 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package robot
+
+import (
+	"errors"
+	"maze/common"
+	"maze/common/action"
+	"maze/common/world"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// Zone is a named set of nodes of the world
+type Zone struct {
+	Name  string
+	Nodes []int64
+}
+
+// HandlingTimes are the durations of the handling actions of a robot, nil durations take a single tick
+type HandlingTimes struct {
+	Begin action.Duration
+	End   action.Duration
+	Pick  action.Duration
+	Drop  action.Duration
+	Dock  action.Duration
+}
+
+// Type is a model of robot. Robots of a type share speed, payload capacity, battery, where they may go and what they can do
+type Type struct {
+	Name string
+	// Speed is the number of edges moved per tick, fractions accumulate over ticks
+	Speed    float64
+	Capacity int
+	// Battery is the battery every robot of the type starts with, nil for robots which never run out of energy
+	Battery *Battery
+	// Zones restricts robots of the type to the nodes of the zones. Empty means anywhere
+	Zones []Zone
+	// Edges restricts robots of the type to the listed edges, in either direction. Empty means any edge
+	Edges        [][2]int64
+	Capabilities []common.Capability
+	// MTBF and MTTR are the mean ticks between failures and to repair. A zero MTBF means robots of the type never fail
+	MTBF float64
+	MTTR float64
+	// FaultModes are the failures robots of the type suffer, picked evenly. Empty means they stop in place
+	FaultModes []common.FaultMode
+	// DegradedFactor scales the speed of robots in degraded mode
+	DegradedFactor float64
+	// Handling is how long robots of the type take to begin and end tasks, pick and drop
+	Handling HandlingTimes
+	// TurnTime is how long robots tracking their heading take to turn 45 degrees, nil for a tick
+	TurnTime action.Duration
+}
+
+// DefaultType is the type of robots created without an explicit type
+var DefaultType = &Type{Name: "default", Speed: 1, Capacity: DefaultCapacity}
+
+func (t *Type) GetName() string {
+	return t.Name
+}
+
+func (t *Type) GetCapabilities() []common.Capability {
+	return t.Capabilities
+}
+
+func (t *Type) GetSpeed() float64 {
+	return t.Speed
+}
+
+// CanTraverse checks the move from one node to the other against the zones and edges of the type
+func (t *Type) CanTraverse(from, to graph.Node) bool {
+	if len(t.Zones) > 0 && !(t.inZones(from.ID()) && t.inZones(to.ID())) {
+		return false
+	}
+	if len(t.Edges) == 0 {
+		return true
+	}
+	for _, e := range t.Edges {
+		if (e[0] == from.ID() && e[1] == to.ID()) || (e[1] == from.ID() && e[0] == to.ID()) {
+			return true
+		}
+	}
+	return false
+}
+
+// restricted checks whether robots of the type can't go everywhere
+func (t *Type) restricted() bool {
+	return len(t.Zones) > 0 || len(t.Edges) > 0
+}
+
+func (t *Type) inZones(id int64) bool {
+	for _, z := range t.Zones {
+		for _, n := range z.Nodes {
+			if n == id {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasCapabilities checks whether every required capability is in the list
+func HasCapabilities(have []common.Capability, required []common.Capability) bool {
+	for _, req := range required {
+		found := false
+		for _, c := range have {
+			if c == req {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// TypeRegistry holds the robot types of a fleet by name
+type TypeRegistry struct {
+	types map[string]*Type
+}
+
+func CreateTypeRegistry() *TypeRegistry {
+	return &TypeRegistry{make(map[string]*Type)}
+}
+
+// Register adds a type to the registry, names must be unique
+func (reg *TypeRegistry) Register(t *Type) error {
+	if t.Name == "" {
+		return errors.New("robot type needs a name")
+	}
+	if _, ok := reg.types[t.Name]; ok {
+		return errors.New("robot type " + t.Name + " is already registered")
+	}
+	reg.types[t.Name] = t
+	return nil
+}
+
+// Get returns the type registered under the name
+func (reg *TypeRegistry) Get(name string) (*Type, bool) {
+	t, ok := reg.types[name]
+	return t, ok
+}
+
+// Names returns the registered type names in order
+func (reg *TypeRegistry) Names() []string {
+	var names []string
+	for n := range reg.types {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewRobotOfType creates a robot with the speed, capacity, battery and restrictions of the type. The battery is charged on the chargers, which may be nil
+func NewRobotOfType(id common.RobotID, location graph.Node, w common.World, typ *Type, chargers *world.ChargingNetwork, opts ...Option) *simpleWarehouseRobot {
+	r := NewSimpleWarehouseRobotWithCapacity(id, location, w, typ.Capacity, opts...)
+	r.typ = typ
+	if typ.Battery != nil {
+		b := *typ.Battery
+		r.SetBattery(&b, chargers)
+	}
+	return r
+}
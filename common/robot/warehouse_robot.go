@@ -16,10 +16,16 @@
 package robot
 
 import (
+	"errors"
 	"gonum.org/v1/gonum/graph"
 	"log"
+	"math"
+	"math/rand"
 	"maze/common/methods"
+	"maze/common/participants"
+	"maze/common/task"
 	"maze/common/trace"
+	"maze/common/world"
 
 	"maze/common"
 	"maze/common/action"
@@ -37,6 +43,43 @@ type simpleWarehouseRobot struct {
 	path []graph.Node
 	tick int
 	act  common.Action
+	// typ is the model of the robot, progress accumulates its speed until a whole edge can be moved
+	typ      *Type
+	progress float64
+	// fault is the current failure of the robot, nil when it works
+	fault *fault
+	// rand samples the durations of the actions
+	rand *rand.Rand
+	// idle picks where the robot waits while it has no work, repositioning is set while it heads there
+	idle          IdleStrategy
+	repositioning bool
+	// selector, planner and executor are the strategies the robot picks tasks, plans and acts with
+	selector TaskSelector
+	planner  PathPlanner
+	executor Executor
+	// comm talks to the neighbors, yielded counts the ticks in a row spent giving way to them
+	comm    *participants.DummyBot
+	yielded int
+	// clock gives the tick of a shared simulation clock, nil for robots counting their own runs
+	clock func() int
+	// docked is set while the robot sits at a station, leaving it takes a tick
+	docked bool
+	// stranded is set while the battery is depleted away from a charger, the robot blocks its node until it has energy again
+	stranded bool
+	// layout lets the robot know where it faces, nil for robots which don't track their heading
+	layout  world.Layout
+	heading common.Heading
+	// capacity is the maximum payload the robot can carry, load is what it currently carries
+	capacity int
+	load     int
+	// queue holds tasks awarded to the robot, to be carried out after the current one
+	queue []common.Task
+	// selfClaim lets the robot pull tasks from the world on its own. It is turned off when tasks are allocated by auction
+	selfClaim bool
+	// battery is the energy model of the robot, nil for robots which never run out of energy
+	battery  *Battery
+	chargers *world.ChargingNetwork
+	charging bool
 
 	common.World // a place to read world,
 }
@@ -53,10 +96,43 @@ func (r *simpleWarehouseRobot) Stop() {
 
 }
 func (r *simpleWarehouseRobot) Plan() {
+	if (r.fault != nil && r.fault.mode == common.FaultStopped) || r.stranded {
+		return
+	}
+	if r.repositioning && (r.act.GetType() != common.ActionTypeMove || r.hasWork() || (r.battery != nil && r.battery.Low())) {
+		// repositioning is over, or gives way to work
+		if r.act.GetType() == common.ActionTypeMove {
+			r.act = action.Null()
+		}
+		r.repositioning = false
+	}
+	r.planCharge()
+	if r.charging {
+		return
+	}
+	r.planTask()
+	r.planIdle()
+}
+
+// planTask starts the next queued task, or claims one from the world
+func (r *simpleWarehouseRobot) planTask() {
 	if r.act.GetType() == common.ActionTypeNull {
 		if r.task == nil {
+			if len(r.queue) > 0 {
+				if r.restricted() && math.IsInf(methods.TaskDistance(r.graph(), r.location, r.queue[0]), 1) {
+					// wait for the way to clear
+					return
+				}
+				r.task = r.queue[0]
+				r.queue = r.queue[1:]
+				r.start()
+				return
+			}
+			if !r.selfClaim || r.offline() {
+				return
+			}
 			if r.World.HasTasks() {
-				t := r.World.GetNextTask()
+				t := r.selector.Select(r, r.World, r.eligible)
 				if t == nil {
 					return
 					// in concurrent mode, there may be tasks, but during task claim, the task may not longer be available
@@ -66,72 +142,108 @@ func (r *simpleWarehouseRobot) Plan() {
 
 				if !success {
 					log.Printf("Err %+v, move on", err)
-				} else {
-					log.Printf("Robot %s has claimed task %s", r.id.String()[4:8], t.GetTaskID().String()[4:8])
+					return
 				}
-				r.act = methods.PlanTaskAction(r.World.GetGraph(), r.location, t)
+				log.Printf("Robot %s has claimed task %s", r.id.String()[4:8], t.GetTaskID().String()[4:8])
 				r.task = t
+				r.start()
 			}
 		}
 	}
 }
 
+// start plans the current task, and gives it up when the robot can't reach it
+func (r *simpleWarehouseRobot) start() {
+	act, err := r.plan(r.graph(), r.task)
+	if err != nil {
+		r.drop(err)
+		return
+	}
+	r.act = act
+}
+
+// Execute hands the current action over to the executor of the robot
 func (r *simpleWarehouseRobot) Execute() common.Trace {
+	return r.executor.Execute(r)
+}
+
+// Step carries out the current action for a tick
+func (r *simpleWarehouseRobot) Step() common.Trace {
 	var rTrace common.Trace
+	if r.fault != nil {
+		if fTrace := r.executeFault(); fTrace != nil {
+			return fTrace
+		}
+	}
+	if r.battery != nil {
+		if r.stranded && r.battery.Level > 0 {
+			r.revive()
+		}
+		if r.battery.Level <= 0 && r.act.GetType() != common.ActionTypeCharge {
+			r.strand()
+			return &trace.ChargeTrace{RobotID: r.id, Location: r.location, Event: trace.ChargeDepleted, Timestamp: r.tick}
+		}
+		r.battery.drain(r.consumption(r.act.GetType()))
+		r.chargeDocked()
+	}
 	switch r.act.GetType() {
 	case common.ActionTypeMove:
-		move := r.act.(*action.MoveAction)
-		move.SetStatus(common.ActiveStatus)
-		if len(move.Path) > 0 {
-			n := move.Path[0]
-			move.Path = move.Path[1:]
-			if len(move.Path) == 0 {
-				move.SetStatus(common.EndStatus)
-				r.act = move.GetChild()
-				rTrace = &trace.MoveTrace{
-					RobotID:   r.ID(),
-					Source:    r.location,
-					Target:    n,
-					Timestamp: r.tick,
-				}
-				r.location = n
-
-			} else {
-				rTrace = &trace.MoveTrace{
-					RobotID:   r.ID(),
-					Source:    r.location,
-					Target:    n,
-					Timestamp: r.tick,
-				}
-				r.location = n
-				r.act = move
-			}
-		} else {
-			move.SetStatus(common.EndStatus)
-			rTrace = &trace.MoveTrace{
-				RobotID:   r.ID(),
-				Source:    r.location,
-				Target:    r.location,
-				Timestamp: r.tick,
-			}
-			r.act = r.act.GetChild()
-		}
+		rTrace = r.executeMove()
 
 	case common.ActionTypeStartTask:
+		if rTrace = r.advance(r.typ.Handling.Begin); rTrace != nil {
+			break
+		}
 		r.act = r.act.GetChild()
-		rTrace = trace.TaskExecutionTrace{1, r.task.GetTaskID(), r.id}
+		rTrace = trace.TaskExecutionTrace{Status: 1, TaskID: r.task.GetTaskID(), RobotID: r.id}
+	case common.ActionTypePick:
+		if rTrace = r.advance(r.typ.Handling.Pick); rTrace != nil {
+			break
+		}
+		pick := r.act.(*action.PickAction)
+		if r.load+pick.Payload > r.capacity {
+			rTrace = r.drop(errors.New("payload exceeds capacity"))
+			break
+		}
+		r.load += pick.Payload
+		r.act = r.act.GetChild()
+		rTrace = &trace.PayloadTrace{RobotID: r.id, Location: r.location, Payload: pick.Payload, Item: pick.Item, Load: r.load, Timestamp: r.tick}
+	case common.ActionTypeDrop:
+		if rTrace = r.advance(r.typ.Handling.Drop); rTrace != nil {
+			break
+		}
+		drop := r.act.(*action.DropAction)
+		if drop.Payload > r.load {
+			rTrace = r.drop(errors.New("drops more payload than it carries"))
+			break
+		}
+		r.load -= drop.Payload
+		r.act = r.act.GetChild()
+		rTrace = &trace.PayloadTrace{RobotID: r.id, Location: r.location, Payload: -drop.Payload, Load: r.load, Timestamp: r.tick}
 	case common.ActionTypeEndTask:
+		if rTrace = r.advance(r.typ.Handling.End); rTrace != nil {
+			break
+		}
 		// mark task complete and remove self task
 		log.Printf("Robot %s Marking %s as complete", r.id.String()[4:8], r.task.GetTaskID().String()[4:8])
-		err := r.World.TaskUpdate(r.task.GetTaskID(), common.Completed)
-		if err != nil {
-			panic(err)
+		if err := r.World.TaskUpdate(r.task.GetTaskID(), common.Completed); err != nil {
+			// the task manager may fail to record the completion, e.g. when its log can't be written. The task is handed back
+			rTrace = r.drop(err)
+			break
 		}
 
 		r.act = r.act.GetChild()
 
-		rTrace = trace.TaskExecutionTrace{2, r.task.GetTaskID(), r.id}
+		rTrace = trace.TaskExecutionTrace{Status: 2, TaskID: r.task.GetTaskID(), RobotID: r.id}
 		r.task = nil
+	case common.ActionTypeCharge:
+		rTrace = r.executeCharge()
+	case common.ActionTypeRotate:
+		rTrace = r.executeRotate()
+	case common.ActionTypeWait:
+		rTrace = r.executeWait()
+	case common.ActionTypeDock:
+		rTrace = r.executeDock()
 	case common.ActionTypeNull:
 		// choose to remain on the same location, no move.
 		rTrace = trace.TaskNullActionTrace{}
@@ -142,21 +254,107 @@ func (r *simpleWarehouseRobot) Execute() common.Trace {
 	return rTrace
 }
 
+// executeMove moves the robot along the path as far as its speed allows in one tick
+func (r *simpleWarehouseRobot) executeMove() common.Trace {
+	if r.docked {
+		return r.undock()
+	}
+	move := r.act.(*action.MoveAction)
+	move.SetStatus(common.ActiveStatus)
+	rTrace := &trace.MoveTrace{
+		RobotID:   r.ID(),
+		Source:    r.location,
+		Timestamp: r.tick,
+	}
+	r.progress += r.speed()
+	moved := false
+	for len(move.Path) > 0 && r.progress >= 1 {
+		if r.mustYield(move.Path[0]) {
+			break
+		}
+		if r.blocked(move.Path[0]) {
+			if !r.detour(move) {
+				break
+			}
+			continue
+		}
+		if r.turnToward(move, move.Path[0]) {
+			r.progress = 0
+			if moved {
+				// turn on the next tick
+				break
+			}
+			return r.executeRotate()
+		}
+		moved = true
+		r.progress--
+		r.location = move.Path[0]
+		move.Path = move.Path[1:]
+	}
+	if len(move.Path) == 0 {
+		move.SetStatus(common.EndStatus)
+		r.act = move.GetChild()
+		r.progress = 0
+	}
+	rTrace.Target = r.location
+	rTrace.Heading = r.heading
+	return rTrace
+}
+
+// advance spends the tick on the current timed action. It returns a trace while the action is under way, and nil in the tick it ends
+func (r *simpleWarehouseRobot) advance(d action.Duration) common.Trace {
+	timed := r.act.(common.TimedAction)
+	if timed.Advance(func() int { return action.Ticks(d, r.rand) }) {
+		return nil
+	}
+	return &trace.ActionTrace{
+		RobotID:   r.id,
+		Location:  r.location,
+		Action:    r.act.GetType(),
+		Status:    timed.GetStatus(),
+		Remaining: timed.Remaining(),
+		Timestamp: r.tick,
+	}
+}
+
 // Run is a function that can be run in a concurrent way
 func (r *simpleWarehouseRobot) Run() common.Trace {
-	r.tick += 1
+	if r.clock != nil {
+		r.tick = r.clock()
+	} else {
+		r.tick += 1
+	}
 	r.Plan()
-	return r.Execute()
+	rTrace := r.Execute()
+	r.announce()
+	return rTrace
+}
+
+// DefaultCapacity is the payload capacity of robots created without an explicit capacity
+const DefaultCapacity = 1
+
+func NewSimpleWarehouseRobot(id common.RobotID, location graph.Node, world common.World, opts ...Option) *simpleWarehouseRobot {
+	return NewSimpleWarehouseRobotWithCapacity(id, location, world, DefaultCapacity, opts...)
 }
-func NewSimpleWarehouseRobot(id common.RobotID, location graph.Node, world common.World) *simpleWarehouseRobot {
+
+// NewSimpleWarehouseRobotWithCapacity creates a robot able to carry up to capacity units of payload at once
+// The options replace the default strategies of the robot
+func NewSimpleWarehouseRobotWithCapacity(id common.RobotID, location graph.Node, world common.World, capacity int, opts ...Option) *simpleWarehouseRobot {
 	s := simpleWarehouseRobot{
-		id,
-		location,
-		nil,
-		nil,
-		0,
-		action.Null(),
-		world,
+		id:        id,
+		location:  location,
+		act:       action.Null(),
+		typ:       DefaultType,
+		capacity:  capacity,
+		selfClaim: true,
+		rand:      rand.New(rand.NewSource(int64(id.ID()))),
+		selector:  FirstAvailable{},
+		planner:   ShortestPath{},
+		executor:  StepExecutor{},
+		World:     world,
+	}
+	for _, opt := range opts {
+		opt(&s)
 	}
 	return &s
 }
@@ -167,3 +365,160 @@ func (r *simpleWarehouseRobot) Init() bool {
 func (r *simpleWarehouseRobot) GetStatus() (common.Action, common.Task) {
 	return r.act, r.task
 }
+
+// SetRand replaces the source the robot samples action durations from
+func (r *simpleWarehouseRobot) SetRand(rnd *rand.Rand) {
+	r.rand = rnd
+}
+
+// Type returns the model of the robot
+func (r *simpleWarehouseRobot) Type() common.RobotType {
+	return r.typ
+}
+
+// Capabilities returns the capabilities of the robot, given by its type
+func (r *simpleWarehouseRobot) Capabilities() []common.Capability {
+	return r.typ.Capabilities
+}
+
+// Capacity returns the maximum payload the robot can carry
+func (r *simpleWarehouseRobot) Capacity() int {
+	return r.capacity
+}
+
+// Load returns the payload the robot currently carries
+func (r *simpleWarehouseRobot) Load() int {
+	return r.load
+}
+
+// canCarry checks whether the stops of a task can be visited in order, and its payload fits in the remaining capacity of the robot
+func (r *simpleWarehouseRobot) canCarry(t common.Task) bool {
+	ms, ok := t.(common.MultiStopTask)
+	if !ok {
+		return true
+	}
+	if task.ValidateStops(ms.GetStops()) != nil {
+		return false
+	}
+	return task.PeakPayload(ms.GetStops()) <= r.capacity-r.load
+}
+
+// drop gives up the current task when it can't be carried out, and hands it back to the task manager.
+// What the robot carries for it is written off
+func (r *simpleWarehouseRobot) drop(reason error) common.Trace {
+	log.Printf("Robot %s gives up %s: %v", r.id.String()[4:8], r.task.GetTaskID().String()[4:8], reason)
+	if err := r.World.TaskUpdate(r.task.GetTaskID(), common.Unassigned); err != nil {
+		log.Printf("Err %+v, move on", err)
+	}
+	r.task = nil
+	r.act = action.Null()
+	r.load = 0
+	r.progress = 0
+	return trace.TaskNullActionTrace{}
+}
+
+// Navigator is a robot moving on its own view of the world graph
+type Navigator interface {
+	// Graph returns the graph the robot plans its routes on
+	Graph() graph.Graph
+}
+
+// Graph returns the world graph as seen by the robot, limited to the edges its type may traverse and routing around blocked nodes
+func (r *simpleWarehouseRobot) Graph() graph.Graph {
+	return r.graph()
+}
+
+// graph returns the world graph as seen by the robot, limited to the edges its type may traverse and routing around blocked nodes
+func (r *simpleWarehouseRobot) graph() graph.Graph {
+	if !r.restricted() {
+		return r.World.GetGraph()
+	}
+	return methods.Restrict(r.World.GetGraph(), func(from, to graph.Node) bool {
+		return r.typ.CanTraverse(from, to) && !r.blocked(to)
+	})
+}
+
+// restricted checks whether the robot can't go everywhere, because of its type or of blocked nodes
+func (r *simpleWarehouseRobot) restricted() bool {
+	if r.typ.restricted() {
+		return true
+	}
+	ow, ok := r.World.(common.ObstructedWorld)
+	return ok && len(ow.Blocked()) > 0
+}
+
+// blocked checks whether another robot blocks the node
+func (r *simpleWarehouseRobot) blocked(n graph.Node) bool {
+	ow, ok := r.World.(common.ObstructedWorld)
+	return ok && n.ID() != r.location.ID() && ow.IsBlocked(n)
+}
+
+// detour replans the rest of the move around blocked nodes, false when there is no way around for now
+func (r *simpleWarehouseRobot) detour(move *action.MoveAction) bool {
+	target := move.Path[len(move.Path)-1]
+	g := r.graph()
+	if math.IsInf(methods.Distance(g, r.location, target), 1) {
+		return false
+	}
+	p, err := r.route(g, target)
+	if err != nil {
+		return false
+	}
+	move.Path = p
+	return true
+}
+
+// eligible checks whether the robot has the capacity and capabilities for a task, and can reach all of its stops
+func (r *simpleWarehouseRobot) eligible(t common.Task) bool {
+	if !r.canCarry(t) {
+		return false
+	}
+	if ct, ok := t.(common.CapabilityTask); ok && !HasCapabilities(r.Capabilities(), ct.RequiredCapabilities()) {
+		return false
+	}
+	if !r.restricted() {
+		return true
+	}
+	return !math.IsInf(methods.TaskDistance(r.graph(), r.location, t), 1)
+}
+
+// SetIdleStrategy sets where the robot waits while it has no work, nil to stay where the last task ended
+func (r *simpleWarehouseRobot) SetIdleStrategy(idle IdleStrategy) {
+	r.idle = idle
+}
+
+// Repositioning checks whether the robot is heading to a better spot while idle
+func (r *simpleWarehouseRobot) Repositioning() bool {
+	return r.repositioning && r.act.GetType() == common.ActionTypeMove
+}
+
+// hasWork checks whether the robot has a queued task, or an available task it could claim
+func (r *simpleWarehouseRobot) hasWork() bool {
+	if len(r.queue) > 0 {
+		return true
+	}
+	return r.selfClaim && !r.offline() && r.World.HasTasks() && r.selector.Select(r, r.World, r.eligible) != nil
+}
+
+// planIdle moves a robot without work to the spot picked by its idle strategy
+func (r *simpleWarehouseRobot) planIdle() {
+	if r.idle == nil || r.task != nil || r.act.GetType() != common.ActionTypeNull {
+		return
+	}
+	target, ok := r.idle.Reposition(r, r.World)
+	if !ok || target.ID() == r.location.ID() {
+		return
+	}
+	g := r.graph()
+	if math.IsInf(methods.Distance(g, r.location, target), 1) {
+		return
+	}
+	p, err := r.route(g, target)
+	if err != nil {
+		return
+	}
+	move := action.CreateMoveActionWithPath(r.location, target, p)
+	move.SetChild(action.Null())
+	r.act = move
+	r.repositioning = true
+}
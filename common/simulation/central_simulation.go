@@ -17,68 +17,330 @@
 package simulation
 
 import (
-	"github.com/google/uuid"
-	"log"
+	"fmt"
+	"math"
 	"math/rand"
 	"maze/common"
+	"maze/common/auction"
+	"maze/common/participants"
 	"maze/common/robot"
 	"maze/common/task"
+	"maze/common/trace"
 	"maze/common/world"
+	"time"
 )
 
+// Phases of a tick of the CentralizedSimulation, events at the same time run in this order
+const (
+	publishPhase = iota
+	arrivalPhase
+	faultPhase
+	allocationPhase
+	robotPhase
+)
+
+// CentralizedSimulation runs the robots one tick at a time on a discrete-event engine. Every tick is a set of events at the time
+// of the tick, and tasks arrive at any time in between
 type CentralizedSimulation struct {
-	World       common.World
-	TM          common.TaskManager
-	Iterations  int
+	World common.World
+	TM    common.TaskManager
+	// Engine holds the simulation clock the ticks and arrivals are scheduled on
+	Engine *Engine
+	// Iterations caps the number of ticks of the run, unless it is zero and a stop condition is set. Ticks before a restored checkpoint count
+	Iterations int
+	// StopWhen ends the run early, checked before every tick
+	StopWhen StopCondition
+	// Auctioneer allocates tasks to robots at the start of every iteration. When nil, robots claim tasks on their own
+	Auctioneer *auction.Auctioneer
+	// Dispatcher assigns tasks to idle robots every few iterations. When nil, robots claim tasks on their own
+	Dispatcher *Dispatcher
+	// Faults breaks robots down during the run. When nil, robots never fail
+	Faults *FaultInjector
+	// Chargers are where robots with a battery charge. When nil, they have nowhere to charge
+	Chargers *world.ChargingNetwork
+	// Idle picks where robots wait while they have no work. When nil, they stay where their last task ended
+	Idle robot.IdleStrategy
+	// Sync gives every robot its own copy of the world, kept up to date with a delay. When nil, robots share the world
+	Sync *SyncSettings
+	// CommRange lets robots within that many edges of each other share their intents and give way. Zero turns communication off
+	CommRange float64
+	// Seed drives every random draw of the simulation, runs with the same seed and settings produce the same traces
+	Seed int64
+	// NumRobots robots of the default type start on random nodes, unless the Fleet lists the robots
+	NumRobots int
+	Fleet     []RobotSpec
+	// Options configure every robot of the simulation, such as its task selector or path planner
+	Options []robot.Option
+	// Edges lay out the world, whose nodes are numbered from 1. When empty, the world is the 12 node network
+	Edges [][2]int64
+	// Tasks are placed on the world before the run. Further tasks arrive every ArrivalInterval ticks on average, zero means none do
+	Tasks           int
+	ArrivalInterval float64
+	source          *Source
+	arrivals        *rand.Rand
+	nextArrival     float64
+	// tick is the next tick to run, runs go on from where the previous run or a restored checkpoint left off
+	tick        int
+	driver      *world.SyncDriver
+	local       []*world.LocalWorld
+	network     *participants.Network
 	initialized bool
+	// Control pauses, steps and paces the run between ticks
+	Control
+}
+
+// SyncSettings configure the local world models of the robots. Changes are published every Interval ticks and reach the robots Delay ticks later
+type SyncSettings struct {
+	Delay    int
+	Interval int
+}
+
+// RobotSpec is a robot of the fleet. A nil Type is the default type, a zero Start a random node
+type RobotSpec struct {
+	Type  *robot.Type
+	Start int64
 }
 
 func CreateCentralizedSimulation() *CentralizedSimulation {
-	return &CentralizedSimulation{Iterations: 10}
+	sim := &CentralizedSimulation{}
+	sim.defaults()
+	return sim
+}
+
+func (sim *CentralizedSimulation) defaults() {
+	sim.Iterations = 10
+	sim.NumRobots = 5
+	sim.Tasks = 20
 }
 
 func (sim *CentralizedSimulation) Init() {
+	sim.init(task.CreateSimulatedTaskManager())
+}
+
+// init populates a world around the task manager with the robots and tasks of the simulation
+func (sim *CentralizedSimulation) init(tm common.TaskManager) {
 
-	sim.TM = task.CreateSimulatedTaskManager()
-	sim.World = world.CreateWorld(sim.TM)
+	sim.Engine = CreateEngine()
+	sim.source = CreateSource(sim.Seed)
+	placement := sim.source.Stream("placement")
+	sim.TM = tm
+	if len(sim.Edges) > 0 {
+		sim.World = world.CreateWorldWithEdges(sim.TM, sim.Edges)
+	} else {
+		sim.World = world.CreateWorld(sim.TM)
+	}
 	l := sim.World.GetGraph().Nodes().Len()
-	var numRobots = 5
-	for i := 0; i < numRobots; i++ {
-		rID, err := uuid.NewUUID()
-		if err != nil {
-			log.Fatal(err)
+	if sim.Sync != nil {
+		sim.driver = world.CreateSyncDriver(sim.World, sim.Sync.Interval)
+	}
+	if sim.CommRange > 0 {
+		sim.network = participants.CreateNetwork(sim.World.GetGraph(), sim.CommRange)
+	}
+	fleet := sim.Fleet
+	if len(fleet) == 0 {
+		fleet = make([]RobotSpec, sim.NumRobots)
+	}
+	for i, spec := range fleet {
+		rID := sim.source.NewID()
+		view := sim.World
+		if sim.driver != nil {
+			lw := world.CreateLocalWorld(sim.World, sim.Sync.Delay)
+			sim.driver.Register(lw)
+			sim.local = append(sim.local, lw)
+			view = lw
+		}
+		id := spec.Start
+		if id == 0 {
+			id = int64(placement.Intn(l) + 1)
 		}
-		sim.World.AddRobot(robot.NewSimpleWarehouseRobot(rID, sim.World.GetGraph().Node(int64(rand.Intn(l))), sim.World))
+		start := sim.World.GetGraph().Node(id)
+		if start == nil {
+			panic(fmt.Sprintf("Robot %d starts on unknown node %d", i, id))
+		}
+		typ := spec.Type
+		if typ == nil {
+			typ = robot.DefaultType
+		}
+		r := robot.NewRobotOfType(rID, start, view, typ, sim.Chargers, sim.Options...)
+		r.SetRand(sim.source.Stream(fmt.Sprintf("robot/%d", i)))
+		if sim.network != nil {
+			r.SetComm(sim.network.Join(rID, start))
+		}
+		r.SetSelfClaim(sim.Auctioneer == nil && sim.Dispatcher == nil)
+		r.SetIdleStrategy(sim.Idle)
+		sim.World.AddRobot(r)
 	}
 
-	for i := 0; i < 20; i++ {
-
-		t := task.NewTimePriorityTask()
-		t.Origin = sim.World.GetGraph().Node(int64(rand.Intn(l) + 1))
-		t.Destination = sim.World.GetGraph().Node(int64(rand.Intn(l) + 1))
-		if t.Origin == nil || t.Destination == nil {
-			panic("Failed Initialization")
-		}
-		sim.World.AddTask(t)
+	tasks := sim.source.Stream("tasks")
+	for i := 0; i < sim.Tasks; i++ {
+		sim.addTask(tasks)
 	}
+	sim.arrivals = sim.source.Stream("arrivals")
+	sim.nextArrival = sim.arrivals.ExpFloat64() * sim.ArrivalInterval
 	sim.initialized = true
 }
+
+// addTask places a task between two random nodes drawn from the stream
+func (sim *CentralizedSimulation) addTask(rnd *rand.Rand) {
+	l := sim.World.GetGraph().Nodes().Len()
+	t := sim.source.NewTask(sim.World.GetGraph().Node(int64(rnd.Intn(l)+1)), sim.World.GetGraph().Node(int64(rnd.Intn(l)+1)))
+	if t.Origin == nil || t.Destination == nil {
+		panic("Failed Initialization")
+	}
+	sim.World.AddTask(t)
+}
+
+// scheduleArrival schedules the next task arrival on the clock, arrivals fall at any time between ticks
+func (sim *CentralizedSimulation) scheduleArrival() {
+	if sim.ArrivalInterval <= 0 {
+		return
+	}
+	sim.Engine.Schedule(sim.nextArrival, arrivalPhase, func() {
+		sim.addTask(sim.arrivals)
+		sim.nextArrival += sim.arrivals.ExpFloat64() * sim.ArrivalInterval
+		sim.scheduleArrival()
+	})
+}
+
 func (sim *CentralizedSimulation) Run(obs common.Observer) error {
+	return sim.run(obs, sim.step)
+}
+
+// step runs the robots one after the other, every robot sees what the robots before it did in the tick
+func (sim *CentralizedSimulation) step(robots []common.Robot) []common.Trace {
+	traces := make([]common.Trace, len(robots))
+	for i, r := range robots {
+		traces[i] = r.Run()
+	}
+	return traces
+}
+
+// run drives the ticks on the engine, running the robots of every tick with the given step
+func (sim *CentralizedSimulation) run(obs common.Observer, step func([]common.Robot) []common.Trace) error {
 	if !sim.initialized {
 		panic("System enter the run mode before proper initialization")
 	}
-	for i := 0; i < sim.Iterations; i++ {
-		for _, i := range sim.World.GetRobots() {
-			trace := i.Run()
-			sim.World.UpdateRobot(i)
-			obs.Notify(trace)
+	sim.begin()
+	defer sim.end()
+	stop, start := sim.stopCondition(), time.Now()
+	// the events of a previous run are dropped, the clock goes on from the next tick to run
+	sim.Engine.Reset(float64(sim.tick))
+	sim.scheduleTick(sim.tick, obs, step)
+	sim.scheduleArrival()
+	sim.Engine.RunUntilStopped(math.Inf(1), func(tick int) bool {
+		return stop.Done(ProgressOf(sim.TM, tick, start)) || observerErr(obs) != nil || !sim.wait(1)
+	})
+	return observerErr(obs)
+}
+
+// failingObserver is an observer which can fail, such as a trace writer whose output is gone
+type failingObserver interface {
+	Err() error
+}
+
+// observerErr returns the error the observer failed with, a run stops on it
+func observerErr(obs common.Observer) error {
+	if f, ok := obs.(failingObserver); ok {
+		return f.Err()
+	}
+	return nil
+}
+
+// scheduleTick schedules the phases of the tick, the last of them schedules the next tick
+func (sim *CentralizedSimulation) scheduleTick(i int, obs common.Observer, step func([]common.Robot) []common.Trace) {
+	at := float64(i)
+	if sim.driver != nil {
+		sim.Engine.Schedule(at, publishPhase, func() {
+			sim.driver.Publish(i)
+		})
+	}
+	if sim.Faults != nil {
+		sim.Engine.Schedule(at, faultPhase, func() {
+			for _, fTrace := range sim.Faults.Inject(sim.World, i) {
+				obs.Notify(fTrace)
+			}
+		})
+	}
+	if sim.Auctioneer != nil || sim.Dispatcher != nil {
+		sim.Engine.Schedule(at, allocationPhase, func() {
+			if sim.Auctioneer != nil {
+				sim.Auctioneer.Run(sim.World)
+			}
+			if sim.Dispatcher != nil {
+				if rTrace := sim.Dispatcher.Dispatch(sim.World, i); rTrace != nil {
+					obs.Notify(rTrace)
+				}
+			}
+		})
+	}
+	sim.Engine.Schedule(at, robotPhase, func() {
+		robots := sim.World.GetRobots()
+		for j, rTrace := range step(robots) {
+			sim.World.UpdateRobot(robots[j])
+			obs.Notify(rTrace)
+			if eTrace := sim.completion(rTrace, i); eTrace != nil {
+				obs.Notify(eTrace)
+			}
 		}
+		sim.predict(i)
 		obs.Notify(struct {
 		}{})
+		sim.tick = i + 1
+		sim.done()
+		sim.scheduleTick(i+1, obs, step)
+	})
+}
+
+// stopCondition combines the cap on the iterations with the stop condition of the run
+func (sim *CentralizedSimulation) stopCondition() StopCondition {
+	if sim.StopWhen == nil {
+		return MaxTicks(sim.Iterations)
 	}
-	return nil
+	if sim.Iterations > 0 {
+		return Any(MaxTicks(sim.Iterations), sim.StopWhen)
+	}
+	return sim.StopWhen
 }
 
-func (sim *CentralizedSimulation) Stop() bool {
-	return true
+// predict records the predicted completion of the tasks carried by robots able to estimate it
+func (sim *CentralizedSimulation) predict(tick int) {
+	tm, ok := sim.TM.(common.ETATaskManager)
+	if !ok {
+		return
+	}
+	for _, r := range sim.World.GetRobots() {
+		e, ok := r.(common.Estimator)
+		if !ok {
+			continue
+		}
+		if _, t := r.GetStatus(); t != nil {
+			tm.SetETA(t.GetTaskID(), r.ID(), tick+int(math.Ceil(e.Estimate().Ticks)))
+		}
+	}
+}
+
+// completion compares the predicted completion of a task with the tick it completed on
+func (sim *CentralizedSimulation) completion(rTrace common.Trace, tick int) common.Trace {
+	done, ok := rTrace.(trace.TaskExecutionTrace)
+	if !ok || done.Status != 2 {
+		return nil
+	}
+	tm, ok := sim.TM.(common.ETATaskManager)
+	if !ok {
+		return nil
+	}
+	eta, ok := tm.ETA(done.TaskID)
+	if !ok {
+		return nil
+	}
+	return &trace.ETATrace{TaskID: done.TaskID, RobotID: done.RobotID, Predicted: eta.Initial, Latest: eta.Latest, Actual: tick}
+}
+
+// Conflicts returns the number of task claims refused because the local world of a robot was out of date
+func (sim *CentralizedSimulation) Conflicts() int {
+	n := 0
+	for _, lw := range sim.local {
+		n += lw.Conflicts()
+	}
+	return n
 }
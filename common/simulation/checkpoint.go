@@ -0,0 +1,329 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"maze/common"
+	"maze/common/participants"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/world"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// WorldState is the serializable state of a world: the edges of its graph and the robots blocking its nodes
+type WorldState struct {
+	Edges   [][2]int64                 `json:"edges"`
+	Blocked map[int64][]common.RobotID `json:"blocked,omitempty"`
+}
+
+// Checkpoint is the state of a centralized simulation between two ticks. Restoring it on a simulation set up the same way
+// runs on exactly like the simulation it was taken of, so experiments can branch off it and long runs can be resumed
+type Checkpoint struct {
+	Tick        int                   `json:"tick"`
+	NextArrival float64               `json:"nextArrival"`
+	Source      SourceState           `json:"source"`
+	World       WorldState            `json:"world"`
+	Tasks       task.TaskManagerState `json:"tasks"`
+	Robots      []robot.State         `json:"robots"`
+	// Faults are the draws of the fault injector, Hotspots the demand learned by the idle strategy, Dispatch the outcome of the dispatch rounds
+	// and Chargers the robots taking the slots of every charging station, when the simulation has them
+	Faults   *uint64                    `json:"faults,omitempty"`
+	Hotspots *robot.HotspotState        `json:"hotspots,omitempty"`
+	Dispatch *DispatchMetrics           `json:"dispatch,omitempty"`
+	Chargers map[int64][]common.RobotID `json:"chargers,omitempty"`
+	// Sync holds the local worlds of the robots and the changes on their way to them, Comm the intents in flight between robots
+	Sync *SyncState                 `json:"sync,omitempty"`
+	Comm *participants.NetworkState `json:"comm,omitempty"`
+}
+
+// SyncState is the serializable state of the local worlds of a simulation, in the order of the robots
+type SyncState struct {
+	Driver world.SyncDriverState   `json:"driver"`
+	Local  []world.LocalWorldState `json:"local"`
+}
+
+// Checkpointer is a simulation whose state can be saved and restored
+type Checkpointer interface {
+	common.Simulation
+	Checkpoint() (*Checkpoint, error)
+	Restore(cp *Checkpoint) error
+}
+
+// snapshotTaskManager is a task manager able to save and restore its queues
+type snapshotTaskManager interface {
+	Snapshot() (task.TaskManagerState, error)
+	Restore(s task.TaskManagerState) error
+	Task(taskID common.TaskID) (common.Task, bool)
+}
+
+// blockedWorld is a world telling which robots block its nodes
+type blockedWorld interface {
+	common.ObstructedWorld
+	Blockers() map[int64][]common.RobotID
+}
+
+// Checkpoint saves the state of the simulation. A running simulation is saved once it is paused between two ticks or its run ended
+func (sim *CentralizedSimulation) Checkpoint() (*Checkpoint, error) {
+	var cp *Checkpoint
+	var err error
+	sim.hold(func() {
+		cp, err = sim.checkpoint()
+	})
+	return cp, err
+}
+
+func (sim *CentralizedSimulation) checkpoint() (*Checkpoint, error) {
+	tm, ok := sim.TM.(snapshotTaskManager)
+	if !ok {
+		return nil, fmt.Errorf("task manager %T can't be saved", sim.TM)
+	}
+	tasks, err := tm.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	cp := &Checkpoint{Tick: sim.tick, NextArrival: sim.nextArrival, Source: sim.source.Snapshot(), World: WorldState{Edges: edges(sim.World.GetGraph())}, Tasks: tasks}
+	if bw, ok := sim.World.(blockedWorld); ok {
+		if blocked := bw.Blockers(); len(blocked) > 0 {
+			cp.World.Blocked = blocked
+		}
+	}
+	for _, r := range sim.World.GetRobots() {
+		rs, ok := r.(robot.Snapshotter)
+		if !ok {
+			return nil, fmt.Errorf("robot %s can't be saved", r.ID())
+		}
+		s, err := rs.Snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("robot %s: %v", r.ID(), err)
+		}
+		cp.Robots = append(cp.Robots, s)
+	}
+	if sim.Faults != nil {
+		draws := sim.Faults.src.draws
+		cp.Faults = &draws
+	}
+	if h, ok := sim.Idle.(*robot.DemandHotspots); ok {
+		s := h.Snapshot()
+		cp.Hotspots = &s
+	}
+	if sim.Dispatcher != nil {
+		m := sim.Dispatcher.Metrics
+		cp.Dispatch = &m
+	}
+	if sim.Chargers != nil {
+		if occupants := sim.Chargers.Occupants(); len(occupants) > 0 {
+			cp.Chargers = occupants
+		}
+	}
+	if sim.driver != nil {
+		driver, err := sim.driver.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		cp.Sync = &SyncState{Driver: driver}
+		for _, lw := range sim.local {
+			s, err := lw.Snapshot()
+			if err != nil {
+				return nil, err
+			}
+			cp.Sync.Local = append(cp.Sync.Local, s)
+		}
+	}
+	if sim.network != nil {
+		s := sim.network.Snapshot()
+		cp.Comm = &s
+	}
+	return cp, nil
+}
+
+// Restore puts an initialized simulation back in the state of the checkpoint, its next run goes on from the tick of the checkpoint.
+// The simulation must be set up like the one the checkpoint was taken of, with the same seed, world and fleet. Strategies may differ,
+// to see how the run would have gone on with them
+func (sim *CentralizedSimulation) Restore(cp *Checkpoint) error {
+	var err error
+	sim.hold(func() {
+		err = sim.restore(cp)
+	})
+	return err
+}
+
+func (sim *CentralizedSimulation) restore(cp *Checkpoint) error {
+	if !sim.initialized {
+		return errors.New("the simulation must be initialized before restoring a checkpoint")
+	}
+	if err := sim.matches(cp); err != nil {
+		return err
+	}
+	if !sameEdges(edges(sim.World.GetGraph()), cp.World.Edges) {
+		return errors.New("the checkpoint was taken of a different world")
+	}
+	robots := sim.World.GetRobots()
+	if len(robots) != len(cp.Robots) {
+		return fmt.Errorf("the checkpoint has %d robots, the simulation %d", len(cp.Robots), len(robots))
+	}
+	tm, ok := sim.TM.(snapshotTaskManager)
+	if !ok {
+		return fmt.Errorf("task manager %T can't be restored", sim.TM)
+	}
+	if err := sim.source.Restore(cp.Source); err != nil {
+		return err
+	}
+	if err := tm.Restore(cp.Tasks); err != nil {
+		return err
+	}
+	if bw, ok := sim.World.(blockedWorld); ok {
+		g := sim.World.GetGraph()
+		for id, blockers := range bw.Blockers() {
+			for _, by := range blockers {
+				bw.Unblock(g.Node(id), by)
+			}
+		}
+		for id, blockers := range cp.World.Blocked {
+			for _, by := range blockers {
+				bw.Block(g.Node(id), by)
+			}
+		}
+	} else if len(cp.World.Blocked) > 0 {
+		return errors.New("the world of the simulation can't block nodes")
+	}
+	if sim.Chargers != nil {
+		g := sim.World.GetGraph()
+		for id, occupants := range sim.Chargers.Occupants() {
+			for _, by := range occupants {
+				sim.Chargers.Release(g.Node(id), by)
+			}
+		}
+		for id, occupants := range cp.Chargers {
+			for _, by := range occupants {
+				if !sim.Chargers.Reserve(g.Node(id), by) {
+					return fmt.Errorf("no slot left on the charging station on node %d", id)
+				}
+			}
+		}
+	} else if len(cp.Chargers) > 0 {
+		return errors.New("the simulation has no chargers")
+	}
+	for i, r := range robots {
+		rs, ok := r.(robot.Snapshotter)
+		if !ok {
+			return fmt.Errorf("robot %s can't be restored", r.ID())
+		}
+		if err := rs.Restore(cp.Robots[i], tm.Task); err != nil {
+			return err
+		}
+	}
+	if sim.Faults != nil && cp.Faults != nil {
+		sim.Faults.src.rewind(sim.Faults.rand, *cp.Faults)
+	}
+	if h, ok := sim.Idle.(*robot.DemandHotspots); ok && cp.Hotspots != nil {
+		h.Restore(*cp.Hotspots)
+	}
+	if sim.Dispatcher != nil && cp.Dispatch != nil {
+		sim.Dispatcher.Metrics = *cp.Dispatch
+	}
+	if sim.driver != nil {
+		if err := sim.driver.Restore(cp.Sync.Driver, tm.Task); err != nil {
+			return err
+		}
+		for i, lw := range sim.local {
+			if err := lw.Restore(cp.Sync.Local[i], tm.Task); err != nil {
+				return err
+			}
+		}
+	}
+	if sim.network != nil {
+		if err := sim.network.Restore(*cp.Comm, sim.World.GetGraph()); err != nil {
+			return err
+		}
+	}
+	sim.tick, sim.nextArrival = cp.Tick, cp.NextArrival
+	return nil
+}
+
+// matches checks that the checkpoint holds the local worlds and the messages of the simulation, when it has them
+func (sim *CentralizedSimulation) matches(cp *Checkpoint) error {
+	if (sim.driver != nil) != (cp.Sync != nil) {
+		return errors.New("the checkpoint and the simulation don't both sync local worlds")
+	}
+	if cp.Sync != nil && len(cp.Sync.Local) != len(sim.local) {
+		return fmt.Errorf("the checkpoint has %d local worlds, the simulation %d", len(cp.Sync.Local), len(sim.local))
+	}
+	if (sim.network != nil) != (cp.Comm != nil) {
+		return errors.New("the checkpoint and the simulation don't both have communicating robots")
+	}
+	return nil
+}
+
+// edges returns the edges of a graph from lower to higher node IDs, ordered
+func edges(g graph.Graph) [][2]int64 {
+	var edges [][2]int64
+	for _, n := range graph.NodesOf(g.Nodes()) {
+		for _, m := range graph.NodesOf(g.From(n.ID())) {
+			if n.ID() < m.ID() {
+				edges = append(edges, [2]int64{n.ID(), m.ID()})
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i][0] != edges[j][0] {
+			return edges[i][0] < edges[j][0]
+		}
+		return edges[i][1] < edges[j][1]
+	})
+	return edges
+}
+
+func sameEdges(a, b [][2]int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SaveCheckpoint writes the checkpoint to a file as JSON
+func SaveCheckpoint(cp *Checkpoint, path string) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// LoadCheckpoint reads a checkpoint written by SaveCheckpoint
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, err
+	}
+	return &cp, nil
+}
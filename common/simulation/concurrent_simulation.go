@@ -18,13 +18,14 @@ package simulation
 
 import (
 	"fmt"
-	"github.com/google/uuid"
 	"log"
 	"math/rand"
 	"maze/common"
 	"maze/common/robot"
 	"maze/common/task"
 	"maze/common/world"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,32 +33,29 @@ type TaskFeederActor struct {
 	probability int
 	frequency   int
 	W           common.World
-	comm        chan interface{}
-	cap         int
+	// control holds, steps and paces the draws of the feeder, a draw counting as a tick
+	control *Control
+	cap     int
+	source  *Source
+	rand    *rand.Rand
 }
 
 func (actor *TaskFeederActor) Run(observer common.Observer) {
+	actor.control.begin()
 	go func() {
-		for {
-			select {
-			default:
-				if actor.cap == 0 {
-					break
-				}
-				time.After(5)
-				if actor.probability > rand.Intn(100) {
-					m := actor.W.GetGraph().Nodes().Len()
-					t := task.NewTimePriorityTaskWithParameter(actor.W.GetGraph().Node(int64(rand.Intn(m-1)+1)), actor.W.GetGraph().Node(int64(rand.Intn(m-1)+1)))
-					observer.GetChannel() <- fmt.Sprintf("Adding Task %+v", t)
-
-					actor.W.AddTask(t)
-					actor.cap--
-
-				}
-			case <-actor.comm:
-				break
-			}
+		defer actor.control.end()
+		for actor.cap > 0 && actor.control.wait(1) {
+			time.After(5)
+			if actor.probability > actor.rand.Intn(100) {
+				m := actor.W.GetGraph().Nodes().Len()
+				t := actor.source.NewTask(actor.W.GetGraph().Node(int64(actor.rand.Intn(m-1)+1)), actor.W.GetGraph().Node(int64(actor.rand.Intn(m-1)+1)))
+				observer.GetChannel() <- fmt.Sprintf("Adding Task %+v", t)
+
+				actor.W.AddTask(t)
+				actor.cap--
 
+			}
+			actor.control.done()
 		}
 	}()
 }
@@ -65,24 +63,27 @@ func (actor *TaskFeederActor) Init() {
 
 }
 func (actor *TaskFeederActor) Stop() {
-	close(actor.comm)
+	actor.control.Stop()
 }
 
 type ActorRef struct {
-	comm  chan interface{}
 	robot common.Robot
+	// control holds, steps and paces the runs of the robot, a run counting as a tick
+	control *Control
+	// runs counts the runs of the robot, the stop condition is checked after every run
+	runs   int64
+	finish *Finish
 }
 
 func (actor *ActorRef) Run(observer common.Observer) {
-
+	actor.control.begin()
 	go func() {
-		for {
-			select {
-			default:
-				observer.GetChannel() <- actor.robot.Run()
-			case <-actor.comm:
-				break
-			}
+		defer actor.control.end()
+		for actor.control.wait(1) {
+			observer.GetChannel() <- actor.robot.Run()
+			atomic.AddInt64(&actor.runs, 1)
+			actor.finish.Check()
+			actor.control.done()
 		}
 	}()
 }
@@ -91,7 +92,7 @@ func (actor *ActorRef) Init() {
 
 }
 func (actor *ActorRef) Stop() {
-	close(actor.comm)
+	actor.control.Stop()
 }
 
 type System struct {
@@ -99,45 +100,129 @@ type System struct {
 	stm    *task.SimulatedTaskManagerSync
 	refs   []common.Actor
 	NumBot int
+	// Idle picks where robots wait while they have no work. When nil, they stay where their last task ended
+	Idle robot.IdleStrategy
+	// Seed drives the random draws of the robots and the task feeder. Robots run freely, so runs still interleave differently
+	Seed int64
+	// StopWhen ends RunTillStop, checked whenever a robot runs. The tick is the fewest runs of any robot, and the wall time counts from Start.
+	// It is read by Init. When nil, the run ends once all tasks are done
+	StopWhen StopCondition
+	robots   []*ActorRef
+	feeder   *TaskFeederActor
+	finish   *Finish
+	start    time.Time
 }
 
 func (s *System) Init() {
 	s.stm = task.CreateSimulatedTaskManagerSync()
 	s.W = world.CreateWarehouseWorldWithTaskManager(s.stm)
 
-	t := task.NewTimePriorityTask()
-	t.Origin = s.W.GetGraph().Node(2)
-	t.Destination = s.W.GetGraph().Node(6)
-
-	s.stm.AddTask(t)
+	source := CreateSource(s.Seed)
+	stop := s.StopWhen
+	if stop == nil {
+		stop = AllTasksDone()
+	}
+	s.finish = CreateFinish(stop, func() Progress { return ProgressOf(s.stm, s.tick(), s.start) })
+	s.stm.AddTask(source.NewTask(s.W.GetGraph().Node(2), s.W.GetGraph().Node(6)))
 	for i := 0; i < s.NumBot; i++ {
-		s.refs = append(s.refs, &ActorRef{make(chan interface{}), robot.NewSimpleWarehouseRobot(uuid.New(), s.W.GetGraph().Node(1), s.W)})
+		r := robot.NewSimpleWarehouseRobot(source.NewID(), s.W.GetGraph().Node(1), s.W)
+		r.SetRand(source.Stream(fmt.Sprintf("robot/%d", i)))
+		r.SetIdleStrategy(s.Idle)
+		ref := &ActorRef{robot: r, control: &Control{}, finish: s.finish}
+		s.robots = append(s.robots, ref)
+		s.refs = append(s.refs, ref)
 	}
-	s.refs = append(s.refs, &TaskFeederActor{30, 5, s.W, make(chan interface{}), 5})
+	s.feeder = &TaskFeederActor{30, 5, s.W, &Control{}, 5, source, source.Stream("feeder")}
+	s.refs = append(s.refs, s.feeder)
 	for _, i := range s.refs {
 		i.Init()
 	}
 }
 func (s *System) Start(observer common.Observer) {
+	s.start = time.Now()
 	for _, i := range s.refs {
 		i.Run(observer)
 	}
 }
+
+// Run starts the actors and blocks until the stop condition holds
+func (s *System) Run(observer common.Observer) error {
+	s.Start(observer)
+	s.RunTillStop()
+	return nil
+}
+
+// controls returns the controls of the robots and the task feeder
+func (s *System) controls() []*Control {
+	var controls []*Control
+	for _, r := range s.robots {
+		controls = append(controls, r.control)
+	}
+	return append(controls, s.feeder.control)
+}
+
+// Pause holds every actor before its next run
+func (s *System) Pause() {
+	for _, c := range s.controls() {
+		c.Pause()
+	}
+}
+
+// Resume lets every actor go on
+func (s *System) Resume() {
+	for _, c := range s.controls() {
+		c.Resume()
+	}
+}
+
+// Step runs every actor once and pauses them again, returning once they all ran
+func (s *System) Step() {
+	var wg sync.WaitGroup
+	for _, c := range s.controls() {
+		wg.Add(1)
+		go func(c *Control) {
+			defer wg.Done()
+			c.Step()
+		}(c)
+	}
+	wg.Wait()
+}
+
+// SetSpeed paces every actor at a multiple of real time, a run of an actor counting as a tick
+func (s *System) SetSpeed(multiple float64) {
+	for _, c := range s.controls() {
+		c.SetSpeed(multiple)
+	}
+}
+
+// Stop stops the actors, and ends RunTillStop
 func (s System) Stop() bool {
 	for _, i := range s.refs {
 		i.Stop()
 	}
+	if s.finish != nil {
+		s.finish.Close()
+	}
 	return true
 }
 
+// RunTillStop blocks until the stop condition holds or the system is stopped, then stops the actors
 func (s *System) RunTillStop() {
-	for {
-		if s.stm.HasTasks() || s.stm.ActiveCount() > 0 {
+	s.finish.Wait()
+	log.Print("Stopping\n")
+	s.Stop()
+}
 
-		} else {
-			log.Print("Stopping\n")
-			s.Stop()
-			break
+// tick returns the fewest runs of any robot, the ticks all robots went through
+func (s *System) tick() int {
+	tick := -1
+	for _, r := range s.robots {
+		if n := int(atomic.LoadInt64(&r.runs)); tick < 0 || n < tick {
+			tick = n
 		}
 	}
+	if tick < 0 {
+		return 0
+	}
+	return tick
 }
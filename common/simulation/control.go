@@ -0,0 +1,211 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"sync"
+	"time"
+)
+
+// RealTimeTick is the real time a tick stands for, a simulation at speed 1 runs a tick per RealTimeTick
+const RealTimeTick = time.Second
+
+// Control pauses, resumes, single-steps and paces a running simulation. Simulations call it between their ticks, while the
+// control methods are called from other goroutines, such as a debugger or a demo UI. The zero value runs as fast as possible
+type Control struct {
+	m sync.Mutex
+	// changed is closed and replaced whenever the state changes, to wake up the run and the callers of Step
+	changed chan struct{}
+	paused  bool
+	stopped bool
+	running bool
+	// held is set while the run waits paused between two ticks
+	held bool
+	// ticks are the ticks run so far, until the ticks a paused run goes on to. Steps move until forward
+	ticks int
+	until int
+	speed float64
+	last  time.Time
+}
+
+// signal returns the channel closed on the next change, the lock must be held
+func (c *Control) signal() chan struct{} {
+	if c.changed == nil {
+		c.changed = make(chan struct{})
+	}
+	return c.changed
+}
+
+// notify wakes up everything waiting for a change, the lock must be held
+func (c *Control) notify() {
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+}
+
+// Pause holds the run before its next tick
+func (c *Control) Pause() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if !c.paused {
+		// a tick under way still ends, the run holds after it
+		c.until = c.ticks
+	}
+	c.paused = true
+	c.notify()
+}
+
+// Resume lets a paused run go on
+func (c *Control) Resume() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.paused = false
+	c.notify()
+}
+
+// Step runs a single tick and pauses the run again, so a running simulation is paused after its next tick.
+// It returns once the tick is done, or right away when the simulation doesn't run, in which case the step is taken once it does.
+// Steps called together take a tick each
+func (c *Control) Step() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if !c.paused || c.until < c.ticks {
+		c.until = c.ticks
+	}
+	c.paused = true
+	c.until++
+	target := c.until
+	c.notify()
+	for c.running && !c.stopped && c.ticks < target {
+		ch := c.signal()
+		c.m.Unlock()
+		<-ch
+		c.m.Lock()
+	}
+}
+
+// SetSpeed paces the run at the given multiple of real time, where a tick lasts RealTimeTick at speed 1. Zero or less runs as fast as possible
+func (c *Control) SetSpeed(multiple float64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.speed = multiple
+	c.notify()
+}
+
+// Stop ends the run before its next tick, for good
+func (c *Control) Stop() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.stopped = true
+	c.notify()
+	return true
+}
+
+// Stopped checks whether the run was stopped
+func (c *Control) Stopped() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.stopped
+}
+
+// Paused checks whether the run is held
+func (c *Control) Paused() bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.paused && c.ticks >= c.until
+}
+
+// begin marks the start of a run
+func (c *Control) begin() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.running = true
+	c.last = time.Time{}
+	c.notify()
+}
+
+// end marks the end of a run, releasing the callers of Step
+func (c *Control) end() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.running = false
+	c.notify()
+}
+
+// wait blocks before the next tick while the run is paused, and until the ticks since the previous one took their real time.
+// The run may skip idle ticks, so the next tick can be several ticks away. It returns false once the run is stopped
+func (c *Control) wait(ticks int) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for !c.stopped {
+		var delay time.Duration
+		if c.paused && c.ticks >= c.until {
+			delay = -1
+		} else if c.speed > 0 && !c.last.IsZero() {
+			due := c.last.Add(time.Duration(float64(ticks) * float64(RealTimeTick) / c.speed))
+			if delay = time.Until(due); delay <= 0 {
+				break
+			}
+		} else {
+			break
+		}
+		if delay < 0 {
+			c.held = true
+			c.notify()
+		}
+		ch := c.signal()
+		c.m.Unlock()
+		if delay < 0 {
+			<-ch
+		} else {
+			select {
+			case <-ch:
+			case <-time.After(delay):
+			}
+		}
+		c.m.Lock()
+		c.held = false
+	}
+	if c.stopped {
+		return false
+	}
+	c.last = time.Now()
+	return true
+}
+
+// done marks the end of a tick
+func (c *Control) done() {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.ticks++
+	c.notify()
+}
+
+// hold calls f while the run is held between two ticks, waiting for a running simulation to be paused or its run to end.
+// The run can't go on until f returns
+func (c *Control) hold(f func()) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	for c.running && !c.held {
+		ch := c.signal()
+		c.m.Unlock()
+		<-ch
+		c.m.Lock()
+	}
+	f()
+}
@@ -0,0 +1,135 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"log"
+	"math"
+	"maze/common"
+	"maze/common/auction"
+	"maze/common/methods"
+	"maze/common/robot"
+	"maze/common/trace"
+	"sort"
+)
+
+// DispatchStrategy selects how the dispatcher matches idle robots with tasks
+type DispatchStrategy int
+
+const (
+	// OptimalDispatch minimizes the total travel with the Hungarian algorithm
+	OptimalDispatch DispatchStrategy = iota
+	// GreedyDispatch lets every robot take its nearest task in turn
+	GreedyDispatch
+)
+
+// DispatchMetrics accumulates the outcome of the dispatch rounds, with the pairs and cost of both strategies on the same rounds for comparison.
+// The costs only compare when both strategies assigned as many pairs
+type DispatchMetrics struct {
+	Rounds          int
+	Assigned        int
+	OptimalCost     float64
+	GreedyCost      float64
+	OptimalAssigned int
+	GreedyAssigned  int
+}
+
+// Dispatcher is a global dispatcher for the centralized mode. Every Interval ticks, it builds the idle robot × task cost matrix
+// from shortest path distances on the graph each robot moves on, solves the assignment and pushes the tasks to the robots. Pairs where the robot can't take the task are infeasible
+type Dispatcher struct {
+	Strategy DispatchStrategy
+	Interval int
+	Metrics  DispatchMetrics
+}
+
+func CreateDispatcher(strategy DispatchStrategy, interval int) *Dispatcher {
+	if interval < 1 {
+		interval = 1
+	}
+	return &Dispatcher{Strategy: strategy, Interval: interval}
+}
+
+// Dispatch runs a dispatch round on the world if one is due at the tick, and returns its trace. It returns nil when no round is due
+func (d *Dispatcher) Dispatch(w common.World, tick int) common.Trace {
+	if tick%d.Interval != 0 {
+		return nil
+	}
+	var robots []common.Bidder
+	for _, r := range w.GetRobots() {
+		if b, ok := r.(common.Bidder); ok && auction.Idle(b) {
+			robots = append(robots, b)
+		}
+	}
+	sort.Slice(robots, func(i, j int) bool { return robots[i].ID().String() < robots[j].ID().String() })
+	tasks := auction.Announce(w)
+	cost := make([][]float64, len(robots))
+	for i, r := range robots {
+		cost[i] = make([]float64, len(tasks))
+		g := w.GetGraph()
+		if n, ok := r.(robot.Navigator); ok {
+			g = n.Graph()
+		}
+		for j, t := range tasks {
+			// a robot which can't take the task, for its capabilities, zones, capacity or battery, declines to bid on it.
+			// The pair is left out of the assignment, so a task no robot can take stays unassigned
+			if bid, ok := r.Bid(t); !ok || math.IsInf(bid, 1) {
+				cost[i][j] = math.Inf(1)
+				continue
+			}
+			cost[i][j] = methods.TaskDistance(g, r.Location(), t)
+		}
+	}
+	optimal := methods.HungarianAssign(cost)
+	greedy := methods.GreedyAssign(cost)
+	assignment := optimal
+	if d.Strategy == GreedyDispatch {
+		assignment = greedy
+	}
+
+	rTrace := &trace.DispatchTrace{
+		Timestamp:       tick,
+		OptimalCost:     methods.AssignmentCost(cost, optimal),
+		GreedyCost:      methods.AssignmentCost(cost, greedy),
+		OptimalAssigned: methods.AssignmentSize(optimal),
+		GreedyAssigned:  methods.AssignmentSize(greedy),
+	}
+	for i, j := range assignment {
+		if j < 0 {
+			continue
+		}
+		if success, err := w.ClaimTask(tasks[j].GetTaskID(), robots[i].ID()); !success {
+			log.Printf("Err %+v, dispatch move on", err)
+			continue
+		}
+		if !robots[i].Assign(tasks[j]) {
+			// hand the task back, the robot can't take it
+			if err := w.TaskUpdate(tasks[j].GetTaskID(), common.Unassigned); err != nil {
+				log.Printf("Err %+v, dispatch move on", err)
+			}
+			continue
+		}
+		rTrace.Assigned++
+		rTrace.Cost += cost[i][j]
+	}
+	d.Metrics.Rounds++
+	d.Metrics.Assigned += rTrace.Assigned
+	d.Metrics.OptimalCost += rTrace.OptimalCost
+	d.Metrics.GreedyCost += rTrace.GreedyCost
+	d.Metrics.OptimalAssigned += rTrace.OptimalAssigned
+	d.Metrics.GreedyAssigned += rTrace.GreedyAssigned
+	return rTrace
+}
@@ -0,0 +1,161 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Clock is the simulation time shared by everything scheduled on an engine. Time is continuous, robots act on whole ticks
+type Clock struct {
+	now float64
+}
+
+// Now returns the current simulation time
+func (c *Clock) Now() float64 {
+	return c.now
+}
+
+// Tick returns the tick the current time falls in
+func (c *Clock) Tick() int {
+	return int(math.Floor(c.now))
+}
+
+// ScheduledEvent is something happening at a simulation time. Events at the same time run by Priority, lowest first,
+// then in the order they were scheduled
+type ScheduledEvent struct {
+	Time     float64
+	Priority int
+	Run      func()
+	seq      uint64
+}
+
+type eventQueue []*ScheduledEvent
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].Time != q[j].Time {
+		return q[i].Time < q[j].Time
+	}
+	if q[i].Priority != q[j].Priority {
+		return q[i].Priority < q[j].Priority
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*ScheduledEvent)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// Engine is a discrete-event core: it pops events in time order and moves the clock straight to each of them, skipping idle time
+type Engine struct {
+	Clock
+	queue eventQueue
+	seq   uint64
+}
+
+func CreateEngine() *Engine {
+	return &Engine{}
+}
+
+// Schedule runs fn at the given time. Events scheduled in the past run at the current time
+func (e *Engine) Schedule(at float64, priority int, fn func()) {
+	if at < e.now {
+		at = e.now
+	}
+	e.seq++
+	heap.Push(&e.queue, &ScheduledEvent{Time: at, Priority: priority, Run: fn, seq: e.seq})
+}
+
+// Reset drops the events waiting to run, and moves the clock to the given time
+func (e *Engine) Reset(now float64) {
+	e.queue = nil
+	e.now = now
+}
+
+// ScheduleAfter runs fn once the delay has passed
+func (e *Engine) ScheduleAfter(delay float64, priority int, fn func()) {
+	e.Schedule(e.now+delay, priority, fn)
+}
+
+// Pending returns the number of events waiting to run
+func (e *Engine) Pending() int {
+	return len(e.queue)
+}
+
+// Next returns the time of the next event, false when there is none
+func (e *Engine) Next() (float64, bool) {
+	if len(e.queue) == 0 {
+		return 0, false
+	}
+	return e.queue[0].Time, true
+}
+
+// Step runs the next event, moving the clock to its time. It returns false when no event is left
+func (e *Engine) Step() bool {
+	if len(e.queue) == 0 {
+		return false
+	}
+	ev := heap.Pop(&e.queue).(*ScheduledEvent)
+	e.now = ev.Time
+	ev.Run()
+	return true
+}
+
+// RunUntil runs the events up to the given time, included, and leaves the clock there
+func (e *Engine) RunUntil(until float64) {
+	for {
+		if t, ok := e.Next(); !ok || t > until {
+			break
+		}
+		e.Step()
+	}
+	if e.now < until {
+		e.now = until
+	}
+}
+
+// RunUntilStopped runs the events up to the given time like RunUntil, asking stop before the first event of every tick.
+// When stop holds, the run ends with the clock at that tick and RunUntilStopped returns true
+func (e *Engine) RunUntilStopped(until float64, stop func(tick int) bool) bool {
+	checked := -1
+	for {
+		t, ok := e.Next()
+		if !ok || t > until {
+			break
+		}
+		if tick := int(math.Floor(t)); tick > checked {
+			checked = tick
+			if stop(tick) {
+				if e.now < float64(tick) {
+					e.now = float64(tick)
+				}
+				return true
+			}
+		}
+		e.Step()
+	}
+	if e.now < until {
+		e.now = until
+	}
+	return false
+}
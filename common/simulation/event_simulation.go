@@ -0,0 +1,230 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/trace"
+	"maze/common/world"
+	"time"
+)
+
+// Events at the same time run faults first, then task arrivals, then robots in the order they were added
+const (
+	faultPriority = iota
+	arrivalPriority
+	robotPriority
+)
+
+// EventSimulation runs robots on a discrete-event engine. Robots act on whole ticks of the simulation clock, while tasks arrive
+// and robots break down at any time. Robots with nothing to do sleep until a task arrives or a robot breaks down, so idle time is skipped
+type EventSimulation struct {
+	World  common.World
+	TM     common.TaskManager
+	Engine *Engine
+	// Until is the simulation time the run ends at
+	Until float64
+	// StopWhen ends the run early, checked before the first event of every tick. It is not checked while every robot sleeps
+	StopWhen StopCondition
+	// NumRobots and Tasks are placed at random on the world before the run
+	NumRobots int
+	Tasks     int
+	// ArrivalInterval is the mean time between tasks arriving during the run, zero for no arrivals
+	ArrivalInterval float64
+	// Faults breaks robots down at the scheduled ticks, before they act, and after exponential times between failures of their type.
+	// When nil, robots never fail
+	Faults *FaultInjector
+	// Seed drives every random draw of the simulation but the faults, which the injector draws from its own seed
+	Seed int64
+
+	source      *Source
+	placement   *rand.Rand
+	arrivals    *rand.Rand
+	robots      []common.Robot
+	asleep      []bool
+	lastRun     []int
+	obs         common.Observer
+	initialized bool
+	// Control pauses, steps and paces the run between the ticks robots act on. Pacing accounts for the idle ticks skipped
+	Control
+}
+
+func CreateEventSimulation() *EventSimulation {
+	return &EventSimulation{Until: 100, NumRobots: 5, Tasks: 20}
+}
+
+func (sim *EventSimulation) Init() {
+	sim.Engine = CreateEngine()
+	sim.source = CreateSource(sim.Seed)
+	sim.placement = sim.source.Stream("placement")
+	sim.arrivals = sim.source.Stream("arrivals")
+	sim.TM = task.CreateSimulatedTaskManager()
+	sim.World = world.CreateWorld(sim.TM)
+	sim.robots = nil
+	for i := 0; i < sim.NumRobots; i++ {
+		r := robot.NewSimpleWarehouseRobot(sim.source.NewID(), sim.randomNode(), sim.World, robot.WithClock(sim.Engine.Tick))
+		r.SetRand(sim.source.Stream(fmt.Sprintf("robot/%d", i)))
+		sim.World.AddRobot(r)
+		sim.robots = append(sim.robots, r)
+	}
+	sim.asleep = make([]bool, len(sim.robots))
+	sim.lastRun = make([]int, len(sim.robots))
+	for i := 0; i < sim.Tasks; i++ {
+		sim.World.AddTask(sim.source.NewTask(sim.randomNode(), sim.randomNode()))
+	}
+	sim.initialized = true
+}
+
+func (sim *EventSimulation) randomNode() common.Location {
+	return sim.World.GetGraph().Node(int64(sim.placement.Intn(sim.World.GetGraph().Nodes().Len()) + 1))
+}
+
+// Run schedules the robots, task arrivals and failures, and runs the engine until the end time
+func (sim *EventSimulation) Run(obs common.Observer) error {
+	if !sim.initialized {
+		panic("System enter the run mode before proper initialization")
+	}
+	sim.obs = obs
+	for i := range sim.robots {
+		sim.Engine.Schedule(1, robotPriority+i, sim.act(i))
+	}
+	if sim.ArrivalInterval > 0 {
+		sim.Engine.ScheduleAfter(sim.arrivals.ExpFloat64()*sim.ArrivalInterval, arrivalPriority, sim.arrive)
+	}
+	if sim.Faults != nil {
+		sim.scheduleFaults()
+	}
+	sim.begin()
+	defer sim.end()
+	start, last := time.Now(), -1
+	sim.Engine.RunUntilStopped(sim.Until, func(tick int) bool {
+		if last >= 0 {
+			sim.done()
+		}
+		if observerErr(sim.obs) != nil || !sim.wait(tick-last) {
+			return true
+		}
+		last = tick
+		// robots act from tick 1, the ticks before this one have run
+		if tick > 0 {
+			tick--
+		}
+		return sim.StopWhen != nil && sim.StopWhen.Done(ProgressOf(sim.TM, tick, start))
+	})
+	return observerErr(obs)
+}
+
+// act runs a robot for the current tick, and schedules its next tick unless it has nothing to do
+func (sim *EventSimulation) act(i int) func() {
+	return func() {
+		r := sim.robots[i]
+		rTrace := r.Run()
+		sim.World.UpdateRobot(r)
+		sim.obs.Notify(rTrace)
+		sim.lastRun[i] = sim.Engine.Tick()
+		if idle(r, rTrace) {
+			sim.asleep[i] = true
+			return
+		}
+		sim.Engine.ScheduleAfter(1, robotPriority+i, sim.act(i))
+	}
+}
+
+// idle checks whether a robot did nothing on its tick and has nothing left to do
+func idle(r common.Robot, rTrace common.Trace) bool {
+	if _, ok := rTrace.(trace.TaskNullActionTrace); !ok {
+		return false
+	}
+	if _, t := r.GetStatus(); t != nil {
+		return false
+	}
+	if f, ok := r.(common.Faulty); ok {
+		if _, down := f.Fault(); down {
+			return false
+		}
+	}
+	return true
+}
+
+// wake schedules the sleeping robots on the next tick they haven't acted on
+func (sim *EventSimulation) wake() {
+	for i, asleep := range sim.asleep {
+		if !asleep {
+			continue
+		}
+		sim.asleep[i] = false
+		at := math.Max(math.Ceil(sim.Engine.Now()), float64(sim.lastRun[i]+1))
+		sim.Engine.Schedule(at, robotPriority+i, sim.act(i))
+	}
+}
+
+// arrive adds a random task and schedules the next arrival
+func (sim *EventSimulation) arrive() {
+	sim.World.AddTask(sim.source.NewTask(sim.randomNode(), sim.randomNode()))
+	sim.wake()
+	sim.Engine.ScheduleAfter(sim.arrivals.ExpFloat64()*sim.ArrivalInterval, arrivalPriority, sim.arrive)
+}
+
+// scheduleFaults turns the fault schedule into events, and draws the first failure of every robot with a MTBF
+func (sim *EventSimulation) scheduleFaults() {
+	for _, s := range sim.Faults.Schedule {
+		s := s
+		if s.Robot < 0 || s.Robot >= len(sim.robots) {
+			continue
+		}
+		if r, ok := sim.robots[s.Robot].(common.Faulty); ok {
+			sim.Engine.Schedule(float64(s.Tick), faultPriority, func() {
+				if _, down := r.Fault(); !down {
+					sim.breakDown(r, s.Mode, s.Duration, s.Factor)
+				}
+			})
+		}
+	}
+	for _, rb := range sim.robots {
+		if r, ok := rb.(common.Faulty); ok {
+			sim.scheduleFailure(r, 0)
+		}
+	}
+}
+
+// scheduleFailure draws the next random failure of the robot, once it is back to work after the given delay
+func (sim *EventSimulation) scheduleFailure(r common.Faulty, after float64) {
+	typ, ok := r.Type().(*robot.Type)
+	if !ok || typ.MTBF <= 0 {
+		return
+	}
+	sim.Engine.ScheduleAfter(after+sim.Faults.rand.ExpFloat64()*typ.MTBF, faultPriority, func() {
+		if _, down := r.Fault(); down {
+			sim.scheduleFailure(r, 0)
+			return
+		}
+		mode, duration := sim.Faults.sample(typ)
+		sim.breakDown(r, mode, duration, typ.DegradedFactor)
+		sim.scheduleFailure(r, float64(duration))
+	})
+}
+
+// breakDown fails the robot and wakes the sleeping robots, as a stopped robot gives its task back
+func (sim *EventSimulation) breakDown(r common.Faulty, mode common.FaultMode, duration int, factor float64) {
+	sim.obs.Notify(fail(r, mode, duration, factor, sim.Engine.Tick()))
+	sim.wake()
+}
@@ -0,0 +1,146 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/trace"
+
+	"github.com/spf13/viper"
+)
+
+// ScheduledFault breaks a robot down at a given tick. Robot is the index of the robot in the world, in the order robots were added
+type ScheduledFault struct {
+	Tick     int
+	Robot    int
+	Mode     common.FaultMode
+	Duration int
+	Factor   float64
+}
+
+// faultRecord is the form of a scheduled fault in a scenario file
+type faultRecord struct {
+	Tick     int     `mapstructure:"tick"`
+	Robot    int     `mapstructure:"robot"`
+	Mode     string  `mapstructure:"mode"`
+	Duration int     `mapstructure:"duration"`
+	Factor   float64 `mapstructure:"factor"`
+}
+
+var faultModes = map[string]common.FaultMode{
+	"stopped":   common.FaultStopped,
+	"degraded":  common.FaultDegraded,
+	"lost_comm": common.FaultLostComm,
+}
+
+// LoadFaultSchedule reads the scheduled faults listed under the faults key of a scenario file, such as
+//
+//	faults:
+//	  - {tick: 5, robot: 0, mode: stopped, duration: 10}
+//	  - {tick: 8, robot: 2, mode: degraded, duration: 4, factor: 0.5}
+func LoadFaultSchedule(path string) ([]ScheduledFault, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	var records []faultRecord
+	if err := v.UnmarshalKey("faults", &records); err != nil {
+		return nil, err
+	}
+	return decodeFaults(records)
+}
+
+func decodeFaults(records []faultRecord) ([]ScheduledFault, error) {
+	var schedule []ScheduledFault
+	for _, r := range records {
+		mode, ok := faultModes[r.Mode]
+		if !ok {
+			return nil, fmt.Errorf("unknown fault mode %q", r.Mode)
+		}
+		if r.Duration < 1 {
+			return nil, fmt.Errorf("fault at tick %d needs a positive duration", r.Tick)
+		}
+		if mode == common.FaultDegraded && (r.Factor <= 0 || r.Factor > 1) {
+			return nil, fmt.Errorf("degraded fault at tick %d needs a factor in (0, 1], got %v", r.Tick, r.Factor)
+		}
+		schedule = append(schedule, ScheduledFault{r.Tick, r.Robot, mode, r.Duration, r.Factor})
+	}
+	return schedule, nil
+}
+
+// FaultInjector breaks robots down, following the schedule and at random from the MTBF and MTTR of their type
+type FaultInjector struct {
+	Schedule []ScheduledFault
+	rand     *rand.Rand
+	src      *countedSource
+}
+
+func CreateFaultInjector(seed int64, schedule []ScheduledFault) *FaultInjector {
+	src := createCountedSource(seed)
+	return &FaultInjector{schedule, rand.New(src), src}
+}
+
+// Inject applies the faults due at the tick and returns their traces. Robots already down are left alone
+func (f *FaultInjector) Inject(w common.World, tick int) []common.Trace {
+	var traces []common.Trace
+	robots := w.GetRobots()
+	for _, s := range f.Schedule {
+		if s.Tick != tick || s.Robot < 0 || s.Robot >= len(robots) {
+			continue
+		}
+		if r, ok := robots[s.Robot].(common.Faulty); ok {
+			if _, down := r.Fault(); !down {
+				traces = append(traces, fail(r, s.Mode, s.Duration, s.Factor, tick))
+			}
+		}
+	}
+	for _, rb := range robots {
+		r, ok := rb.(common.Faulty)
+		if !ok {
+			continue
+		}
+		typ, ok := r.Type().(*robot.Type)
+		if !ok || typ.MTBF <= 0 {
+			continue
+		}
+		if _, down := r.Fault(); down || f.rand.Float64() >= 1/typ.MTBF {
+			continue
+		}
+		mode, duration := f.sample(typ)
+		traces = append(traces, fail(r, mode, duration, typ.DegradedFactor, tick))
+	}
+	return traces
+}
+
+// sample picks the mode of a random failure among the modes of the type, and its duration from the MTTR
+func (f *FaultInjector) sample(typ *robot.Type) (common.FaultMode, int) {
+	mode := common.FaultStopped
+	if len(typ.FaultModes) > 0 {
+		mode = typ.FaultModes[f.rand.Intn(len(typ.FaultModes))]
+	}
+	return mode, int(math.Max(1, math.Round(f.rand.ExpFloat64()*typ.MTTR)))
+}
+
+func fail(r common.Faulty, mode common.FaultMode, duration int, factor float64, tick int) common.Trace {
+	r.Fail(mode, duration, factor)
+	return &trace.FaultTrace{RobotID: r.ID(), Location: r.Location(), Mode: mode, Event: trace.FaultStarted, Timestamp: tick}
+}
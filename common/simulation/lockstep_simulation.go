@@ -0,0 +1,121 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/task"
+	"sync"
+)
+
+// LockstepSimulation is the concurrent mode of the CentralizedSimulation. Every robot runs on its own goroutine, and all of them
+// wait at a barrier for the tick to end before the next one starts.
+// Within a tick, robots carrying a task run in parallel, as they only meet through the task manager by completing their own task.
+// Robots which may claim a task, broken down robots, robots on a charging network, and all robots once they share their intents,
+// run alone in the order they joined the world, so every claim, blockage and charger slot is settled the way the CentralizedSimulation settles it. Runs with the same seed and settings produce the same traces
+type LockstepSimulation struct {
+	CentralizedSimulation
+	workers []*lockstepWorker
+	barrier sync.WaitGroup
+}
+
+// lockstepWorker runs a robot for a tick every time it is woken up, keeping the trace for the simulation to collect after the barrier
+type lockstepWorker struct {
+	robot common.Robot
+	wake  chan struct{}
+	trace common.Trace
+}
+
+func CreateLockstepSimulation() *LockstepSimulation {
+	sim := &LockstepSimulation{}
+	sim.defaults()
+	return sim
+}
+
+func (sim *LockstepSimulation) Init() {
+	sim.init(task.CreateSimulatedTaskManagerSync())
+}
+
+func (sim *LockstepSimulation) Run(obs common.Observer) error {
+	if !sim.initialized {
+		panic("System enter the run mode before proper initialization")
+	}
+	sim.workers = nil
+	for _, r := range sim.World.GetRobots() {
+		w := &lockstepWorker{robot: r, wake: make(chan struct{})}
+		sim.workers = append(sim.workers, w)
+		go w.run(&sim.barrier)
+	}
+	defer func() {
+		for _, w := range sim.workers {
+			close(w.wake)
+		}
+	}()
+	return sim.run(obs, sim.step)
+}
+
+func (w *lockstepWorker) run(barrier *sync.WaitGroup) {
+	for range w.wake {
+		w.trace = w.robot.Run()
+		barrier.Done()
+	}
+}
+
+// step runs the robots of a tick in batches. A batch is either a robot which must run alone, or the longest row of robots
+// after it which can run in parallel. The next batch starts once the whole batch is done
+func (sim *LockstepSimulation) step(robots []common.Robot) []common.Trace {
+	for i := 0; i < len(robots); {
+		n := 1
+		if sim.parallel(robots[i]) {
+			for i+n < len(robots) && sim.parallel(robots[i+n]) {
+				n++
+			}
+		}
+		sim.barrier.Add(n)
+		for _, w := range sim.workers[i : i+n] {
+			w.wake <- struct{}{}
+		}
+		sim.barrier.Wait()
+		i += n
+	}
+	traces := make([]common.Trace, len(robots))
+	for i, w := range sim.workers {
+		traces[i] = w.trace
+	}
+	return traces
+}
+
+// parallel checks whether the robot leaves the other robots alone for the tick: it carries a task, works, keeps its intents to itself
+// and takes no charger slot
+func (sim *LockstepSimulation) parallel(r common.Robot) bool {
+	if sim.CommRange > 0 {
+		return false
+	}
+	if c, ok := r.(robot.ChargerUser); ok && c.UsesChargers() {
+		return false
+	}
+	if _, t := r.GetStatus(); t == nil {
+		return false
+	}
+	if f, ok := r.(common.Faulty); ok {
+		if _, down := f.Fault(); down {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,450 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/world"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Scenario describes a simulation run: the map, the fleet and where it starts, how tasks arrive, how robots plan, for how long, and where the traces go
+type Scenario struct {
+	// Mode is centralized, or lockstep to run the robots in parallel
+	Mode     string
+	Seed     int64
+	Duration int
+	// Edges lay out the world, empty for the 12 node network. Layout places the nodes on the floor for robots tracking their heading
+	Edges  [][2]int64
+	Layout world.Layout
+	Fleet  []RobotSpec
+	// Tasks are placed before the run, then tasks arrive every ArrivalInterval ticks on average
+	Tasks           int
+	ArrivalInterval float64
+	Options         []robot.Option
+	Idle            robot.IdleStrategy
+	Faults          []ScheduledFault
+	// Stop ends the run before Duration, a zero Duration leaves the run to the stop settings
+	Stop   StopSettings
+	Output ScenarioOutput
+}
+
+// StopSettings end a run on whichever of the set conditions holds first
+type StopSettings struct {
+	WallTime       time.Duration `mapstructure:"wall_time"`
+	AllTasksDone   bool          `mapstructure:"all_tasks_done"`
+	TasksCompleted int           `mapstructure:"tasks_completed"`
+	// Steady stops the run once the tasks completed in each of the last Windows spans of Window ticks stay within Tolerance of their mean
+	Steady *SteadySettings `mapstructure:"steady"`
+}
+
+type SteadySettings struct {
+	Window    int     `mapstructure:"window"`
+	Windows   int     `mapstructure:"windows"`
+	Tolerance float64 `mapstructure:"tolerance"`
+}
+
+// Condition returns the stop condition of the settings for a run, nil when none is set
+func (s StopSettings) Condition() StopCondition {
+	var conds []StopCondition
+	if s.WallTime > 0 {
+		conds = append(conds, MaxWallTime(s.WallTime))
+	}
+	if s.AllTasksDone {
+		conds = append(conds, AllTasksDone())
+	}
+	if s.TasksCompleted > 0 {
+		conds = append(conds, TasksCompleted(s.TasksCompleted))
+	}
+	if s.Steady != nil {
+		conds = append(conds, SteadyState(s.Steady.Window, s.Steady.Windows, s.Steady.Tolerance))
+	}
+	if len(conds) == 0 {
+		return nil
+	}
+	return Any(conds...)
+}
+
+// ScenarioOutput tells where the traces of a run go. An empty Traces leaves them to the caller, - writes them to the standard output
+type ScenarioOutput struct {
+	Traces string
+	// Format is json for a JSON object per line, or text
+	Format string
+}
+
+type scenarioRecord struct {
+	Mode     string        `mapstructure:"mode"`
+	Seed     int64         `mapstructure:"seed"`
+	Duration int           `mapstructure:"duration"`
+	Map      mapRecord     `mapstructure:"map"`
+	Robots   int           `mapstructure:"robots"`
+	Fleet    []fleetRecord `mapstructure:"fleet"`
+	Tasks    taskRecord    `mapstructure:"tasks"`
+	Planner  string        `mapstructure:"planner"`
+	TurnCost float64       `mapstructure:"turn_cost"`
+	Selector string        `mapstructure:"selector"`
+	Idle     idleRecord    `mapstructure:"idle"`
+	Faults   []faultRecord `mapstructure:"faults"`
+	Stop     StopSettings  `mapstructure:"stop"`
+	Output   outputRecord  `mapstructure:"output"`
+}
+
+type mapRecord struct {
+	Edges  [][]int64     `mapstructure:"edges"`
+	Layout []pointRecord `mapstructure:"layout"`
+}
+
+type pointRecord struct {
+	Node int64 `mapstructure:"node"`
+	X    int   `mapstructure:"x"`
+	Y    int   `mapstructure:"y"`
+}
+
+// fleetRecord is a group of robots sharing a type. Count defaults to the number of start nodes, robots without one start at random
+type fleetRecord struct {
+	Type         string   `mapstructure:"type"`
+	Count        int      `mapstructure:"count"`
+	Start        []int64  `mapstructure:"start"`
+	Speed        float64  `mapstructure:"speed"`
+	Capacity     int      `mapstructure:"capacity"`
+	Capabilities []string `mapstructure:"capabilities"`
+}
+
+type taskRecord struct {
+	Initial  int     `mapstructure:"initial"`
+	Interval float64 `mapstructure:"interval"`
+}
+
+type idleRecord struct {
+	Strategy string  `mapstructure:"strategy"`
+	Parking  []int64 `mapstructure:"parking"`
+	Decay    float64 `mapstructure:"decay"`
+}
+
+type outputRecord struct {
+	Traces string `mapstructure:"traces"`
+	Format string `mapstructure:"format"`
+}
+
+// LoadScenario reads a scenario file, such as
+//
+//	mode: lockstep
+//	seed: 7
+//	duration: 200
+//	fleet:
+//	  - {count: 3, start: [1, 5, 9]}
+//	  - {type: slow, count: 2, speed: 0.5, capacity: 2}
+//	tasks: {initial: 10, interval: 4}
+//	planner: turn-aware
+//	selector: nearest
+//	idle: {strategy: spread}
+//	faults:
+//	  - {tick: 5, robot: 0, mode: stopped, duration: 10}
+//	stop: {wall_time: 30s, tasks_completed: 50, steady: {window: 20, windows: 3, tolerance: 0.1}}
+//	output: {traces: traces.jsonl, format: json}
+//
+// The map defaults to the 12 node network, and takes a list of edges such as map: {edges: [[1, 2], [2, 3]]}
+func LoadScenario(path string) (*Scenario, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return DecodeScenario(v)
+}
+
+// DecodeScenario reads a scenario from a configuration already loaded
+func DecodeScenario(v *viper.Viper) (*Scenario, error) {
+	v.SetDefault("mode", "centralized")
+	v.SetDefault("duration", 100)
+	v.SetDefault("robots", 5)
+	v.SetDefault("tasks.initial", 20)
+	v.SetDefault("idle.decay", 0.9)
+	v.SetDefault("output.format", "json")
+	var rec scenarioRecord
+	if err := v.Unmarshal(&rec); err != nil {
+		return nil, err
+	}
+	if rec.Mode != "centralized" && rec.Mode != "lockstep" {
+		return nil, fmt.Errorf("unknown simulation mode %q", rec.Mode)
+	}
+	if rec.Output.Format != "json" && rec.Output.Format != "text" {
+		return nil, fmt.Errorf("unknown output format %q", rec.Output.Format)
+	}
+	sc := &Scenario{
+		Mode:            rec.Mode,
+		Seed:            rec.Seed,
+		Duration:        rec.Duration,
+		Tasks:           rec.Tasks.Initial,
+		ArrivalInterval: rec.Tasks.Interval,
+		Stop:            rec.Stop,
+		Output:          ScenarioOutput{rec.Output.Traces, rec.Output.Format},
+	}
+	if steady := rec.Stop.Steady; steady != nil && (steady.Window < 1 || steady.Windows < 2) {
+		return nil, fmt.Errorf("steady state needs a window of at least a tick, over at least 2 windows")
+	}
+	if sc.Duration <= 0 && sc.Stop.Condition() == nil {
+		return nil, fmt.Errorf("scenario needs a duration or a stop condition")
+	}
+	var err error
+	if sc.Edges, sc.Layout, err = decodeMap(rec.Map); err != nil {
+		return nil, err
+	}
+	if sc.Fleet, err = decodeFleet(rec.Fleet, rec.Robots); err != nil {
+		return nil, err
+	}
+	if err = checkStarts(sc.Fleet, mapSize(sc.Edges)); err != nil {
+		return nil, err
+	}
+	if sc.Options, err = sc.decodeStrategies(rec.Planner, rec.TurnCost, rec.Selector); err != nil {
+		return nil, err
+	}
+	if sc.Idle, err = decodeIdle(rec.Idle); err != nil {
+		return nil, err
+	}
+	if sc.Faults, err = decodeFaults(rec.Faults); err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+// decodeMap checks the nodes of the edges are numbered from 1 without gaps, as robots and tasks are placed by number
+func decodeMap(m mapRecord) ([][2]int64, world.Layout, error) {
+	layout := world.WarehouseLayout()
+	if len(m.Layout) > 0 {
+		layout = make(world.Layout)
+		for _, p := range m.Layout {
+			layout[p.Node] = world.Point{X: p.X, Y: p.Y}
+		}
+	}
+	if len(m.Edges) == 0 {
+		return nil, layout, nil
+	}
+	var edges [][2]int64
+	nodes := make(map[int64]bool)
+	for _, e := range m.Edges {
+		if len(e) != 2 || e[0] == e[1] {
+			return nil, nil, fmt.Errorf("edge %v needs two distinct nodes", e)
+		}
+		edges = append(edges, [2]int64{e[0], e[1]})
+		nodes[e[0]], nodes[e[1]] = true, true
+	}
+	for i := int64(1); i <= int64(len(nodes)); i++ {
+		if !nodes[i] {
+			return nil, nil, fmt.Errorf("map nodes must be numbered from 1 to %d, %d is missing", len(nodes), i)
+		}
+	}
+	return edges, layout, nil
+}
+
+// mapSize returns the number of nodes of the map laid out by the edges, numbered from 1 without gaps, or of the 12 node network
+func mapSize(edges [][2]int64) int {
+	if len(edges) == 0 {
+		return world.CreateWarehouseWorld().GetGraph().Nodes().Len()
+	}
+	n := int64(0)
+	for _, e := range edges {
+		if e[0] > n {
+			n = e[0]
+		}
+		if e[1] > n {
+			n = e[1]
+		}
+	}
+	return int(n)
+}
+
+// checkStarts checks the robots of the fleet start on nodes of the map, a zero start places the robot at random
+func checkStarts(fleet []RobotSpec, nodes int) error {
+	for i, spec := range fleet {
+		if spec.Start < 0 || spec.Start > int64(nodes) {
+			return fmt.Errorf("robot %d starts on node %d, the map has nodes 1 to %d", i, spec.Start, nodes)
+		}
+	}
+	return nil
+}
+
+// decodeFleet lists the robots of the groups, or robots robots of the default type when there are no groups
+func decodeFleet(groups []fleetRecord, robots int) ([]RobotSpec, error) {
+	if len(groups) == 0 {
+		return make([]RobotSpec, robots), nil
+	}
+	reg := robot.CreateTypeRegistry()
+	var fleet []RobotSpec
+	for i, g := range groups {
+		count := g.Count
+		if count == 0 {
+			count = len(g.Start)
+		}
+		if count < 1 || len(g.Start) > count {
+			return nil, fmt.Errorf("fleet group %d needs a count of at least its %d start nodes", i, len(g.Start))
+		}
+		typ, err := decodeType(reg, i, g)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < count; j++ {
+			spec := RobotSpec{Type: typ}
+			if j < len(g.Start) {
+				spec.Start = g.Start[j]
+			}
+			fleet = append(fleet, spec)
+		}
+	}
+	return fleet, nil
+}
+
+// decodeType registers the type of a fleet group, nil for groups of the default type
+func decodeType(reg *robot.TypeRegistry, i int, g fleetRecord) (*robot.Type, error) {
+	if (g.Type == "" || g.Type == robot.DefaultType.Name) && g.Speed == 0 && g.Capacity == 0 && len(g.Capabilities) == 0 {
+		return nil, nil
+	}
+	typ := &robot.Type{Name: g.Type, Speed: g.Speed, Capacity: g.Capacity}
+	if typ.Name == "" {
+		typ.Name = fmt.Sprintf("fleet/%d", i)
+	}
+	if typ.Speed == 0 {
+		typ.Speed = robot.DefaultType.Speed
+	}
+	if typ.Capacity == 0 {
+		typ.Capacity = robot.DefaultType.Capacity
+	}
+	for _, c := range g.Capabilities {
+		typ.Capabilities = append(typ.Capabilities, common.Capability(c))
+	}
+	return typ, reg.Register(typ)
+}
+
+func (sc *Scenario) decodeStrategies(planner string, turnCost float64, selector string) ([]robot.Option, error) {
+	var opts []robot.Option
+	switch planner {
+	case "", "shortest":
+	case "turn-aware":
+		opts = append(opts, robot.WithLayout(sc.Layout), robot.WithPathPlanner(robot.TurnAware{Layout: sc.Layout, TurnCost: turnCost}))
+	default:
+		return nil, fmt.Errorf("unknown planner %q", planner)
+	}
+	switch selector {
+	case "", "first":
+	case "nearest":
+		opts = append(opts, robot.WithTaskSelector(robot.NearestTask{}))
+	default:
+		return nil, fmt.Errorf("unknown task selector %q", selector)
+	}
+	return opts, nil
+}
+
+func decodeIdle(idle idleRecord) (robot.IdleStrategy, error) {
+	switch idle.Strategy {
+	case "", "stay":
+		return nil, nil
+	case "spread":
+		return robot.CreateSpreadOut(), nil
+	case "parking":
+		if len(idle.Parking) == 0 {
+			return nil, fmt.Errorf("parking idle strategy needs parking nodes")
+		}
+		return robot.CreateNearestParking(idle.Parking...), nil
+	case "hotspots":
+		return robot.CreateDemandHotspots(idle.Decay), nil
+	default:
+		return nil, fmt.Errorf("unknown idle strategy %q", idle.Strategy)
+	}
+}
+
+// SetRobots sizes the fleet to n robots, dropping the last ones or adding robots of the default type on random nodes
+func (sc *Scenario) SetRobots(n int) {
+	if n < len(sc.Fleet) {
+		sc.Fleet = sc.Fleet[:n]
+	}
+	for len(sc.Fleet) < n {
+		sc.Fleet = append(sc.Fleet, RobotSpec{})
+	}
+}
+
+// Simulation creates the simulation of the scenario, to be initialized before it runs
+func (sc *Scenario) Simulation() common.Simulation {
+	if sc.Mode == "lockstep" {
+		l := CreateLockstepSimulation()
+		sc.configure(&l.CentralizedSimulation)
+		return l
+	}
+	c := CreateCentralizedSimulation()
+	sc.configure(c)
+	return c
+}
+
+func (sc *Scenario) configure(sim *CentralizedSimulation) {
+	sim.Seed = sc.Seed
+	sim.Iterations = sc.Duration
+	sim.Edges = sc.Edges
+	sim.Fleet = sc.Fleet
+	sim.Tasks = sc.Tasks
+	sim.ArrivalInterval = sc.ArrivalInterval
+	sim.Options = sc.Options
+	sim.Idle = sc.Idle
+	sim.StopWhen = sc.Stop.Condition()
+	if len(sc.Faults) > 0 {
+		sim.Faults = CreateFaultInjector(sc.Seed, sc.Faults)
+	}
+}
+
+// TraceWriter is an observer writing every trace of a run on its own line, as a JSON object with the type of the trace, or as text
+type TraceWriter struct {
+	w    io.Writer
+	text bool
+	err  error
+}
+
+// CreateTraceWriter writes the traces in the json or text format
+func CreateTraceWriter(w io.Writer, format string) *TraceWriter {
+	return &TraceWriter{w: w, text: format == "text"}
+}
+
+func (t *TraceWriter) Notify(data interface{}) {
+	if _, ok := data.(common.Trace); !ok || t.err != nil {
+		return
+	}
+	if t.text {
+		_, t.err = fmt.Fprintf(t.w, "%T %+v\n", data, data)
+		return
+	}
+	line, err := json.Marshal(struct {
+		Type  string
+		Trace interface{}
+	}{fmt.Sprintf("%T", data), data})
+	if err != nil {
+		t.err = err
+		return
+	}
+	_, t.err = fmt.Fprintf(t.w, "%s\n", line)
+}
+
+func (t *TraceWriter) GetChannel() chan interface{} {
+	return nil
+}
+
+// Err returns the first error writing the traces
+func (t *TraceWriter) Err() error {
+	return t.err
+}
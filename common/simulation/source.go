@@ -0,0 +1,167 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"maze/common"
+	"maze/common/methods"
+	"maze/common/task"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Source hands out everything random in a simulation from a single seed: a named random stream per component,
+// the IDs of robots and tasks, and the origination times of tasks. Runs with the same seed and config are identical
+type Source struct {
+	Seed   int64
+	ids    *rand.Rand
+	stamps int64
+	// drawn counts the IDs drawn, streams lists the streams handed out in order
+	drawn   uint64
+	streams []*stream
+}
+
+// Epoch is the origination time of the first task of a seeded simulation, later tasks originate a nanosecond apart
+var Epoch = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func CreateSource(seed int64) *Source {
+	s := &Source{Seed: seed}
+	s.ids = s.Stream("ids")
+	return s
+}
+
+// Stream returns the random stream of a component. Streams of different names are independent of each other,
+// so adding draws to one component leaves the others unchanged
+func (s *Source) Stream(name string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	st := &stream{name: name, src: createCountedSource(s.Seed ^ int64(h.Sum64()))}
+	st.rand = rand.New(st.src)
+	s.streams = append(s.streams, st)
+	return st.rand
+}
+
+// NewID draws the next robot or task ID
+func (s *Source) NewID() uuid.UUID {
+	s.drawn++
+	return methods.RandomID(s.ids)
+}
+
+// NewTask creates a task between two nodes, with the next ID and origination time
+func (s *Source) NewTask(origin, destination common.Location) *task.TimePriorityTask {
+	t := task.NewTimePriorityTaskWithParameter(origin, destination)
+	t.ID = s.NewID()
+	s.stamps++
+	t.OriginationTime = Epoch.Add(time.Duration(s.stamps))
+	return t
+}
+
+// stream is a named random stream handed out by a source
+type stream struct {
+	name string
+	src  *countedSource
+	rand *rand.Rand
+}
+
+// countedSource is a random source counting its draws, so its state is saved as the draws since it was seeded
+type countedSource struct {
+	seed  int64
+	src   rand.Source64
+	draws uint64
+}
+
+func createCountedSource(seed int64) *countedSource {
+	return &countedSource{seed: seed, src: rand.NewSource(seed).(rand.Source64)}
+}
+
+func (c *countedSource) Int63() int64 {
+	c.draws++
+	return c.src.Int63()
+}
+
+func (c *countedSource) Uint64() uint64 {
+	c.draws++
+	return c.src.Uint64()
+}
+
+func (c *countedSource) Seed(seed int64) {
+	c.seed, c.draws = seed, 0
+	c.src.Seed(seed)
+}
+
+// rewind seeds the random stream of the source again and draws until the source is back to the given draws
+func (c *countedSource) rewind(r *rand.Rand, draws uint64) {
+	r.Seed(c.seed)
+	for c.draws < draws {
+		c.Int63()
+	}
+}
+
+// StreamState is the serializable state of a random stream, the draws since it was seeded
+type StreamState struct {
+	Name  string `json:"name"`
+	Draws uint64 `json:"draws"`
+}
+
+// SourceState is the serializable state of a source and of the streams it handed out, in order
+type SourceState struct {
+	Seed    int64         `json:"seed"`
+	Stamps  int64         `json:"stamps"`
+	IDs     uint64        `json:"ids"`
+	Streams []StreamState `json:"streams"`
+}
+
+// Snapshot saves the state of the source and its streams
+func (s *Source) Snapshot() SourceState {
+	st := SourceState{Seed: s.Seed, Stamps: s.stamps, IDs: s.drawn}
+	for _, str := range s.streams {
+		st.Streams = append(st.Streams, StreamState{str.name, str.src.draws})
+	}
+	return st
+}
+
+// Restore puts the source and its streams back in a saved state. The source must have handed out the same streams, in the same order,
+// which a simulation set up the same way does. IDs are drawn again, as they are read off the ID stream bytes at a time
+func (s *Source) Restore(st SourceState) error {
+	if st.Seed != s.Seed {
+		return fmt.Errorf("state of the source of seed %d can't be restored onto seed %d", st.Seed, s.Seed)
+	}
+	if len(st.Streams) != len(s.streams) {
+		return fmt.Errorf("expected %d random streams, the source handed out %d", len(st.Streams), len(s.streams))
+	}
+	for i, str := range st.Streams {
+		if s.streams[i].name != str.Name {
+			return fmt.Errorf("random stream %d is %q instead of %q", i, s.streams[i].name, str.Name)
+		}
+	}
+	for i, str := range st.Streams {
+		if cur := s.streams[i]; cur.rand == s.ids {
+			cur.src.rewind(cur.rand, 0)
+		} else {
+			cur.src.rewind(cur.rand, str.Draws)
+		}
+	}
+	for s.drawn = 0; s.drawn < st.IDs; {
+		s.NewID()
+	}
+	s.stamps = st.Stamps
+	return nil
+}
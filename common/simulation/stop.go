@@ -0,0 +1,204 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package simulation
+
+import (
+	"maze/common"
+	"sync"
+	"time"
+)
+
+// Progress is where a run stands, for stop conditions to decide whether it is over. Tick is the number of ticks run so far.
+// Waiting tasks are yet to be claimed, Active ones are carried out and Completed ones are done
+type Progress struct {
+	Tick      int
+	Elapsed   time.Duration
+	Waiting   int
+	Active    int
+	Completed int
+}
+
+// taskCounter is implemented by the task managers keeping count of active and completed tasks
+type taskCounter interface {
+	ActiveCount() int
+	FinishedCount() int
+}
+
+// ProgressOf reads the progress of a run from its task manager. Active and completed tasks are only counted by the simulated task managers
+func ProgressOf(tm common.TaskManager, tick int, start time.Time) Progress {
+	p := Progress{Tick: tick, Elapsed: time.Since(start), Waiting: len(tm.GetAllTasks())}
+	if c, ok := tm.(taskCounter); ok {
+		p.Active = c.ActiveCount()
+		p.Completed = c.FinishedCount()
+	}
+	return p
+}
+
+// StopCondition decides whether a run is over. Conditions may keep track of the progress they are given, a condition serves a single run
+type StopCondition interface {
+	Done(p Progress) bool
+}
+
+// StopFunc is a custom stop condition
+type StopFunc func(p Progress) bool
+
+func (f StopFunc) Done(p Progress) bool {
+	return f(p)
+}
+
+// MaxTicks stops the run once it ran n ticks
+func MaxTicks(n int) StopCondition {
+	return StopFunc(func(p Progress) bool { return p.Tick >= n })
+}
+
+// MaxWallTime stops the run once it took d of real time
+func MaxWallTime(d time.Duration) StopCondition {
+	return StopFunc(func(p Progress) bool { return p.Elapsed >= d })
+}
+
+// AllTasksDone stops the run once no task is waiting or carried out
+func AllTasksDone() StopCondition {
+	return StopFunc(func(p Progress) bool { return p.Waiting == 0 && p.Active == 0 })
+}
+
+// NoTasksWaiting stops the run once every task is claimed, while robots may still carry some out
+func NoTasksWaiting() StopCondition {
+	return StopFunc(func(p Progress) bool { return p.Waiting == 0 })
+}
+
+// TasksCompleted stops the run once n tasks are completed
+func TasksCompleted(n int) StopCondition {
+	return StopFunc(func(p Progress) bool { return p.Completed >= n })
+}
+
+// steadyState samples the throughput of the run every window ticks
+type steadyState struct {
+	window     int
+	windows    int
+	tolerance  float64
+	sampled    int
+	completed  int
+	throughput []int
+}
+
+// SteadyState stops the run once its throughput settles: the tasks completed in each of the last windows spans of window ticks
+// stay within tolerance times their mean of each other. A run completing nothing over all of them is still warming up, not steady
+func SteadyState(window, windows int, tolerance float64) StopCondition {
+	return &steadyState{window: window, windows: windows, tolerance: tolerance}
+}
+
+func (s *steadyState) Done(p Progress) bool {
+	if p.Tick-s.sampled < s.window {
+		return false
+	}
+	s.throughput = append(s.throughput, p.Completed-s.completed)
+	if len(s.throughput) > s.windows {
+		s.throughput = s.throughput[1:]
+	}
+	s.sampled, s.completed = p.Tick, p.Completed
+	if len(s.throughput) < s.windows {
+		return false
+	}
+	low, high, total := s.throughput[0], s.throughput[0], 0
+	for _, n := range s.throughput {
+		if n < low {
+			low = n
+		}
+		if n > high {
+			high = n
+		}
+		total += n
+	}
+	return total > 0 && float64(high-low) <= s.tolerance*float64(total)/float64(len(s.throughput))
+}
+
+// Any stops the run once one of the conditions holds. Every condition sees every progress, so conditions keeping track of it stay up to date
+func Any(conds ...StopCondition) StopCondition {
+	return StopFunc(func(p Progress) bool {
+		done := false
+		for _, c := range conds {
+			if c.Done(p) {
+				done = true
+			}
+		}
+		return done
+	})
+}
+
+// All stops the run once all of the conditions hold. Every condition sees every progress
+func All(conds ...StopCondition) StopCondition {
+	return StopFunc(func(p Progress) bool {
+		done := true
+		for _, c := range conds {
+			if !c.Done(p) {
+				done = false
+			}
+		}
+		return done
+	})
+}
+
+// Finish tells free running simulations their run is over. Their run loops check the stop condition after every step,
+// and the done channel is closed once it holds or the run is stopped. A paused run isn't checked until it goes on
+type Finish struct {
+	m        sync.Mutex
+	cond     StopCondition
+	progress func() Progress
+	done     chan struct{}
+	closed   bool
+}
+
+// CreateFinish checks the condition on the progress read from the function
+func CreateFinish(cond StopCondition, progress func() Progress) *Finish {
+	return &Finish{cond: cond, progress: progress, done: make(chan struct{})}
+}
+
+// Check checks the condition on the current progress, ending the run once it holds. It returns whether the run is over
+func (f *Finish) Check() bool {
+	f.m.Lock()
+	defer f.m.Unlock()
+	if !f.closed && f.cond.Done(f.progress()) {
+		f.close()
+	}
+	return f.closed
+}
+
+// Close ends the run, whatever the condition
+func (f *Finish) Close() {
+	f.m.Lock()
+	defer f.m.Unlock()
+	f.close()
+}
+
+// close closes the done channel once, the lock must be held
+func (f *Finish) close() {
+	if !f.closed {
+		close(f.done)
+		f.closed = true
+	}
+}
+
+// Done returns the channel closed once the run is over
+func (f *Finish) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the run is over. The condition is checked once up front, in case it holds before any step
+func (f *Finish) Wait() {
+	f.Check()
+	<-f.done
+}
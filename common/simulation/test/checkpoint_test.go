@@ -0,0 +1,211 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/simulation"
+	"maze/common/world"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// splitObserver records the traces of the ticks from a given one on
+type splitObserver struct {
+	from  int
+	tick  int
+	after recordingObserver
+}
+
+func (o *splitObserver) Notify(data interface{}) {
+	if _, ok := data.(struct{}); ok {
+		o.tick++
+	} else if o.tick >= o.from {
+		o.after.Notify(data)
+	}
+}
+func (o *splitObserver) GetChannel() chan interface{} {
+	return nil
+}
+
+func checkpointSettings(s *simulation.CentralizedSimulation, iterations int) {
+	s.Seed = 5
+	s.Iterations = iterations
+	s.Idle = robot.CreateDemandHotspots(0.9)
+	s.NumRobots = 4
+	s.Tasks = 5
+	s.ArrivalInterval = 2
+	s.Faults = simulation.CreateFaultInjector(5, []simulation.ScheduledFault{
+		{Tick: 20, Robot: 1, Mode: common.FaultStopped, Duration: 50},
+		{Tick: 25, Robot: 3, Mode: common.FaultDegraded, Duration: 20, Factor: 0.5},
+	})
+}
+
+// runsOnLikeWhole checks that branches off a checkpoint taken at the tick run on like the whole run, and returns the checkpoint
+func runsOnLikeWhole(t *testing.T, settings func(s *simulation.CentralizedSimulation, iterations int), at, iterations int) *simulation.Checkpoint {
+	whole := simulation.CreateCentralizedSimulation()
+	settings(whole, iterations)
+	whole.Init()
+	expected := &splitObserver{from: at}
+	whole.Run(expected)
+
+	first := simulation.CreateCentralizedSimulation()
+	settings(first, at)
+	first.Init()
+	first.Run(&recordingObserver{})
+	cp, err := first.Checkpoint()
+	if err != nil {
+		t.Fatalf("Expect the simulation to be saved, got %v", err)
+	}
+	dir, err := ioutil.TempDir("", "checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint.json")
+	if err := simulation.SaveCheckpoint(cp, path); err != nil {
+		t.Fatalf("Expect the checkpoint to be written, got %v", err)
+	}
+
+	// two branches off the same checkpoint run on like the whole run
+	for i := 0; i < 2; i++ {
+		loaded, err := simulation.LoadCheckpoint(path)
+		if err != nil {
+			t.Fatalf("Expect the checkpoint to be read, got %v", err)
+		}
+		branch := simulation.CreateCentralizedSimulation()
+		settings(branch, iterations)
+		branch.Init()
+		if err := branch.Restore(loaded); err != nil {
+			t.Fatalf("Expect the checkpoint to be restored, got %v", err)
+		}
+		actual := recordingObserver{}
+		branch.Run(&actual)
+		if expected.after.buf.Len() == 0 || !bytes.Equal(expected.after.buf.Bytes(), actual.buf.Bytes()) {
+			t.Errorf("branch %d: expect the restored simulation to run on like the whole run", i)
+		}
+	}
+	return cp
+}
+
+func TestRestoredCheckpointRunsOn(t *testing.T) {
+	cp := runsOnLikeWhole(t, checkpointSettings, 30, 120)
+	if len(cp.World.Blocked) == 0 {
+		t.Errorf("Expect the checkpoint to hold the node blocked by the stopped robot")
+	}
+}
+
+func TestRestoredCheckpointKeepsDispatchAndChargers(t *testing.T) {
+	settings := func(s *simulation.CentralizedSimulation, iterations int) {
+		s.Seed = 3
+		s.Iterations = iterations
+		s.Tasks = 10
+		s.ArrivalInterval = 3
+		s.Dispatcher = simulation.CreateDispatcher(simulation.OptimalDispatch, 2)
+		s.Chargers = world.CreateChargingNetwork()
+		s.Chargers.AddStation(simple.Node(3), 1, 1)
+		typ := &robot.Type{Name: "battery", Speed: 1, Capacity: 1, Battery: robot.NewBattery(12, 1, 0, 0, 6)}
+		s.Fleet = []simulation.RobotSpec{{Type: typ}, {Type: typ}, {Type: typ}}
+	}
+	cp := runsOnLikeWhole(t, settings, 30, 120)
+	if cp.Dispatch == nil || cp.Dispatch.Rounds != 15 {
+		t.Errorf("Expect the checkpoint to hold the dispatch rounds so far, actual %+v", cp.Dispatch)
+	}
+	if len(cp.Chargers) == 0 {
+		t.Errorf("Expect the checkpoint to hold the robots charging")
+	}
+}
+
+func TestRestoredCheckpointKeepsLocalWorldsAndIntents(t *testing.T) {
+	synced := func(s *simulation.CentralizedSimulation, iterations int) {
+		checkpointSettings(s, iterations)
+		s.Sync = &simulation.SyncSettings{Delay: 3, Interval: 2}
+	}
+	cp := runsOnLikeWhole(t, synced, 31, 120)
+	if cp.Sync == nil || len(cp.Sync.Local) != 4 || len(cp.Sync.Local[0].Pending) == 0 {
+		t.Errorf("Expect the checkpoint to hold the local worlds with the changes on their way, actual %+v", cp.Sync)
+	}
+
+	communicating := func(s *simulation.CentralizedSimulation, iterations int) {
+		checkpointSettings(s, iterations)
+		s.CommRange = 3
+	}
+	cp = runsOnLikeWhole(t, communicating, 10, 120)
+	if cp.Comm == nil || len(cp.Comm.Bots) != 4 {
+		t.Errorf("Expect the checkpoint to hold the intents of the robots, actual %+v", cp.Comm)
+	}
+}
+
+func TestCheckpointWhilePaused(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	checkpointSettings(s, 1000)
+	s.Init()
+	s.Pause()
+	obs := &lockedTickObserver{}
+	finished := make(chan struct{})
+	go func() {
+		s.Run(obs)
+		close(finished)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		s.Step()
+	}
+	cp, err := s.Checkpoint()
+	s.Stop()
+	<-finished
+	if err != nil {
+		t.Fatalf("Expect the paused simulation to be saved, got %v", err)
+	}
+	if cp.Tick != 5 {
+		t.Errorf("Expect the paused simulation to be saved after its 5 ticks, actual %d", cp.Tick)
+	}
+}
+
+func TestCheckpointRejectsMismatches(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Init()
+	cp, err := s.Checkpoint()
+	if err != nil {
+		t.Fatalf("Expect the simulation to be saved, got %v", err)
+	}
+	synced := simulation.CreateCentralizedSimulation()
+	synced.Sync = &simulation.SyncSettings{Delay: 1, Interval: 1}
+	synced.Init()
+	if err := synced.Restore(cp); err == nil {
+		t.Errorf("Expect a checkpoint without local worlds to be refused by a simulation with local worlds")
+	}
+	other := simulation.CreateCentralizedSimulation()
+	other.Seed = 1
+	other.Init()
+	if err := other.Restore(cp); err == nil {
+		t.Errorf("Expect a checkpoint to be refused by a simulation of another seed")
+	}
+	bigger := simulation.CreateCentralizedSimulation()
+	bigger.NumRobots = 6
+	bigger.Init()
+	if err := bigger.Restore(cp); err == nil {
+		t.Errorf("Expect a checkpoint to be refused by a simulation of another fleet")
+	}
+}
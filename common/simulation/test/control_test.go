@@ -0,0 +1,200 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"maze/common"
+	"maze/common/simulation"
+	"sync"
+	"testing"
+	"time"
+)
+
+// lockedTickObserver counts the ticks of a run watched from another goroutine
+type lockedTickObserver struct {
+	m     sync.Mutex
+	ticks int
+}
+
+func (o *lockedTickObserver) Notify(data interface{}) {
+	if _, ok := data.(struct{}); ok {
+		o.m.Lock()
+		o.ticks++
+		o.m.Unlock()
+	}
+}
+func (o *lockedTickObserver) GetChannel() chan interface{} {
+	return nil
+}
+func (o *lockedTickObserver) count() int {
+	o.m.Lock()
+	defer o.m.Unlock()
+	return o.ticks
+}
+
+func TestSimulationPauseStepResume(t *testing.T) {
+	for name, s := range map[string]common.Simulation{
+		"centralized": simulation.CreateCentralizedSimulation(),
+		"lockstep":    simulation.CreateLockstepSimulation(),
+	} {
+		s.Init()
+		s.Pause()
+		obs := &lockedTickObserver{}
+		finished := make(chan struct{})
+		go func() {
+			s.Run(obs)
+			close(finished)
+		}()
+		time.Sleep(20 * time.Millisecond)
+		if obs.count() != 0 {
+			t.Errorf("%s: expect a paused simulation to hold before its first tick", name)
+		}
+		for i := 1; i <= 3; i++ {
+			s.Step()
+			if obs.count() != i {
+				t.Errorf("%s: expect %d ticks after %d steps, actual %d", name, i, i, obs.count())
+			}
+		}
+		// the remaining 7 ticks take at least 60ms at a hundred times real time
+		s.SetSpeed(100)
+		start := time.Now()
+		s.Resume()
+		select {
+		case <-finished:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: expect the simulation to finish once resumed", name)
+		}
+		if elapsed := time.Since(start); obs.count() != 10 || elapsed < 60*time.Millisecond {
+			t.Errorf("%s: expect the paced run to finish its 10 ticks in real time, %d ticks in %s", name, obs.count(), elapsed)
+		}
+	}
+}
+
+// slowTickObserver counts the ticks of a run, and draws every tick out so that steps come in while it is under way
+type slowTickObserver struct {
+	lockedTickObserver
+}
+
+func (o *slowTickObserver) Notify(data interface{}) {
+	if _, ok := data.(struct{}); ok {
+		time.Sleep(time.Millisecond)
+	}
+	o.lockedTickObserver.Notify(data)
+}
+
+func TestConcurrentSteps(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Iterations = 1000
+	s.Init()
+	s.Pause()
+	obs := &slowTickObserver{}
+	finished := make(chan struct{})
+	go func() {
+		s.Run(obs)
+		close(finished)
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	// every step takes a tick of its own, and returns once as many ticks ran as steps returned
+	var m sync.Mutex
+	returned := 0
+	var steps sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		steps.Add(1)
+		go func() {
+			defer steps.Done()
+			for j := 0; j < 5; j++ {
+				s.Step()
+				m.Lock()
+				returned++
+				if ticks := obs.count(); ticks < returned {
+					t.Errorf("Expect a step to return after its tick, %d steps returned after %d ticks", returned, ticks)
+				}
+				m.Unlock()
+			}
+		}()
+	}
+	steps.Wait()
+	time.Sleep(20 * time.Millisecond)
+	if obs.count() != 40 || !s.Paused() {
+		t.Errorf("Expect 40 steps to run 40 ticks and hold, actual %d ticks", obs.count())
+	}
+	s.Stop()
+	<-finished
+}
+
+func TestSimulationStopWhilePaused(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Iterations = 1000
+	s.Init()
+	s.Pause()
+	obs := &lockedTickObserver{}
+	finished := make(chan struct{})
+	go func() {
+		s.Run(obs)
+		close(finished)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.Step()
+	s.Stop()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expect a stopped simulation to end its run")
+	}
+	if obs.count() != 1 {
+		t.Errorf("Expect the run to end after the single step, actual %d ticks", obs.count())
+	}
+}
+
+func TestSystemStep(t *testing.T) {
+	s := &simulation.System{NumBot: 3, StopWhen: simulation.MaxWallTime(time.Minute)}
+	s.Init()
+	s.Pause()
+	obs := &drainObserver{make(chan interface{})}
+	var m sync.Mutex
+	runs := 0
+	go func() {
+		for data := range obs.c {
+			if _, ok := data.(common.Trace); ok {
+				m.Lock()
+				runs++
+				m.Unlock()
+			}
+		}
+	}()
+	finished := make(chan struct{})
+	go func() {
+		s.Run(obs)
+		close(finished)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	s.Step()
+	// the last trace may still be on its way to the counter, while the paused robots don't run again
+	time.Sleep(20 * time.Millisecond)
+	m.Lock()
+	if runs != 3 {
+		t.Errorf("Expect every robot to run once per step, actual %d runs", runs)
+	}
+	m.Unlock()
+	s.Stop()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expect a stopped system to end its run")
+	}
+}
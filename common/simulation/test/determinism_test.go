@@ -0,0 +1,201 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maze/common"
+	"maze/common/action"
+	"maze/common/robot"
+	"maze/common/simulation"
+	"maze/common/world"
+	"runtime"
+	"sync/atomic"
+	"testing"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// recordingObserver writes every trace it is notified of, with its type, as a line of JSON
+type recordingObserver struct {
+	buf bytes.Buffer
+}
+
+func (o *recordingObserver) Notify(data interface{}) {
+	if _, ok := data.(common.Trace); !ok {
+		return
+	}
+	line, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(&o.buf, "%T %s\n", data, line)
+}
+func (o *recordingObserver) GetChannel() chan interface{} {
+	return nil
+}
+
+func centralizedRun(seed int64) []byte {
+	s := simulation.CreateCentralizedSimulation()
+	s.Seed = seed
+	s.Iterations = 150
+	s.Idle = robot.CreateSpreadOut()
+	s.CommRange = 2
+	s.Sync = &simulation.SyncSettings{Delay: 2, Interval: 2}
+	s.Faults = simulation.CreateFaultInjector(seed, []simulation.ScheduledFault{{Tick: 10, Robot: 1, Mode: common.FaultStopped, Duration: 5}})
+	s.Init()
+	obs := recordingObserver{}
+	s.Run(&obs)
+	return obs.buf.Bytes()
+}
+
+func eventRun(seed int64) []byte {
+	s := simulation.CreateEventSimulation()
+	s.Seed = seed
+	s.Until = 200
+	s.ArrivalInterval = 7
+	s.Init()
+	obs := recordingObserver{}
+	s.Run(&obs)
+	return obs.buf.Bytes()
+}
+
+func TestSeededSimulationsAreReproducible(t *testing.T) {
+	for name, run := range map[string]func(int64) []byte{"centralized": centralizedRun, "event": eventRun} {
+		first, second := run(7), run(7)
+		if len(first) == 0 || !bytes.Equal(first, second) {
+			t.Errorf("%s: expect identical traces for the same seed", name)
+		}
+		if bytes.Equal(first, run(8)) {
+			t.Errorf("%s: expect different seeds to produce different runs", name)
+		}
+	}
+}
+
+// lockstepSettings keeps robots apart from their neighbors' intents, so that robots carrying tasks run in parallel
+func lockstepSettings(s *simulation.CentralizedSimulation, seed int64) {
+	s.Seed = seed
+	s.Iterations = 150
+	s.Idle = robot.CreateSpreadOut()
+	s.Sync = &simulation.SyncSettings{Delay: 2, Interval: 2}
+	s.Faults = simulation.CreateFaultInjector(seed, []simulation.ScheduledFault{{Tick: 10, Robot: 1, Mode: common.FaultStopped, Duration: 5}})
+}
+
+func TestLockstepSimulationMatchesCentralized(t *testing.T) {
+	for _, seed := range []int64{3, 7, 11} {
+		c := simulation.CreateCentralizedSimulation()
+		lockstepSettings(c, seed)
+		c.Init()
+		expected := recordingObserver{}
+		c.Run(&expected)
+
+		l := simulation.CreateLockstepSimulation()
+		lockstepSettings(&l.CentralizedSimulation, seed)
+		l.Init()
+		actual := recordingObserver{}
+		l.Run(&actual)
+
+		if expected.buf.Len() == 0 || !bytes.Equal(expected.buf.Bytes(), actual.buf.Bytes()) {
+			t.Errorf("seed %d: expect the lockstep simulation to produce the traces of the centralized one", seed)
+		}
+	}
+}
+
+// dockingPlanner docks at the destination of every task before ending it, so robots carrying tasks take station slots
+type dockingPlanner struct {
+	robot.ShortestPath
+}
+
+func (dockingPlanner) Plan(g graph.Graph, from graph.Node, t common.Task) (common.Action, error) {
+	plan, err := robot.ShortestPath{}.Plan(g, from, t)
+	if err != nil {
+		return nil, err
+	}
+	for a := plan; a.GetType() != common.ActionTypeNull; a = a.GetChild() {
+		if end, ok := a.GetChild().(*action.EndTaskAction); ok {
+			dock := action.CreateDockAction(end.Here())
+			dock.SetChild(end)
+			a.SetChild(dock)
+			break
+		}
+	}
+	return plan, nil
+}
+
+// chargingSettings puts robots with batteries on few charger slots, docking at the end of every task
+func chargingSettings(s *simulation.CentralizedSimulation, seed int64) {
+	s.Seed = seed
+	s.Iterations = 150
+	s.Tasks = 20
+	s.ArrivalInterval = 2
+	s.Chargers = world.CreateChargingNetwork()
+	for _, n := range []int64{2, 3, 5, 8} {
+		s.Chargers.AddStation(simple.Node(n), 1, 2)
+	}
+	typ := &robot.Type{Name: "battery", Speed: 1, Capacity: 1, Battery: robot.NewBattery(15, 1, 0, 0.5, 5), Handling: robot.HandlingTimes{Dock: action.Fixed(1)}}
+	for i := 0; i < 6; i++ {
+		s.Fleet = append(s.Fleet, simulation.RobotSpec{Type: typ})
+	}
+	s.Options = []robot.Option{robot.WithPathPlanner(dockingPlanner{})}
+}
+
+// overlapExecutor counts the robots stepping while another one is still stepping
+type overlapExecutor struct {
+	running  int32
+	overlaps int32
+}
+
+func (e *overlapExecutor) Execute(a robot.Actuator) common.Trace {
+	if atomic.AddInt32(&e.running, 1) > 1 {
+		atomic.AddInt32(&e.overlaps, 1)
+	}
+	defer atomic.AddInt32(&e.running, -1)
+	for i := 0; i < 10; i++ {
+		runtime.Gosched()
+	}
+	return a.Step()
+}
+
+func TestLockstepSimulationMatchesCentralizedWithChargers(t *testing.T) {
+	for _, seed := range []int64{3, 7, 11} {
+		c := simulation.CreateCentralizedSimulation()
+		chargingSettings(c, seed)
+		c.Init()
+		expected := recordingObserver{}
+		c.Run(&expected)
+
+		l := simulation.CreateLockstepSimulation()
+		chargingSettings(&l.CentralizedSimulation, seed)
+		overlaps := &overlapExecutor{}
+		l.Options = append(l.Options, robot.WithExecutor(overlaps))
+		l.Init()
+		actual := recordingObserver{}
+		l.Run(&actual)
+
+		if !bytes.Contains(expected.buf.Bytes(), []byte("DockTrace")) || !bytes.Contains(expected.buf.Bytes(), []byte("ChargeTrace")) {
+			t.Fatalf("seed %d: expect robots to dock and charge", seed)
+		}
+		if !bytes.Equal(expected.buf.Bytes(), actual.buf.Bytes()) {
+			t.Errorf("seed %d: expect the lockstep simulation to produce the traces of the centralized one", seed)
+		}
+		if overlaps.overlaps != 0 {
+			t.Errorf("seed %d: expect robots on the charging network to run one at a time, %d ran alongside another", seed, overlaps.overlaps)
+		}
+	}
+}
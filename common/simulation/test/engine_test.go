@@ -0,0 +1,143 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/simulation"
+	"maze/common/task"
+	"maze/common/trace"
+	"testing"
+)
+
+func TestEngineOrdersEvents(t *testing.T) {
+	e := simulation.CreateEngine()
+	var order []string
+	record := func(name string) func() {
+		return func() { order = append(order, name) }
+	}
+	e.Schedule(2.5, 0, record("late"))
+	e.Schedule(1, 1, record("low priority"))
+	e.Schedule(1, 0, record("first"))
+	e.Schedule(1, 0, record("second"))
+	e.Schedule(1, 0, func() {
+		e.ScheduleAfter(0.5, 0, record("scheduled by an event"))
+	})
+	e.RunUntil(2)
+	want := []string{"first", "second", "low priority", "scheduled by an event"}
+	if len(order) != len(want) {
+		t.Fatalf("Expect events %v, got %v", want, order)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("Expect events %v, got %v", want, order)
+		}
+	}
+	if e.Now() != 2 || e.Pending() != 1 {
+		t.Errorf("Expect the clock to stop at 2 with an event left, at %v with %d events", e.Now(), e.Pending())
+	}
+	e.Step()
+	if e.Now() != 2.5 || e.Tick() != 2 || order[len(order)-1] != "late" {
+		t.Errorf("Expect the clock to jump to the next event")
+	}
+}
+
+type countingObserver struct {
+	moves  int
+	faults int
+	other  int
+}
+
+func (c *countingObserver) Notify(data interface{}) {
+	switch data.(type) {
+	case *trace.MoveTrace:
+		c.moves++
+	case *trace.FaultTrace:
+		c.faults++
+	default:
+		c.other++
+	}
+}
+func (c *countingObserver) GetChannel() chan interface{} {
+	return nil
+}
+
+func TestEventSimulationSkipsIdleTime(t *testing.T) {
+	s := simulation.CreateEventSimulation()
+	s.Until = 1000
+	s.Init()
+	obs := countingObserver{}
+	if err := s.Run(&obs); err != nil {
+		t.Errorf("Execution failed")
+	}
+	if s.TM.(*task.SimulatedTaskManager).FinishedCount() != 20 {
+		t.Errorf("Expect all tasks finished, finished %d", s.TM.(*task.SimulatedTaskManager).FinishedCount())
+	}
+	if total := obs.moves + obs.faults + obs.other; total >= 5*200 {
+		t.Errorf("Expect idle robots to sleep instead of acting on every tick, %d traces", total)
+	}
+	if s.Engine.Now() != 1000 || s.Engine.Pending() != 0 {
+		t.Errorf("Expect the run to end at time 1000 with nothing left to do")
+	}
+}
+
+func TestEventSimulationArrivalsAndFaults(t *testing.T) {
+	s := simulation.CreateEventSimulation()
+	s.Until = 300
+	s.Tasks = 0
+	s.ArrivalInterval = 10
+	s.Faults = simulation.CreateFaultInjector(1, []simulation.ScheduledFault{{Tick: 50, Robot: 0, Mode: common.FaultStopped, Duration: 5}})
+	s.Init()
+	obs := countingObserver{}
+	if err := s.Run(&obs); err != nil {
+		t.Errorf("Execution failed")
+	}
+	if s.TM.(*task.SimulatedTaskManager).FinishedCount() == 0 {
+		t.Errorf("Expect robots to wake up for arriving tasks")
+	}
+	if obs.faults == 0 {
+		t.Errorf("Expect the scheduled failure to happen")
+	}
+}
+
+func TestCentralizedSimulationRunsOnEngine(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.ArrivalInterval = 2.5
+	s.Init()
+	obs := &lockedTickObserver{}
+	if err := s.Run(obs); err != nil {
+		t.Errorf("Execution failed")
+	}
+	if s.Engine.Now() != 10 || obs.count() != 10 {
+		t.Errorf("Expect the clock at the end of the 10 ticks, actual time %v after %d ticks", s.Engine.Now(), obs.count())
+	}
+	state, err := s.TM.(*task.SimulatedTaskManager).Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added := len(state.Tasks); added <= s.Tasks {
+		t.Errorf("Expect tasks to arrive on the clock during the run, %d tasks", len(state.Tasks))
+	}
+
+	// a further run goes on with the clock where the previous run left it
+	s.Iterations = 15
+	if err := s.Run(obs); err != nil {
+		t.Errorf("Execution failed")
+	}
+	if s.Engine.Now() != 15 || obs.count() != 15 {
+		t.Errorf("Expect the clock to go on to 15, actual time %v after %d ticks", s.Engine.Now(), obs.count())
+	}
+}
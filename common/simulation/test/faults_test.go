@@ -0,0 +1,121 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"io/ioutil"
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/simulation"
+	"maze/common/task"
+	"maze/common/trace"
+	"maze/common/world"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func writeScenario(t *testing.T, content string) string {
+	dir, err := ioutil.TempDir("", "scenario")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "scenario.yaml")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFaultSchedule(t *testing.T) {
+	path := writeScenario(t, `
+faults:
+  - {tick: 5, robot: 0, mode: stopped, duration: 10}
+  - {tick: 8, robot: 2, mode: degraded, duration: 4, factor: 0.5}
+`)
+	schedule, err := simulation.LoadFaultSchedule(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedule) != 2 || schedule[1].Mode != common.FaultDegraded || schedule[1].Factor != 0.5 || schedule[0].Duration != 10 {
+		t.Errorf("Unexpected schedule %+v", schedule)
+	}
+
+	bad := writeScenario(t, "faults:\n  - {tick: 1, robot: 0, mode: exploded, duration: 1}\n")
+	if _, err := simulation.LoadFaultSchedule(bad); err == nil {
+		t.Errorf("Expect unknown fault modes to be rejected")
+	}
+	for _, factor := range []string{"0", "-0.5", "1.5"} {
+		bad = writeScenario(t, "faults:\n  - {tick: 1, robot: 0, mode: degraded, duration: 1, factor: "+factor+"}\n")
+		if _, err := simulation.LoadFaultSchedule(bad); err == nil {
+			t.Errorf("Expect degraded factor %s to be rejected", factor)
+		}
+	}
+}
+
+func TestCentralizedSimulationWithFaults(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Faults = simulation.CreateFaultInjector(1, []simulation.ScheduledFault{
+		{Tick: 2, Robot: 0, Mode: common.FaultStopped, Duration: 20},
+		{Tick: 3, Robot: 1, Mode: common.FaultLostComm, Duration: 10},
+	})
+	s.Iterations = 300
+	s.Init()
+	obs := traceObserver{}
+	if err := s.Run(&obs); err != nil {
+		t.Errorf("Execution failed")
+	}
+	started, repaired := 0, 0
+	for _, i := range obs.traces {
+		if f, ok := i.(*trace.FaultTrace); ok {
+			switch f.Event {
+			case trace.FaultStarted:
+				started++
+			case trace.FaultRepaired:
+				repaired++
+			}
+		}
+	}
+	if started != 2 || repaired != 2 {
+		t.Errorf("Expect both faults to start and be repaired, started %d repaired %d", started, repaired)
+	}
+	if s.TM.(*task.SimulatedTaskManager).FinishedCount() != 20 {
+		t.Errorf("Released tasks should be finished by the fleet, finished %d", s.TM.(*task.SimulatedTaskManager).FinishedCount())
+	}
+}
+
+func TestScheduledFaultSkipsRobotAlreadyDown(t *testing.T) {
+	w := world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManager())
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	w.AddRobot(r)
+	f := simulation.CreateFaultInjector(1, []simulation.ScheduledFault{
+		{Tick: 2, Robot: 0, Mode: common.FaultStopped, Duration: 10},
+		{Tick: 4, Robot: 0, Mode: common.FaultDegraded, Duration: 2, Factor: 0.5},
+	})
+	if traces := f.Inject(w, 2); len(traces) != 1 {
+		t.Fatalf("Expect the robot to break down at tick 2, traces %+v", traces)
+	}
+	if traces := f.Inject(w, 4); len(traces) != 0 {
+		t.Errorf("Expect a robot already down to be left alone, traces %+v", traces)
+	}
+	if mode, down := r.Fault(); !down || mode != common.FaultStopped {
+		t.Errorf("Expect the robot to stay stopped, mode %d", mode)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"bytes"
+	"errors"
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/simulation"
+	"maze/common/task"
+	"strings"
+	"testing"
+	"time"
+)
+
+const lockstepScenario = `
+mode: lockstep
+seed: 7
+duration: 60
+map:
+  edges: [[1, 2], [2, 3], [3, 4], [4, 5], [5, 6], [6, 1], [2, 5]]
+fleet:
+  - {count: 2, start: [1, 4]}
+  - {type: slow, count: 1, speed: 0.5, capacity: 2}
+tasks: {initial: 6, interval: 5}
+selector: nearest
+idle: {strategy: spread}
+faults:
+  - {tick: 5, robot: 0, mode: stopped, duration: 3}
+output: {traces: "-", format: json}
+`
+
+func TestLoadScenario(t *testing.T) {
+	sc, err := simulation.LoadScenario(writeScenario(t, lockstepScenario))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Mode != "lockstep" || sc.Seed != 7 || sc.Duration != 60 || len(sc.Edges) != 7 || sc.Tasks != 6 || sc.ArrivalInterval != 5 {
+		t.Errorf("Unexpected scenario %+v", sc)
+	}
+	if len(sc.Fleet) != 3 || sc.Fleet[1].Start != 4 || sc.Fleet[2].Start != 0 || sc.Fleet[2].Type.Speed != 0.5 || sc.Fleet[2].Type.Capacity != 2 {
+		t.Errorf("Unexpected fleet %+v", sc.Fleet)
+	}
+	if _, ok := sc.Idle.(*robot.SpreadOut); !ok || len(sc.Faults) != 1 || sc.Output.Traces != "-" {
+		t.Errorf("Unexpected strategies or outputs %+v", sc)
+	}
+
+	s, ok := sc.Simulation().(*simulation.LockstepSimulation)
+	if !ok {
+		t.Fatalf("Expect a lockstep simulation")
+	}
+	s.Init()
+	robots := s.World.GetRobots()
+	if len(robots) != 3 || robots[0].Location().ID() != 1 || robots[1].Location().ID() != 4 || robots[2].Type().GetName() != "slow" {
+		t.Errorf("Expect the fleet to start as described")
+	}
+	if s.World.GetGraph().Nodes().Len() != 6 {
+		t.Errorf("Expect the world to have the nodes of the map")
+	}
+	var out bytes.Buffer
+	w := simulation.CreateTraceWriter(&out, sc.Output.Format)
+	s.Run(w)
+	if w.Err() != nil || !strings.Contains(out.String(), `"Type":"*trace.FaultTrace"`) {
+		t.Errorf("Expect the traces of the run to be written, with the scheduled fault")
+	}
+}
+
+func TestScenarioDefaultsAndRobots(t *testing.T) {
+	sc, err := simulation.LoadScenario(writeScenario(t, "seed: 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Mode != "centralized" || len(sc.Fleet) != 5 || sc.Tasks != 20 || sc.Duration != 100 {
+		t.Errorf("Unexpected defaults %+v", sc)
+	}
+	sc.SetRobots(2)
+	s := sc.Simulation().(*simulation.CentralizedSimulation)
+	s.Init()
+	if len(s.World.GetRobots()) != 2 || len(s.World.GetAllTasks()) != 20 {
+		t.Errorf("Expect the number of robots to follow the fleet size")
+	}
+}
+
+func TestScenarioRejectsInvalidSettings(t *testing.T) {
+	for _, content := range []string{
+		"mode: freewheeling\n",
+		"map: {edges: [[1, 2], [2, 4]]}\n",
+		"planner: teleport\n",
+		"fleet:\n  - {count: 1, start: [1, 2]}\n",
+		"fleet:\n  - {type: fast, count: 1, speed: 2}\n  - {type: fast, count: 1, speed: 3}\n",
+		"idle: {strategy: parking}\n",
+		"fleet:\n  - {count: 1, start: [13]}\n",
+		"fleet:\n  - {count: 1, start: [-1]}\n",
+		"map: {edges: [[1, 2], [2, 3]]}\nfleet:\n  - {count: 1, start: [4]}\n",
+	} {
+		if _, err := simulation.LoadScenario(writeScenario(t, content)); err == nil {
+			t.Errorf("Expect %q to be rejected", content)
+		}
+	}
+}
+
+// brokenWriter fails every write, as an output closed under the simulation does
+type brokenWriter struct{}
+
+func (brokenWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("output closed")
+}
+
+func TestRunFailsOnTraceWriteError(t *testing.T) {
+	for _, s := range []common.Simulation{simulation.CreateCentralizedSimulation(), simulation.CreateEventSimulation()} {
+		s.Init()
+		if err := s.Run(simulation.CreateTraceWriter(brokenWriter{}, "json")); err == nil {
+			t.Errorf("%T: expect the run to fail when its traces can't be written", s)
+		}
+	}
+}
+
+func TestScenarioStopSettings(t *testing.T) {
+	sc, err := simulation.LoadScenario(writeScenario(t, "duration: 0\nstop: {wall_time: 30s, tasks_completed: 5, steady: {window: 10, windows: 3, tolerance: 0.1}}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sc.Stop.WallTime != 30*time.Second || sc.Stop.TasksCompleted != 5 || sc.Stop.Steady.Windows != 3 {
+		t.Errorf("Unexpected stop settings %+v", sc.Stop)
+	}
+	s := sc.Simulation().(*simulation.CentralizedSimulation)
+	s.Init()
+	s.Run(&traceObserver{})
+	if n := s.TM.(*task.SimulatedTaskManager).FinishedCount(); n < 5 || n == 20 {
+		t.Errorf("Expect the run to stop once 5 tasks are done, finished %d", n)
+	}
+	if _, err := simulation.LoadScenario(writeScenario(t, "duration: 0\n")); err == nil {
+		t.Errorf("Expect a scenario without duration nor stop condition to be rejected")
+	}
+}
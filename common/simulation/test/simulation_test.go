@@ -19,6 +19,8 @@ package test
 import (
 	"github.com/google/uuid"
 	"maze/common"
+	"maze/common/auction"
+	"maze/common/robot"
 	"maze/common/simulation"
 	"maze/common/task"
 	"maze/common/trace"
@@ -151,3 +153,187 @@ func TestConcurrentSimulation(t *testing.T) {
 	}
 
 }
+
+func TestCentralizedSimulationWithAuction(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Auctioneer = auction.CreateAuctioneer(auction.Sequential)
+	s.Iterations = 200
+	s.Init()
+	if err := s.Run(&BasicObserver{}); err != nil {
+		t.Errorf("Execution failed")
+	}
+	if s.TM.(*task.SimulatedTaskManager).FinishedCount() != 20 {
+		t.Errorf("Auctioned tasks should all be finished, finished %d", s.TM.(*task.SimulatedTaskManager).FinishedCount())
+	}
+}
+
+func TestCentralizedSimulationWithDispatcher(t *testing.T) {
+	for _, strategy := range []simulation.DispatchStrategy{simulation.OptimalDispatch, simulation.GreedyDispatch} {
+		s := simulation.CreateCentralizedSimulation()
+		s.Dispatcher = simulation.CreateDispatcher(strategy, 3)
+		s.Iterations = 300
+		s.Init()
+		obs := traceObserver{}
+		if err := s.Run(&obs); err != nil {
+			t.Errorf("Execution failed")
+		}
+		if s.TM.(*task.SimulatedTaskManager).FinishedCount() != 20 {
+			t.Errorf("Dispatched tasks should all be finished, finished %d", s.TM.(*task.SimulatedTaskManager).FinishedCount())
+		}
+		m := s.Dispatcher.Metrics
+		if m.Assigned != 20 || m.OptimalAssigned < m.GreedyAssigned || (m.OptimalAssigned == m.GreedyAssigned && m.OptimalCost > m.GreedyCost) {
+			t.Errorf("Expect all tasks dispatched with optimal cost no more than greedy, actual %+v", m)
+		}
+		rounds := 0
+		for _, i := range obs.traces {
+			if _, ok := i.(*trace.DispatchTrace); ok {
+				rounds++
+			}
+		}
+		if rounds != m.Rounds || rounds != 100 {
+			t.Errorf("Expect a dispatch trace every 3 ticks, actual %d traces and %d rounds", rounds, m.Rounds)
+		}
+	}
+}
+
+func TestCentralizedSimulationWithIdleStrategy(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Idle = robot.CreateSpreadOut()
+	s.Iterations = 300
+	s.Init()
+	if err := s.Run(&BasicObserver{}); err != nil {
+		t.Errorf("Execution failed")
+	}
+	if s.TM.(*task.SimulatedTaskManager).FinishedCount() != 20 {
+		t.Errorf("Repositioning robots should still finish all tasks, finished %d", s.TM.(*task.SimulatedTaskManager).FinishedCount())
+	}
+}
+
+func TestCentralizedSimulationWithLocalWorlds(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Sync = &simulation.SyncSettings{Delay: 3, Interval: 2}
+	s.Iterations = 300
+	s.Init()
+	if err := s.Run(&BasicObserver{}); err != nil {
+		t.Errorf("Execution failed")
+	}
+	if s.TM.(*task.SimulatedTaskManager).FinishedCount() != 20 {
+		t.Errorf("Robots planning on stale views should still finish all tasks, finished %d, conflicts %d",
+			s.TM.(*task.SimulatedTaskManager).FinishedCount(), s.Conflicts())
+	}
+}
+
+func TestCentralizedSimulationWithCommunication(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.CommRange = 2
+	s.Iterations = 300
+	s.Init()
+	if err := s.Run(&BasicObserver{}); err != nil {
+		t.Errorf("Execution failed")
+	}
+	if s.TM.(*task.SimulatedTaskManager).FinishedCount() != 20 {
+		t.Errorf("Robots giving way to each other should still finish all tasks, finished %d", s.TM.(*task.SimulatedTaskManager).FinishedCount())
+	}
+}
+
+func TestCentralizedSimulationPredictsCompletion(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Iterations = 300
+	s.Init()
+	obs := traceObserver{}
+	if err := s.Run(&obs); err != nil {
+		t.Errorf("Execution failed")
+	}
+	var etas []*trace.ETATrace
+	for _, i := range obs.traces {
+		if e, ok := i.(*trace.ETATrace); ok {
+			etas = append(etas, e)
+		}
+	}
+	if len(etas) != s.TM.(*task.SimulatedTaskManager).FinishedCount() || len(etas) == 0 {
+		t.Fatalf("Expect a prediction for every completed task, %d predictions for %d tasks", len(etas), s.TM.(*task.SimulatedTaskManager).FinishedCount())
+	}
+	for _, e := range etas {
+		if e.Latest < e.Actual-1 || e.Latest > e.Actual+1 {
+			t.Errorf("Expect the last prediction to be within a tick of completion, got %+v", e)
+		}
+	}
+	if len(s.TM.(*task.SimulatedTaskManager).ETAs()) != 0 {
+		t.Errorf("Expect no predictions left once all tasks are done")
+	}
+}
+
+func TestDispatcherSkipsIneligibleRobots(t *testing.T) {
+	w := world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManager())
+	lifter := &robot.Type{Name: "lifter", Speed: 1, Capacity: 1, Capabilities: []common.Capability{"lift"}}
+	plain := robot.NewSimpleWarehouseRobot(uuid.New(), w.GetGraph().Node(1), w)
+	capable := robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(12), w, lifter, nil)
+	w.AddRobot(plain)
+	w.AddRobot(capable)
+	mt := task.NewMultiStopTask(
+		common.TaskStop{Location: w.GetGraph().Node(1), Type: common.PickupStop, Payload: 1},
+		common.TaskStop{Location: w.GetGraph().Node(2), Type: common.DropStop, Payload: 1},
+	)
+	mt.Requires = []common.Capability{"lift"}
+	w.AddTask(mt)
+
+	d := simulation.CreateDispatcher(simulation.OptimalDispatch, 1)
+	if r := d.Dispatch(w, 0).(*trace.DispatchTrace); r.Assigned != 1 {
+		t.Fatalf("Expect the task to be dispatched to the capable robot, actual %+v", r)
+	}
+	if _, tk := capable.GetStatus(); tk != nil {
+		t.Errorf("Dispatched task should wait in the queue of the robot until it runs")
+	}
+	capable.Run()
+	if _, tk := capable.GetStatus(); tk == nil || tk.GetTaskID() != mt.GetTaskID() {
+		t.Errorf("Expect the capable robot to carry out the task, although the plain robot is nearer")
+	}
+
+	// with no capable robot idle, the task stays with the task manager
+	other := task.NewMultiStopTask(
+		common.TaskStop{Location: w.GetGraph().Node(3), Type: common.PickupStop, Payload: 1},
+		common.TaskStop{Location: w.GetGraph().Node(4), Type: common.DropStop, Payload: 1},
+	)
+	other.Requires = []common.Capability{"lift"}
+	w.AddTask(other)
+	if r := d.Dispatch(w, 1).(*trace.DispatchTrace); r.Assigned != 0 || r.OptimalCost != 0 {
+		t.Errorf("Expect no robot to be dispatched to a task none can take, actual %+v", r)
+	}
+	if !w.HasTasks() {
+		t.Errorf("Task nobody can take should stay unassigned")
+	}
+}
+
+func TestRobotsStartOnEveryNode(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.NumRobots = 200
+	s.Init()
+	l := s.World.GetGraph().Nodes().Len()
+	seen := make(map[int64]bool)
+	for _, r := range s.World.GetRobots() {
+		id := r.Location().ID()
+		if id < 1 || id > int64(l) {
+			t.Fatalf("Robot starts on node %d, outside the nodes 1 to %d", id, l)
+		}
+		seen[id] = true
+	}
+	if !seen[int64(l)] {
+		t.Errorf("Expect robots to start on the last node %d as well", l)
+	}
+}
+
+func TestDispatcherCostsOnRobotGraph(t *testing.T) {
+	w := world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManager())
+	// the robot can't take the edge between 1 and 2, it goes around through 5
+	detour := &robot.Type{Name: "detour", Speed: 1, Capacity: 1, Edges: [][2]int64{{1, 5}, {5, 2}, {2, 3}}}
+	w.AddRobot(robot.NewRobotOfType(uuid.New(), w.GetGraph().Node(1), w, detour, nil))
+	w.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(3)))
+
+	r := simulation.CreateDispatcher(simulation.OptimalDispatch, 1).Dispatch(w, 0).(*trace.DispatchTrace)
+	if r.Assigned != 1 || r.Cost != 3 {
+		t.Errorf("Expect the cost of the detour the robot takes, actual %+v", r)
+	}
+	if r.OptimalAssigned != 1 || r.GreedyAssigned != 1 {
+		t.Errorf("Expect the pairs of both strategies to be reported, actual %+v", r)
+	}
+}
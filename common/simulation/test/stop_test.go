@@ -0,0 +1,174 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package test
+
+import (
+	"maze/common/simulation"
+	"maze/common/task"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStopConditions(t *testing.T) {
+	p := simulation.Progress{Tick: 10, Elapsed: time.Second, Waiting: 0, Active: 1, Completed: 4}
+	if !simulation.MaxTicks(10).Done(p) || simulation.MaxTicks(11).Done(p) {
+		t.Errorf("Expect max ticks to hold from the tick on")
+	}
+	if !simulation.MaxWallTime(time.Second).Done(p) || simulation.MaxWallTime(2*time.Second).Done(p) {
+		t.Errorf("Expect max wall time to hold once the time elapsed")
+	}
+	if simulation.AllTasksDone().Done(p) || !simulation.NoTasksWaiting().Done(p) {
+		t.Errorf("Expect active tasks to keep the run going until they are done")
+	}
+	if !simulation.TasksCompleted(4).Done(p) || simulation.TasksCompleted(5).Done(p) {
+		t.Errorf("Expect tasks completed to hold once enough tasks are done")
+	}
+	custom := simulation.StopFunc(func(p simulation.Progress) bool { return p.Active == 1 })
+	if !simulation.Any(simulation.MaxTicks(100), custom).Done(p) || simulation.All(simulation.MaxTicks(100), custom).Done(p) {
+		t.Errorf("Expect any and all to combine the conditions")
+	}
+
+	steady := simulation.SteadyState(10, 3, 0.2)
+	completed := []int{0, 2, 10, 20, 30, 40}
+	var done []bool
+	for i, c := range completed {
+		done = append(done, steady.Done(simulation.Progress{Tick: i * 10, Completed: c}))
+	}
+	// throughput by window: 2, 8, 10, 10, 10
+	if done[3] || done[4] || !done[5] {
+		t.Errorf("Expect steady state once the throughput settles, actual %v", done)
+	}
+
+	warmup := simulation.SteadyState(10, 3, 0.2)
+	for i := 0; i < 6; i++ {
+		if warmup.Done(simulation.Progress{Tick: i * 10}) {
+			t.Errorf("Expect a run completing nothing yet not to be steady, stopped at tick %d", i*10)
+		}
+	}
+}
+
+func TestCentralizedSimulationStopConditions(t *testing.T) {
+	s := simulation.CreateCentralizedSimulation()
+	s.Iterations = 0
+	s.StopWhen = simulation.AllTasksDone()
+	s.Init()
+	obs := traceObserver{}
+	s.Run(&obs)
+	if s.TM.(*task.SimulatedTaskManager).FinishedCount() != 20 {
+		t.Errorf("Expect the run to go on until all tasks are done")
+	}
+
+	l := simulation.CreateLockstepSimulation()
+	l.Iterations = 1000
+	l.StopWhen = simulation.TasksCompleted(5)
+	l.Init()
+	ticks := 0
+	l.Run(&tickObserver{&ticks})
+	finished := l.TM.(*task.SimulatedTaskManagerSync).FinishedCount()
+	if finished < 5 || finished == 20 || ticks >= 1000 {
+		t.Errorf("Expect the run to stop once 5 tasks are done, finished %d in %d ticks", finished, ticks)
+	}
+}
+
+func TestEventSimulationStopConditions(t *testing.T) {
+	s := simulation.CreateEventSimulation()
+	s.Until = 1000
+	s.ArrivalInterval = 3
+	s.StopWhen = simulation.TasksCompleted(10)
+	s.Init()
+	s.Run(&countingObserver{})
+	finished := s.TM.(*task.SimulatedTaskManager).FinishedCount()
+	if finished < 10 || s.Engine.Now() >= 1000 {
+		t.Errorf("Expect the run to stop once 10 tasks are done, finished %d at %v", finished, s.Engine.Now())
+	}
+}
+
+func TestSystemStopsOnWallTime(t *testing.T) {
+	s := simulation.System{NumBot: 3, StopWhen: simulation.MaxWallTime(50 * time.Millisecond)}
+	s.Init()
+	obs := &drainObserver{make(chan interface{})}
+	go func() {
+		for range obs.c {
+		}
+	}()
+	start := time.Now()
+	s.Start(obs)
+	s.RunTillStop()
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expect the system to stop after the wall time, took %s", elapsed)
+	}
+}
+
+func TestFinishEndsWaitOnCheckOrClose(t *testing.T) {
+	var tick int64
+	f := simulation.CreateFinish(simulation.MaxTicks(2), func() simulation.Progress { return simulation.Progress{Tick: int(atomic.LoadInt64(&tick))} })
+	waited := make(chan struct{})
+	go func() {
+		f.Wait()
+		close(waited)
+	}()
+	atomic.StoreInt64(&tick, 1)
+	if f.Check() {
+		t.Fatalf("Expect the run to go on before its last tick")
+	}
+	atomic.StoreInt64(&tick, 2)
+	if !f.Check() {
+		t.Fatalf("Expect the run over on its last tick")
+	}
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatalf("Expect the wait to end once the condition holds")
+	}
+
+	closed := simulation.CreateFinish(simulation.MaxTicks(2), func() simulation.Progress { return simulation.Progress{} })
+	go closed.Close()
+	select {
+	case <-closed.Done():
+	case <-time.After(time.Second):
+		t.Fatalf("Expect closing to end the run whatever the condition")
+	}
+	if !closed.Check() {
+		t.Errorf("Expect a closed run to stay over")
+	}
+}
+
+// tickObserver counts the ticks of a centralized run, which ends every tick with an empty notification
+type tickObserver struct {
+	ticks *int
+}
+
+func (o *tickObserver) Notify(data interface{}) {
+	if _, ok := data.(struct{}); ok {
+		*o.ticks++
+	}
+}
+func (o *tickObserver) GetChannel() chan interface{} {
+	return nil
+}
+
+// drainObserver hands the channel the actors of a system send their traces to
+type drainObserver struct {
+	c chan interface{}
+}
+
+func (o *drainObserver) Notify(data interface{}) {
+}
+func (o *drainObserver) GetChannel() chan interface{} {
+	return o.c
+}
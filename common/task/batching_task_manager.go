@@ -0,0 +1,403 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"maze/common"
+	"sort"
+	"time"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/path"
+)
+
+// BatchRule decides whether a task may join a batch of pending tasks
+type BatchRule interface {
+	Compatible(batch []common.Task, t common.Task) bool
+}
+
+// BatchConfig holds the rules used to group pending tasks.
+// A batch is handed out once it holds MaxBatchSize tasks, or once its oldest task has waited for MaxWait
+type BatchConfig struct {
+	MaxBatchSize int
+	MaxWait      time.Duration
+	Rules        []BatchRule
+}
+
+// sameDestinationRule groups tasks delivered to the same station
+type sameDestinationRule struct{}
+
+// SameDestination creates a rule which only batches tasks sharing the destination
+func SameDestination() BatchRule {
+	return sameDestinationRule{}
+}
+
+func (sameDestinationRule) Compatible(batch []common.Task, t common.Task) bool {
+	for _, b := range batch {
+		if b.GetDestination().ID() != t.GetDestination().ID() {
+			return false
+		}
+	}
+	return true
+}
+
+// clusterRule groups tasks whose origins are within a shortest path distance of each other
+type clusterRule struct {
+	paths  path.AllShortest
+	radius float64
+}
+
+// WithinDistance creates a rule which only batches tasks whose origins are at most radius apart on graph g
+func WithinDistance(g graph.Graph, radius float64) BatchRule {
+	return &clusterRule{path.DijkstraAllPaths(g), radius}
+}
+
+func (c *clusterRule) Compatible(batch []common.Task, t common.Task) bool {
+	for _, b := range batch {
+		if c.paths.Weight(b.GetOrigination().ID(), t.GetOrigination().ID()) > c.radius {
+			return false
+		}
+	}
+	return true
+}
+
+// BatchTask is a composite task handing out several tasks as a single robot trip.
+// All origins are visited first, then all destinations
+type BatchTask struct {
+	*MultiStopTask
+	Members []common.Task
+}
+
+// NewBatchTask creates the composite task over the members. Every member carries a payload of 1
+func NewBatchTask(members []common.Task) *BatchTask {
+	var stops []common.TaskStop
+	for _, m := range members {
+		stops = append(stops, common.TaskStop{Location: m.GetOrigination(), Type: common.PickupStop, Payload: 1})
+	}
+	for i, m := range members {
+		dropped := false
+		for _, prev := range members[:i] {
+			if prev.GetDestination().ID() == m.GetDestination().ID() {
+				dropped = true
+				break
+			}
+		}
+		if dropped {
+			continue
+		}
+		n := 0
+		for _, other := range members[i:] {
+			if other.GetDestination().ID() == m.GetDestination().ID() {
+				n++
+			}
+		}
+		stops = append(stops, common.TaskStop{Location: m.GetDestination(), Type: common.DropStop, Payload: n})
+	}
+	return &BatchTask{NewMultiStopTask(stops...), members}
+}
+
+type pendingTask struct {
+	task  common.Task
+	since time.Time
+}
+
+// BatchingTaskManager groups pending tasks of an underlying task manager into batches, and hands the batches out as composite tasks.
+// Status updates on a batch are applied to all of its members
+type BatchingTaskManager struct {
+	tm      common.TaskManager
+	config  BatchConfig
+	pending []pendingTask
+	ready   []common.Task
+	batches map[common.TaskID]*BatchTask
+	// groups keeps the pending entries of the members of each batch, so a batch broken up hands them back with their waiting time
+	groups map[common.TaskID][]pendingTask
+	// Now is the clock used to measure how long tasks have been waiting
+	Now func() time.Time
+}
+
+func CreateBatchingTaskManager(tm common.TaskManager, config BatchConfig) *BatchingTaskManager {
+	if config.MaxBatchSize < 1 {
+		config.MaxBatchSize = 1
+	}
+	return &BatchingTaskManager{
+		tm:      tm,
+		config:  config,
+		batches: make(map[common.TaskID]*BatchTask),
+		groups:  make(map[common.TaskID][]pendingTask),
+		Now:     time.Now,
+	}
+}
+
+func (b *BatchingTaskManager) GetBroadcastInfo() interface{} {
+	return b.tm.GetBroadcastInfo()
+}
+
+// GetAllTasks returns the released batches and single tasks. Tasks still waiting for their batch, and the members of a batch,
+// are left out so they can't be claimed apart from it
+func (b *BatchingTaskManager) GetAllTasks() []common.Task {
+	b.release()
+	return append([]common.Task(nil), b.ready...)
+}
+
+// GetNextTask returns the oldest released batch, or nil when every pending task is still waiting for its batch to fill up
+func (b *BatchingTaskManager) GetNextTask() common.Task {
+	b.release()
+	if len(b.ready) == 0 {
+		return nil
+	}
+	return b.ready[0]
+}
+
+// GetTasks returns up to n released batches
+func (b *BatchingTaskManager) GetTasks(n int) []common.Task {
+	b.release()
+	if n > len(b.ready) {
+		n = len(b.ready)
+	}
+	return append([]common.Task(nil), b.ready[:n]...)
+}
+
+func (b *BatchingTaskManager) TaskUpdate(taskID common.TaskID, status common.TaskStatus) error {
+	batch, ok := b.batches[taskID]
+	if !ok {
+		if err := b.tm.TaskUpdate(taskID, status); err != nil {
+			return err
+		}
+		switch status {
+		case common.Assigned:
+			b.take(taskID)
+		case common.Unassigned:
+			for _, t := range b.tm.GetAllTasks() {
+				if t.GetTaskID() == taskID {
+					b.ready = append(b.ready, t)
+				}
+			}
+		}
+		return nil
+	}
+	if err := b.each(batch, status, func(m common.Task) error { return b.tm.TaskUpdate(m.GetTaskID(), status) }); err != nil {
+		if status == common.Assigned {
+			b.dissolve(batch, b.waiting())
+		}
+		return err
+	}
+	switch status {
+	case common.Assigned:
+		b.take(taskID)
+	case common.Unassigned:
+		b.ready = append(b.ready, batch)
+	case common.Completed:
+		delete(b.batches, taskID)
+		delete(b.groups, taskID)
+	}
+	return batch.UpdateStatus(status)
+}
+
+// ClaimTask claims a batch, or a single task, for a robot. Members of a batch are claimed on the underlying task manager when it supports claims
+func (b *BatchingTaskManager) ClaimTask(taskID common.TaskID, robotID common.RobotID) error {
+	ptm, ok := b.tm.(common.PassiveTaskManager)
+	if !ok {
+		return b.TaskUpdate(taskID, common.Assigned)
+	}
+	batch, ok := b.batches[taskID]
+	if !ok {
+		if err := ptm.ClaimTask(taskID, robotID); err != nil {
+			return err
+		}
+		b.take(taskID)
+		return nil
+	}
+	if err := b.each(batch, common.Assigned, func(m common.Task) error { return ptm.ClaimTask(m.GetTaskID(), robotID) }); err != nil {
+		b.dissolve(batch, b.waiting())
+		return err
+	}
+	b.take(taskID)
+	return batch.UpdateStatus(common.Assigned)
+}
+
+// each applies a status change to every member of the batch. When a member fails, the members already changed are changed back,
+// so the batch stays whole. Completed members can't be changed back
+func (b *BatchingTaskManager) each(batch *BatchTask, status common.TaskStatus, apply func(m common.Task) error) error {
+	for i, m := range batch.Members {
+		if err := apply(m); err != nil {
+			for _, done := range batch.Members[:i] {
+				switch status {
+				case common.Assigned:
+					b.tm.TaskUpdate(done.GetTaskID(), common.Unassigned)
+				case common.Unassigned:
+					b.tm.TaskUpdate(done.GetTaskID(), common.Assigned)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *BatchingTaskManager) AddTask(t common.Task) bool {
+	if !b.tm.AddTask(t) {
+		return false
+	}
+	b.pending = append(b.pending, pendingTask{t, b.Now()})
+	return true
+}
+
+func (b *BatchingTaskManager) AddTasks(tList []common.Task) bool {
+	result := true
+	for _, t := range tList {
+		result = b.AddTask(t) && result
+	}
+	return result
+}
+
+// HasTasks tells whether a batch or single task is released. Tasks still waiting for their batch to fill up can't be claimed yet
+func (b *BatchingTaskManager) HasTasks() bool {
+	b.release()
+	return len(b.ready) > 0
+}
+
+// Pending returns the number of tasks still waiting to be batched
+func (b *BatchingTaskManager) Pending() int {
+	return len(b.pending)
+}
+
+// take removes a claimed task from the ready queue, or from the pending tasks when it was claimed before being batched.
+// A member claimed apart from its batch breaks the batch up
+func (b *BatchingTaskManager) take(taskID common.TaskID) {
+	for i, t := range b.ready {
+		if t.GetTaskID() == taskID {
+			b.ready = append(b.ready[:i], b.ready[i+1:]...)
+			return
+		}
+	}
+	for i, p := range b.pending {
+		if p.task.GetTaskID() == taskID {
+			b.pending = append(b.pending[:i], b.pending[i+1:]...)
+			return
+		}
+	}
+	for _, t := range b.ready {
+		batch, ok := b.batches[t.GetTaskID()]
+		if !ok {
+			continue
+		}
+		for _, m := range batch.Members {
+			if m.GetTaskID() == taskID {
+				b.dissolve(batch, b.waiting())
+				return
+			}
+		}
+	}
+}
+
+// waiting returns the IDs of the tasks waiting on the underlying task manager
+func (b *BatchingTaskManager) waiting() map[common.TaskID]bool {
+	ids := make(map[common.TaskID]bool)
+	for _, t := range b.tm.GetAllTasks() {
+		ids[t.GetTaskID()] = true
+	}
+	return ids
+}
+
+// dissolve removes a released batch which can no longer be claimed whole. Its members still waiting go back to the pending tasks,
+// to be batched again
+func (b *BatchingTaskManager) dissolve(batch *BatchTask, waiting map[common.TaskID]bool) {
+	for i, t := range b.ready {
+		if t.GetTaskID() == batch.GetTaskID() {
+			b.ready = append(b.ready[:i], b.ready[i+1:]...)
+			break
+		}
+	}
+	for _, p := range b.groups[batch.GetTaskID()] {
+		if waiting[p.task.GetTaskID()] {
+			b.pending = append(b.pending, p)
+		}
+	}
+	delete(b.batches, batch.GetTaskID())
+	delete(b.groups, batch.GetTaskID())
+	sort.SliceStable(b.pending, func(i, j int) bool { return b.pending[i].since.Before(b.pending[j].since) })
+}
+
+// prune drops the released and pending tasks taken behind the back of the batching task manager, on the underlying one
+func (b *BatchingTaskManager) prune() {
+	waiting := b.waiting()
+	for _, t := range append([]common.Task(nil), b.ready...) {
+		if batch, ok := b.batches[t.GetTaskID()]; ok {
+			for _, m := range batch.Members {
+				if !waiting[m.GetTaskID()] {
+					b.dissolve(batch, waiting)
+					break
+				}
+			}
+		} else if !waiting[t.GetTaskID()] {
+			b.take(t.GetTaskID())
+		}
+	}
+	var pending []pendingTask
+	for _, p := range b.pending {
+		if waiting[p.task.GetTaskID()] {
+			pending = append(pending, p)
+		}
+	}
+	b.pending = pending
+}
+
+func (b *BatchingTaskManager) compatible(batch []common.Task, t common.Task) bool {
+	for _, r := range b.config.Rules {
+		if !r.Compatible(batch, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// release groups the pending tasks, oldest first, and moves the batches that are full or waited long enough to the ready queue
+func (b *BatchingTaskManager) release() {
+	b.prune()
+	now := b.Now()
+	remaining := b.pending
+	var waiting []pendingTask
+	for len(remaining) > 0 {
+		seed := remaining[0]
+		members := []common.Task{seed.task}
+		group := []pendingTask{seed}
+		var rest []pendingTask
+		for _, p := range remaining[1:] {
+			if len(members) < b.config.MaxBatchSize && b.compatible(members, p.task) {
+				members = append(members, p.task)
+				group = append(group, p)
+			} else {
+				rest = append(rest, p)
+			}
+		}
+		if len(members) >= b.config.MaxBatchSize || now.Sub(seed.since) >= b.config.MaxWait {
+			if len(members) == 1 {
+				b.ready = append(b.ready, seed.task)
+			} else {
+				batch := NewBatchTask(members)
+				b.batches[batch.GetTaskID()] = batch
+				b.groups[batch.GetTaskID()] = group
+				b.ready = append(b.ready, batch)
+			}
+		} else {
+			waiting = append(waiting, group...)
+		}
+		remaining = rest
+	}
+	sort.SliceStable(waiting, func(i, j int) bool { return waiting[i].since.Before(waiting[j].since) })
+	b.pending = waiting
+}
@@ -0,0 +1,127 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"fmt"
+	"maze/common"
+	"time"
+
+	"gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+const (
+	timePriorityKind = "time_priority"
+	multiStopKind    = "multi_stop"
+)
+
+// StopRecord is the serializable form of a common.TaskStop, locations are kept as node IDs
+type StopRecord struct {
+	Node    int64           `json:"node"`
+	Type    common.StopType `json:"type"`
+	Payload int             `json:"payload"`
+	Item    string          `json:"item,omitempty"`
+}
+
+// TaskRecord is the serializable form of the tasks in this package, locations are kept as node IDs
+type TaskRecord struct {
+	Kind            string              `json:"kind"`
+	ID              common.TaskID       `json:"id"`
+	Origin          *int64              `json:"origin,omitempty"`
+	Destination     *int64              `json:"destination,omitempty"`
+	Stops           []StopRecord        `json:"stops,omitempty"`
+	Status          common.TaskStatus   `json:"status"`
+	OriginationTime time.Time           `json:"originationTime"`
+	CompletionTime  time.Time           `json:"completionTime,omitempty"`
+	Requires        []common.Capability `json:"requires,omitempty"`
+}
+
+func nodeID(n graph.Node) *int64 {
+	if n == nil {
+		return nil
+	}
+	id := n.ID()
+	return &id
+}
+
+func node(id *int64) graph.Node {
+	if id == nil {
+		return nil
+	}
+	return simple.Node(*id)
+}
+
+// EncodeTask converts a task into its serializable form
+func EncodeTask(t common.Task) (TaskRecord, error) {
+	switch v := t.(type) {
+	case *TimePriorityTask:
+		return EncodeTask(*v)
+	case TimePriorityTask:
+		return TaskRecord{
+			Kind:            timePriorityKind,
+			ID:              v.ID,
+			Origin:          nodeID(v.Origin),
+			Destination:     nodeID(v.Destination),
+			Status:          v.Status,
+			OriginationTime: v.OriginationTime,
+			CompletionTime:  v.CompletionTime,
+		}, nil
+	case *MultiStopTask:
+		r := TaskRecord{
+			Kind:            multiStopKind,
+			ID:              v.ID,
+			Status:          v.Status,
+			OriginationTime: v.OriginationTime,
+			Requires:        v.Requires,
+		}
+		for _, s := range v.Stops {
+			r.Stops = append(r.Stops, StopRecord{s.Location.ID(), s.Type, s.Payload, s.Item})
+		}
+		return r, nil
+	default:
+		return TaskRecord{}, fmt.Errorf("task type %T can't be encoded", t)
+	}
+}
+
+// DecodeTask rebuilds a task from its serializable form. Locations are restored as simple.Node
+func DecodeTask(r TaskRecord) (common.Task, error) {
+	switch r.Kind {
+	case timePriorityKind:
+		return &TimePriorityTask{
+			ID:              r.ID,
+			Origin:          node(r.Origin),
+			Destination:     node(r.Destination),
+			Status:          r.Status,
+			OriginationTime: r.OriginationTime,
+			CompletionTime:  r.CompletionTime,
+		}, nil
+	case multiStopKind:
+		t := &MultiStopTask{
+			ID:              r.ID,
+			Status:          r.Status,
+			OriginationTime: r.OriginationTime,
+			Requires:        r.Requires,
+		}
+		for _, s := range r.Stops {
+			t.Stops = append(t.Stops, common.TaskStop{Location: simple.Node(s.Node), Type: s.Type, Payload: s.Payload, Item: s.Item})
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("unknown task kind %q", r.Kind)
+	}
+}
@@ -0,0 +1,315 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"maze/common"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	walFile      = "tasks.wal"
+	snapshotFile = "tasks.snapshot"
+)
+
+const (
+	opAdd    = "add"
+	opClaim  = "claim"
+	opUpdate = "update"
+)
+
+// walRecord is a single entry of the write-ahead log
+type walRecord struct {
+	Seq    uint64            `json:"seq"`
+	Op     string            `json:"op"`
+	Task   *TaskRecord       `json:"task,omitempty"`
+	TaskID common.TaskID     `json:"taskId"`
+	Robot  common.RobotID    `json:"robot"`
+	Status common.TaskStatus `json:"status"`
+	Time   time.Time         `json:"time"`
+	// Order is the position of an added task in the queue
+	Order uint64 `json:"order,omitempty"`
+}
+
+// snapshot is the state of the task manager as of the log entry Seq, kept in the format of simulation checkpoints
+type snapshot struct {
+	Seq uint64 `json:"seq"`
+	TaskManagerState
+}
+
+// DurableTaskManager is a SimulatedTaskManager which appends every add, claim and update to a write-ahead log in a directory.
+// Opening the directory again recovers the exact state, from the latest snapshot and the log entries written after it
+type DurableTaskManager struct {
+	*SimulatedTaskManager
+	dir string
+	wal *os.File
+	seq uint64
+	// Sync flushes the log to disk after every entry, so the state also survives machine crashes rather than only process crashes
+	Sync bool
+}
+
+// OpenDurableTaskManager opens, or creates, the task state kept in dir
+func OpenDurableTaskManager(dir string) (*DurableTaskManager, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	d := &DurableTaskManager{SimulatedTaskManager: CreateSimulatedTaskManager(), dir: dir}
+	if err := d.recover(); err != nil {
+		return nil, err
+	}
+	wal, err := os.OpenFile(filepath.Join(dir, walFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	d.wal = wal
+	return d, nil
+}
+
+func (d *DurableTaskManager) AddTask(t common.Task) bool {
+	r, err := EncodeTask(t)
+	if err != nil || t.GetStatus() == common.Completed {
+		return false
+	}
+	if _, ok := d.tasks[t.GetTaskID()]; ok {
+		return false
+	}
+	added := false
+	err = d.log(walRecord{Op: opAdd, Task: &r, TaskID: t.GetTaskID(), Order: d.added + 1}, func() error {
+		added = d.SimulatedTaskManager.AddTask(t)
+		return nil
+	})
+	return err == nil && added
+}
+
+func (d *DurableTaskManager) AddTasks(tList []common.Task) bool {
+	result := true
+	for _, t := range tList {
+		result = d.AddTask(t) && result
+	}
+	return result
+}
+
+func (d *DurableTaskManager) ClaimTask(taskID common.TaskID, robotID common.RobotID) error {
+	if err := d.check(taskID, common.Assigned); err != nil {
+		return err
+	}
+	return d.log(walRecord{Op: opClaim, TaskID: taskID, Robot: robotID}, func() error {
+		return d.SimulatedTaskManager.ClaimTask(taskID, robotID)
+	})
+}
+
+func (d *DurableTaskManager) TaskUpdate(taskID common.TaskID, status common.TaskStatus) error {
+	if err := d.check(taskID, status); err != nil {
+		return err
+	}
+	return d.log(walRecord{Op: opUpdate, TaskID: taskID, Status: status}, func() error {
+		return d.SimulatedTaskManager.TaskUpdate(taskID, status)
+	})
+}
+
+// check fails with the error the status change would fail with, so that only changes which apply are logged.
+// Changes are logged before they apply, a change which can't be logged leaves the state as it was
+func (d *DurableTaskManager) check(taskID common.TaskID, status common.TaskStatus) error {
+	_, waiting := d.tasks[taskID]
+	_, active := d.active[taskID]
+	switch {
+	case status == common.Completed && !active:
+		return errors.New("status can't jump from UnAssigned to Completed")
+	case status == common.Assigned && !waiting:
+		return errors.New("task not found")
+	case status == common.Unassigned && !active:
+		return errors.New("only active tasks can be released")
+	}
+	return nil
+}
+
+// Compact writes the whole state to the snapshot file, and truncates the log
+func (d *DurableTaskManager) Compact() error {
+	state, err := d.SimulatedTaskManager.Snapshot()
+	if err != nil {
+		return err
+	}
+	return d.compact(state)
+}
+
+// Restore replaces the tasks with the saved ones. The saved state is written to the snapshot file before it applies,
+// it replaces the log of the changes leading to the state before
+func (d *DurableTaskManager) Restore(s TaskManagerState) error {
+	// a state which can't be restored is refused before it reaches the disk
+	if err := CreateSimulatedTaskManager().Restore(s); err != nil {
+		return err
+	}
+	if err := d.compact(s); err != nil {
+		return err
+	}
+	return d.SimulatedTaskManager.Restore(s)
+}
+
+func (d *DurableTaskManager) compact(state TaskManagerState) error {
+	tmp := filepath.Join(d.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err = json.NewEncoder(f).Encode(snapshot{d.seq, state}); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, filepath.Join(d.dir, snapshotFile)); err != nil {
+		return err
+	}
+	// entries up to the snapshot sequence are skipped on recovery, so a crash before truncation is harmless
+	return d.wal.Truncate(0)
+}
+
+// Close closes the log
+func (d *DurableTaskManager) Close() error {
+	return d.wal.Close()
+}
+
+// log writes the entry to the log, then applies the change with its event stamped at the time of the entry
+func (d *DurableTaskManager) log(r walRecord, apply func() error) error {
+	r.Time = d.Now()
+	if err := d.append(r); err != nil {
+		return err
+	}
+	return d.at(r.Time, apply)
+}
+
+func (d *DurableTaskManager) append(r walRecord) error {
+	r.Seq = d.seq + 1
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err = d.wal.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	if d.Sync {
+		if err = d.wal.Sync(); err != nil {
+			return err
+		}
+	}
+	d.seq = r.Seq
+	return nil
+}
+
+func (d *DurableTaskManager) recover() error {
+	if err := d.loadSnapshot(); err != nil {
+		return err
+	}
+	f, err := os.Open(filepath.Join(d.dir, walFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := bufio.NewReader(f)
+	var valid int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// a partial last line is an entry torn by a crash, it was never acknowledged. Cut it so new entries start on a fresh line
+			return os.Truncate(f.Name(), valid)
+		} else if err != nil {
+			return err
+		}
+		var r walRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		valid += int64(len(line))
+		if r.Seq <= d.seq {
+			continue
+		}
+		if err := d.replay(r); err != nil {
+			return err
+		}
+		d.seq = r.Seq
+	}
+}
+
+// at applies a change with its events stamped at the given time, so replaying an entry stamps the time it was logged at
+func (d *DurableTaskManager) at(t time.Time, apply func() error) error {
+	s := d.SimulatedTaskManager
+	now := s.Now
+	s.Now = func() time.Time { return t }
+	defer func() { s.Now = now }()
+	return apply()
+}
+
+func (d *DurableTaskManager) replay(r walRecord) error {
+	s := d.SimulatedTaskManager
+	return d.at(r.Time, func() error {
+		switch r.Op {
+		case opAdd:
+			if r.Task == nil {
+				return errors.New("add entry without task")
+			}
+			t, err := DecodeTask(*r.Task)
+			if err != nil {
+				return err
+			}
+			s.AddTask(t)
+			// logs written before tasks kept their order are replayed in the order of their entries
+			if h, ok := s.history[t.GetTaskID()]; ok && r.Order > 0 {
+				h.seq = r.Order
+				if r.Order > s.added {
+					s.added = r.Order
+				}
+			}
+			return nil
+		case opClaim:
+			return s.ClaimTask(r.TaskID, r.Robot)
+		case opUpdate:
+			return s.TaskUpdate(r.TaskID, r.Status)
+		default:
+			return errors.New("unknown log entry " + r.Op)
+		}
+	})
+}
+
+func (d *DurableTaskManager) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(d.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	var snap snapshot
+	if err := json.NewDecoder(f).Decode(&snap); err != nil {
+		return err
+	}
+	if err := d.SimulatedTaskManager.Restore(snap.TaskManagerState); err != nil {
+		return err
+	}
+	d.seq = snap.Seq
+	return nil
+}
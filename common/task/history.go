@@ -0,0 +1,101 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"maze/common"
+	"time"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// TaskEvent is a status change of a task. Robot is set on claims
+type TaskEvent struct {
+	Status common.TaskStatus
+	Robot  common.RobotID
+	Time   time.Time
+}
+
+// TaskHistory is a task with its current status, the robot carrying it, and all of its events, oldest first.
+// ETA is the predicted completion of the task, its Robot is zero until a prediction is made
+type TaskHistory struct {
+	Task   common.Task
+	Status common.TaskStatus
+	Robot  common.RobotID
+	Events []TaskEvent
+	ETA    common.ETA
+	// seq orders the tasks by the time they were added
+	seq uint64
+}
+
+// ArchiveRetention bounds the completed tasks kept for tracing. Completed tasks are dropped once older than MaxAge,
+// or oldest first beyond MaxEntries. Zero values disable the bound
+type ArchiveRetention struct {
+	MaxAge     time.Duration
+	MaxEntries int
+}
+
+// TaskQuery filters task histories. Zero valued fields match everything. A history is within the time window when any of its events is
+type TaskQuery struct {
+	Status      *common.TaskStatus
+	Robot       common.RobotID
+	From        time.Time
+	To          time.Time
+	Origin      graph.Node
+	Destination graph.Node
+}
+
+// WithStatus restricts the query to tasks currently in the given status
+func (q TaskQuery) WithStatus(status common.TaskStatus) TaskQuery {
+	q.Status = &status
+	return q
+}
+
+// Match checks whether a task history satisfies the query
+func (q TaskQuery) Match(h TaskHistory) bool {
+	if q.Status != nil && *q.Status != h.Status {
+		return false
+	}
+	if q.Robot != (common.RobotID{}) && q.Robot != h.Robot {
+		return false
+	}
+	if q.Origin != nil && (h.Task.GetOrigination() == nil || q.Origin.ID() != h.Task.GetOrigination().ID()) {
+		return false
+	}
+	if q.Destination != nil && (h.Task.GetDestination() == nil || q.Destination.ID() != h.Task.GetDestination().ID()) {
+		return false
+	}
+	if q.From.IsZero() && q.To.IsZero() {
+		return true
+	}
+	for _, e := range h.Events {
+		if (q.From.IsZero() || !e.Time.Before(q.From)) && (q.To.IsZero() || !e.Time.After(q.To)) {
+			return true
+		}
+	}
+	return false
+}
+
+// completedAt returns the time of the completion event of a history
+func (h *TaskHistory) completedAt() time.Time {
+	for i := len(h.Events) - 1; i >= 0; i-- {
+		if h.Events[i].Status == common.Completed {
+			return h.Events[i].Time
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,134 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"errors"
+	"fmt"
+	"maze/common"
+	"time"
+
+	"github.com/google/uuid"
+	"gonum.org/v1/gonum/graph"
+)
+
+// MultiStopTask is a task visiting an ordered list of stops, picking up and dropping payload along the way
+type MultiStopTask struct {
+	ID              common.TaskID
+	Stops           []common.TaskStop
+	Status          common.TaskStatus
+	OriginationTime time.Time
+	// Requires lists the capabilities a robot needs to claim the task
+	Requires []common.Capability
+}
+
+// NewMultiStopTask creates an unassigned task over the given stops
+func NewMultiStopTask(stops ...common.TaskStop) *MultiStopTask {
+	id, _ := uuid.NewUUID()
+	return &MultiStopTask{
+		ID:              id,
+		Stops:           stops,
+		Status:          common.Unassigned,
+		OriginationTime: time.Now(),
+	}
+}
+
+// Priority function of MultiStopTask implements interface functions for PriorityTask
+func (t *MultiStopTask) Priority() int64 {
+	return t.OriginationTime.Unix()
+}
+
+// GetTaskID function of MultiStopTask implements interface function for Task interface
+func (t *MultiStopTask) GetTaskID() common.TaskID {
+	return t.ID
+}
+
+// GetOrigination returns the location of the first stop
+func (t *MultiStopTask) GetOrigination() graph.Node {
+	if len(t.Stops) == 0 {
+		return nil
+	}
+	return t.Stops[0].Location
+}
+
+// GetDestination returns the location of the last stop
+func (t *MultiStopTask) GetDestination() graph.Node {
+	if len(t.Stops) == 0 {
+		return nil
+	}
+	return t.Stops[len(t.Stops)-1].Location
+}
+
+func (t *MultiStopTask) UpdateStatus(status common.TaskStatus) error {
+	t.Status = status
+	return nil
+}
+
+func (t *MultiStopTask) GetStatus() common.TaskStatus {
+	return t.Status
+}
+
+// RequiredCapabilities returns the capabilities a robot needs to claim the task
+func (t *MultiStopTask) RequiredCapabilities() []common.Capability {
+	return t.Requires
+}
+
+// GetStops returns the ordered stops of the task
+func (t *MultiStopTask) GetStops() []common.TaskStop {
+	return t.Stops
+}
+
+// ValidateStops checks that the stops can be visited in order: there is at least one, payloads are not negative,
+// and no stop drops more payload than was picked up before it
+func ValidateStops(stops []common.TaskStop) error {
+	if len(stops) == 0 {
+		return errors.New("task has no stops")
+	}
+	load := 0
+	for i, s := range stops {
+		if s.Payload < 0 {
+			return fmt.Errorf("stop %d has a negative payload", i)
+		}
+		switch s.Type {
+		case common.PickupStop:
+			load += s.Payload
+		case common.DropStop:
+			if s.Payload > load {
+				return fmt.Errorf("stop %d drops more payload than is carried", i)
+			}
+			load -= s.Payload
+		}
+	}
+	return nil
+}
+
+// PeakPayload returns the largest payload carried at any point while visiting the stops in order
+func PeakPayload(stops []common.TaskStop) int {
+	load, peak := 0, 0
+	for _, s := range stops {
+		switch s.Type {
+		case common.PickupStop:
+			load += s.Payload
+		case common.DropStop:
+			load -= s.Payload
+		}
+		if load > peak {
+			peak = load
+		}
+	}
+	return peak
+}
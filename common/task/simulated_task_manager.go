@@ -19,55 +19,65 @@ package task
 import (
 	"errors"
 	"maze/common"
+	"sort"
 	"sync"
+	"time"
 )
 
 type SimulatedTaskManager struct {
 	tasks   map[common.TaskID]common.Task
 	active  map[common.TaskID]common.Task
 	archive map[common.TaskID]common.Task
+	// completed lists the archived tasks in the order they were completed, oldest first, so pruning stops at the first task retained
+	completed []common.TaskID
+	// history records the events of every tracked task, including the archived ones
+	history  map[common.TaskID]*TaskHistory
+	added    uint64
+	finished int
+	// Retention bounds how long completed tasks stay in the archive
+	Retention ArchiveRetention
+	// Now is the clock used to stamp task events
+	Now func() time.Time
 }
 
 func CreateSimulatedTaskManager() *SimulatedTaskManager {
 	return &SimulatedTaskManager{
-		make(map[common.TaskID]common.Task),
-		make(map[common.TaskID]common.Task),
-		make(map[common.TaskID]common.Task),
+		tasks:   make(map[common.TaskID]common.Task),
+		active:  make(map[common.TaskID]common.Task),
+		archive: make(map[common.TaskID]common.Task),
+		history: make(map[common.TaskID]*TaskHistory),
+		Now:     time.Now,
 	}
 }
 func (stm *SimulatedTaskManager) GetBroadcastInfo() interface{} {
 	return struct{}{}
 }
 
+// GetAllTasks returns the tasks waiting for a robot, in the order they were added
 func (stm *SimulatedTaskManager) GetAllTasks() []common.Task {
 	var values []common.Task
 	for _, t := range stm.tasks {
 		values = append(values, t)
 	}
+	sort.Slice(values, func(i, j int) bool {
+		return stm.history[values[i].GetTaskID()].seq < stm.history[values[j].GetTaskID()].seq
+	})
 	return values
 }
 
 func (stm *SimulatedTaskManager) GetNextTask() common.Task {
-	if len(stm.tasks) == 0 {
-		return nil
-	}
-	for _, v := range stm.tasks {
+	for _, v := range stm.GetAllTasks() {
 		if v.GetStatus() != common.Assigned {
 			return v
 		}
-
 	}
 	return nil
 }
 
 func (stm *SimulatedTaskManager) GetTasks(n int) []common.Task {
-	values := make([]common.Task, n)
-	for _, t := range stm.tasks {
-		n -= 1
-		values = append(values, t)
-		if n == 0 {
-			break
-		}
+	values := stm.GetAllTasks()
+	if n < len(values) {
+		return values[:n]
 	}
 	return values
 }
@@ -80,6 +90,10 @@ func (stm *SimulatedTaskManager) TaskUpdate(taskID common.TaskID, status common.
 		if t, ok := stm.active[taskID]; ok {
 			stm.archive[taskID] = t
 			delete(stm.active, taskID)
+			stm.completed = append(stm.completed, taskID)
+			stm.finished++
+			stm.record(taskID, common.Completed, stm.history[taskID].Robot)
+			stm.prune()
 			return nil
 		} else {
 			return errors.New("status can't jump from UnAssigned to Completed")
@@ -89,26 +103,160 @@ func (stm *SimulatedTaskManager) TaskUpdate(taskID common.TaskID, status common.
 		if t, ok := stm.tasks[taskID]; ok {
 			stm.active[taskID] = t
 			delete(stm.tasks, taskID)
+			stm.record(taskID, common.Assigned, stm.history[taskID].Robot)
 			return nil
 		} else {
 			return errors.New("task not found")
 		}
 
+	case common.Unassigned:
+		// release an active task back to the queue, so another robot can claim it
+		if t, ok := stm.active[taskID]; ok {
+			stm.tasks[taskID] = t
+			delete(stm.active, taskID)
+			stm.record(taskID, common.Unassigned, common.RobotID{})
+			stm.history[taskID].Robot = common.RobotID{}
+			stm.history[taskID].ETA = common.ETA{}
+			return nil
+		} else {
+			return errors.New("only active tasks can be released")
+		}
+
 	default:
 		return nil
 	}
 }
 
+// ClaimTask assigns an available task to a robot
+func (stm *SimulatedTaskManager) ClaimTask(taskID common.TaskID, robotID common.RobotID) error {
+	if err := stm.TaskUpdate(taskID, common.Assigned); err != nil {
+		return err
+	}
+	h := stm.history[taskID]
+	h.Robot = robotID
+	h.Events[len(h.Events)-1].Robot = robotID
+	return nil
+}
+
+// SetETA records the predicted completion tick of an active task. The first prediction of a robot is kept as the initial one
+func (stm *SimulatedTaskManager) SetETA(taskID common.TaskID, robotID common.RobotID, tick int) {
+	h, ok := stm.history[taskID]
+	if !ok || h.Status != common.Assigned {
+		return
+	}
+	if h.ETA.Robot != robotID {
+		h.ETA = common.ETA{Robot: robotID, Initial: tick}
+	}
+	h.ETA.Latest = tick
+}
+
+// ETA returns the predicted completion of a task, false when there is none
+func (stm *SimulatedTaskManager) ETA(taskID common.TaskID) (common.ETA, bool) {
+	h, ok := stm.history[taskID]
+	if !ok || h.ETA.Robot == (common.RobotID{}) {
+		return common.ETA{}, false
+	}
+	return h.ETA, true
+}
+
+// ETAs returns the predicted completion of the active tasks which have one
+func (stm *SimulatedTaskManager) ETAs() map[common.TaskID]common.ETA {
+	etas := make(map[common.TaskID]common.ETA)
+	for id := range stm.active {
+		if eta, ok := stm.ETA(id); ok {
+			etas[id] = eta
+		}
+	}
+	return etas
+}
+
+// Carrier returns the robot which claimed the task
+func (stm *SimulatedTaskManager) Carrier(taskID common.TaskID) (common.RobotID, bool) {
+	h, ok := stm.history[taskID]
+	if !ok || h.Robot == (common.RobotID{}) {
+		return common.RobotID{}, false
+	}
+	return h.Robot, true
+}
+
+// History returns the events of a task, as long as it is tracked or retained in the archive
+func (stm *SimulatedTaskManager) History(taskID common.TaskID) (TaskHistory, bool) {
+	stm.prune()
+	h, ok := stm.history[taskID]
+	if !ok {
+		return TaskHistory{}, false
+	}
+	return stm.copyOf(h), true
+}
+
+// Query returns the histories of tracked and archived tasks matching the query, ordered by their first event
+func (stm *SimulatedTaskManager) Query(q TaskQuery) []TaskHistory {
+	stm.prune()
+	var result []TaskHistory
+	for _, h := range stm.history {
+		if c := stm.copyOf(h); q.Match(c) {
+			result = append(result, c)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		ti, tj := result[i].Events[0].Time, result[j].Events[0].Time
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return result[i].Task.GetTaskID().String() < result[j].Task.GetTaskID().String()
+	})
+	return result
+}
+
+func (stm *SimulatedTaskManager) copyOf(h *TaskHistory) TaskHistory {
+	c := *h
+	c.Events = append([]TaskEvent{}, h.Events...)
+	return c
+}
+
+// record appends an event to the history of a task, and sets its current status
+func (stm *SimulatedTaskManager) record(taskID common.TaskID, status common.TaskStatus, robotID common.RobotID) {
+	h, ok := stm.history[taskID]
+	if !ok {
+		return
+	}
+	h.Status = status
+	h.Events = append(h.Events, TaskEvent{status, robotID, stm.Now()})
+}
+
+// prune drops the completed tasks beyond the retention of the archive, oldest first. It runs on every completion and read,
+// so tasks past MaxAge are never handed out
+func (stm *SimulatedTaskManager) prune() {
+	r := stm.Retention
+	if r.MaxAge <= 0 && r.MaxEntries <= 0 {
+		return
+	}
+	now := stm.Now()
+	for len(stm.completed) > 0 {
+		id := stm.completed[0]
+		tooOld := r.MaxAge > 0 && now.Sub(stm.history[id].completedAt()) > r.MaxAge
+		tooMany := r.MaxEntries > 0 && len(stm.completed) > r.MaxEntries
+		if !tooOld && !tooMany {
+			return
+		}
+		delete(stm.archive, id)
+		delete(stm.history, id)
+		stm.completed = stm.completed[1:]
+	}
+}
+
 func (stm *SimulatedTaskManager) AddTask(t common.Task) bool {
 	if t.GetStatus() == common.Completed {
 		return false
 	} else {
-		if _, ok := stm.tasks[t.GetTaskID()]; ok {
-			// task already in the tracker
-			// edge case, return false for now
+		if _, ok := stm.history[t.GetTaskID()]; ok {
+			// task already tracked, waiting, active or archived. Adding it again would replace its history
 			return false
 		} else {
 			stm.tasks[t.GetTaskID()] = t
+			stm.added++
+			stm.history[t.GetTaskID()] = &TaskHistory{Task: t, Status: common.Unassigned, seq: stm.added}
+			stm.record(t.GetTaskID(), common.Unassigned, common.RobotID{})
 			return true
 		}
 	}
@@ -125,7 +273,15 @@ func (stm *SimulatedTaskManager) AddTasks(tList []common.Task) bool {
 func (stm *SimulatedTaskManager) HasTasks() bool {
 	return len(stm.tasks) != 0
 }
+
+// FinishedCount returns the number of tasks completed, including the ones no longer retained in the archive
 func (stm *SimulatedTaskManager) FinishedCount() int {
+	return stm.finished
+}
+
+// ArchivedCount returns the number of completed tasks retained in the archive
+func (stm *SimulatedTaskManager) ArchivedCount() int {
+	stm.prune()
 	return len(stm.archive)
 }
 
@@ -155,11 +311,15 @@ func (stm *SimulatedTaskManagerSync) GetBroadcastInfo() interface{} {
 }
 
 func (stm *SimulatedTaskManagerSync) GetAllTasks() []common.Task {
+	stm.m.Lock()
+	defer stm.m.Unlock()
 	return stm.s.GetAllTasks()
 
 }
 
 func (stm *SimulatedTaskManagerSync) GetTasks(n int) []common.Task {
+	stm.m.Lock()
+	defer stm.m.Unlock()
 	return stm.s.GetTasks(n)
 }
 
@@ -169,6 +329,12 @@ func (stm *SimulatedTaskManagerSync) TaskUpdate(taskID common.TaskID, status com
 	return stm.s.TaskUpdate(taskID, status)
 }
 
+func (stm *SimulatedTaskManagerSync) ClaimTask(taskID common.TaskID, robotID common.RobotID) error {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	return stm.s.ClaimTask(taskID, robotID)
+}
+
 func (stm *SimulatedTaskManagerSync) AddTask(t common.Task) bool {
 	stm.m.Lock()
 	defer stm.m.Unlock()
@@ -193,6 +359,36 @@ func (stm *SimulatedTaskManagerSync) FinishedCount() int {
 	return stm.s.FinishedCount()
 }
 
+func (stm *SimulatedTaskManagerSync) Query(q TaskQuery) []TaskHistory {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	return stm.s.Query(q)
+}
+
+func (stm *SimulatedTaskManagerSync) History(taskID common.TaskID) (TaskHistory, bool) {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	return stm.s.History(taskID)
+}
+
+func (stm *SimulatedTaskManagerSync) SetETA(taskID common.TaskID, robotID common.RobotID, tick int) {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	stm.s.SetETA(taskID, robotID, tick)
+}
+
+func (stm *SimulatedTaskManagerSync) ETA(taskID common.TaskID) (common.ETA, bool) {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	return stm.s.ETA(taskID)
+}
+
+func (stm *SimulatedTaskManagerSync) ETAs() map[common.TaskID]common.ETA {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	return stm.s.ETAs()
+}
+
 func (stm *SimulatedTaskManagerSync) ActiveCount() int {
 	stm.m.Lock()
 	defer stm.m.Unlock()
@@ -0,0 +1,136 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package task
+
+import (
+	"fmt"
+	"maze/common"
+	"sort"
+)
+
+// Queue names the queue of a task manager a task sits in
+type Queue string
+
+const (
+	Waiting  Queue = "waiting"
+	Active   Queue = "active"
+	Archived Queue = "archived"
+)
+
+// TaskState is the serializable form of a tracked task, with the queue it sits in and its history
+type TaskState struct {
+	Task   TaskRecord        `json:"task"`
+	Queue  Queue             `json:"queue"`
+	Status common.TaskStatus `json:"status"`
+	Robot  common.RobotID    `json:"robot"`
+	Events []TaskEvent       `json:"events"`
+	ETA    common.ETA        `json:"eta"`
+	Seq    uint64            `json:"seq"`
+}
+
+// TaskManagerState is the serializable state of a simulated task manager, its tasks are ordered by the time they were added
+type TaskManagerState struct {
+	Tasks    []TaskState `json:"tasks"`
+	Added    uint64      `json:"added"`
+	Finished int         `json:"finished"`
+}
+
+// Snapshot saves the tasks of every queue with their histories
+func (stm *SimulatedTaskManager) Snapshot() (TaskManagerState, error) {
+	s := TaskManagerState{Added: stm.added, Finished: stm.finished}
+	for id, h := range stm.history {
+		r, err := EncodeTask(h.Task)
+		if err != nil {
+			return TaskManagerState{}, err
+		}
+		q := Archived
+		if _, ok := stm.tasks[id]; ok {
+			q = Waiting
+		} else if _, ok := stm.active[id]; ok {
+			q = Active
+		}
+		s.Tasks = append(s.Tasks, TaskState{r, q, h.Status, h.Robot, append([]TaskEvent{}, h.Events...), h.ETA, h.seq})
+	}
+	sort.Slice(s.Tasks, func(i, j int) bool { return s.Tasks[i].Seq < s.Tasks[j].Seq })
+	return s, nil
+}
+
+// Restore replaces the tasks of the task manager with the saved ones
+func (stm *SimulatedTaskManager) Restore(s TaskManagerState) error {
+	tasks := make(map[common.TaskID]common.Task)
+	active := make(map[common.TaskID]common.Task)
+	archive := make(map[common.TaskID]common.Task)
+	history := make(map[common.TaskID]*TaskHistory)
+	for _, ts := range s.Tasks {
+		t, err := DecodeTask(ts.Task)
+		if err != nil {
+			return err
+		}
+		switch ts.Queue {
+		case Waiting:
+			tasks[t.GetTaskID()] = t
+		case Active:
+			active[t.GetTaskID()] = t
+		case Archived:
+			archive[t.GetTaskID()] = t
+		default:
+			return fmt.Errorf("task %s sits in unknown queue %q", t.GetTaskID(), ts.Queue)
+		}
+		history[t.GetTaskID()] = &TaskHistory{t, ts.Status, ts.Robot, append([]TaskEvent{}, ts.Events...), ts.ETA, ts.Seq}
+	}
+	completed := make([]common.TaskID, 0, len(archive))
+	for id := range archive {
+		completed = append(completed, id)
+	}
+	sort.Slice(completed, func(i, j int) bool {
+		hi, hj := history[completed[i]], history[completed[j]]
+		if !hi.completedAt().Equal(hj.completedAt()) {
+			return hi.completedAt().Before(hj.completedAt())
+		}
+		return hi.seq < hj.seq
+	})
+	stm.tasks, stm.active, stm.archive, stm.history, stm.completed = tasks, active, archive, history, completed
+	stm.added, stm.finished = s.Added, s.Finished
+	return nil
+}
+
+// Task returns a tracked task by its ID
+func (stm *SimulatedTaskManager) Task(taskID common.TaskID) (common.Task, bool) {
+	h, ok := stm.history[taskID]
+	if !ok {
+		return nil, false
+	}
+	return h.Task, true
+}
+
+func (stm *SimulatedTaskManagerSync) Snapshot() (TaskManagerState, error) {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	return stm.s.Snapshot()
+}
+
+func (stm *SimulatedTaskManagerSync) Restore(s TaskManagerState) error {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	return stm.s.Restore(s)
+}
+
+func (stm *SimulatedTaskManagerSync) Task(taskID common.TaskID) (common.Task, bool) {
+	stm.m.Lock()
+	defer stm.m.Unlock()
+	return stm.s.Task(taskID)
+}
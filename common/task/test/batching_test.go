@@ -0,0 +1,198 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/world"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestBatchingGroupsSameDestination(t *testing.T) {
+	setup()
+	clock := &fakeClock{time.Now()}
+	btm := task.CreateBatchingTaskManager(stm, task.BatchConfig{MaxBatchSize: 2, MaxWait: time.Minute, Rules: []task.BatchRule{task.SameDestination()}})
+	btm.Now = clock.Now
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(8)))
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(9)))
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(8)))
+
+	b, ok := btm.GetNextTask().(*task.BatchTask)
+	if !ok {
+		t.Fatalf("Expect a composite task for the two tasks sharing destination 8")
+	}
+	if len(b.Members) != 2 || b.GetDestination().ID() != 8 {
+		t.Errorf("Batch should hold 2 tasks to destination 8, actual %+v", b)
+	}
+	if task.PeakPayload(b.GetStops()) != 2 {
+		t.Errorf("Batch should carry both tasks at once")
+	}
+	if btm.Pending() != 1 {
+		t.Errorf("Task to destination 9 should keep waiting, pending %d", btm.Pending())
+	}
+
+	if err := btm.TaskUpdate(b.GetTaskID(), common.Assigned); err != nil {
+		t.Fatal(err)
+	}
+	if btm.GetNextTask() != nil {
+		t.Errorf("Lone task should not be released before max wait")
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if next := btm.GetNextTask(); next == nil || next.GetDestination().ID() != 9 {
+		t.Errorf("Lone task should be released after max wait, actual %+v", next)
+	}
+	if err := btm.TaskUpdate(b.GetTaskID(), common.Completed); err != nil {
+		t.Fatal(err)
+	}
+	if stm.FinishedCount() != 2 {
+		t.Errorf("Completing the batch should complete its members, finished %d", stm.FinishedCount())
+	}
+}
+
+func TestBatchingSpatialCluster(t *testing.T) {
+	setup()
+	btm := task.CreateBatchingTaskManager(stm, task.BatchConfig{MaxBatchSize: 3, Rules: []task.BatchRule{task.WithinDistance(w.GetGraph(), 1)}})
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(4)))
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(12), w.GetGraph().Node(4)))
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(9)))
+
+	tasks := btm.GetTasks(3)
+	if len(tasks) != 2 {
+		t.Fatalf("Expect origins 1 and 2 to be clustered, and 12 on its own, actual %d batches", len(tasks))
+	}
+	if b, ok := tasks[0].(*task.BatchTask); !ok || len(b.Members) != 2 {
+		t.Errorf("First batch should hold the tasks from 1 and 2, actual %+v", tasks[0])
+	}
+}
+
+func TestRobotDeliversBatch(t *testing.T) {
+	inner := task.CreateSimulatedTaskManager()
+	btm := task.CreateBatchingTaskManager(inner, task.BatchConfig{MaxBatchSize: 2, Rules: []task.BatchRule{task.SameDestination()}})
+	bw := world.CreateWarehouseWorldWithTaskManager(btm)
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(bw.GetGraph().Node(1), bw.GetGraph().Node(8)))
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(bw.GetGraph().Node(2), bw.GetGraph().Node(8)))
+	r := robot.NewSimpleWarehouseRobotWithCapacity(uuid.New(), bw.GetGraph().Node(1), bw, 2)
+	for i := 0; i < 20; i++ {
+		r.Run()
+	}
+	if btm.HasTasks() || inner.FinishedCount() != 2 {
+		t.Errorf("Robot should deliver both tasks in one trip, finished %d", inner.FinishedCount())
+	}
+}
+
+func TestBatchingClaimsPendingAndPartialBatches(t *testing.T) {
+	setup()
+	clock := &fakeClock{time.Now()}
+	btm := task.CreateBatchingTaskManager(stm, task.BatchConfig{MaxBatchSize: 2, MaxWait: time.Minute, Rules: []task.BatchRule{task.SameDestination()}})
+	btm.Now = clock.Now
+	lone := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(9))
+	btm.AddTask(lone)
+	if err := btm.ClaimTask(lone.GetTaskID(), uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if btm.Pending() != 0 || btm.GetNextTask() != nil {
+		t.Errorf("Expect a task claimed while pending not to be handed out again")
+	}
+
+	first := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(8))
+	second := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(8))
+	btm.AddTasks([]common.Task{first, second})
+	b := btm.GetNextTask()
+	if b == nil {
+		t.Fatalf("Expect the two tasks to be batched")
+	}
+	// the second member is taken behind the batch's back, so claiming the batch fails half way
+	if err := stm.ClaimTask(second.GetTaskID(), uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+	if err := btm.ClaimTask(b.GetTaskID(), uuid.New()); err == nil {
+		t.Fatalf("Expect the claim of a batch with a taken member to fail")
+	}
+	if _, claimed := stm.Carrier(first.GetTaskID()); claimed || len(stm.GetAllTasks()) != 1 {
+		t.Errorf("Expect the first member to be released when the batch can't be claimed")
+	}
+}
+
+func TestBatchingHidesMembersAndPendingTasks(t *testing.T) {
+	setup()
+	clock := &fakeClock{time.Now()}
+	btm := task.CreateBatchingTaskManager(stm, task.BatchConfig{MaxBatchSize: 2, MaxWait: time.Minute, Rules: []task.BatchRule{task.SameDestination()}})
+	btm.Now = clock.Now
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(9)))
+	if btm.HasTasks() || len(btm.GetAllTasks()) != 0 {
+		t.Errorf("Expect a task waiting for its batch not to be offered")
+	}
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(8)))
+	btm.AddTask(task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(8)))
+	tasks := btm.GetAllTasks()
+	if _, ok := tasks[0].(*task.BatchTask); len(tasks) != 1 || !ok || !btm.HasTasks() {
+		t.Errorf("Expect only the batch to be offered, not its members, actual %+v", tasks)
+	}
+}
+
+func TestBatchingBreaksUpBatchWithTakenMember(t *testing.T) {
+	setup()
+	clock := &fakeClock{time.Now()}
+	btm := task.CreateBatchingTaskManager(stm, task.BatchConfig{MaxBatchSize: 2, MaxWait: time.Minute, Rules: []task.BatchRule{task.SameDestination()}})
+	btm.Now = clock.Now
+	first := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(8))
+	second := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(2), w.GetGraph().Node(8))
+	btm.AddTasks([]common.Task{first, second})
+	if _, ok := btm.GetNextTask().(*task.BatchTask); !ok {
+		t.Fatalf("Expect the two tasks to be batched")
+	}
+	if err := btm.ClaimTask(first.GetTaskID(), uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+	if btm.GetNextTask() != nil || btm.Pending() != 1 {
+		t.Errorf("Expect the batch to be broken up, and its other member to wait again")
+	}
+	clock.now = clock.now.Add(time.Minute)
+	if next := btm.GetNextTask(); next == nil || next.GetTaskID() != second.GetTaskID() {
+		t.Errorf("Expect the other member to be released on its own after max wait, actual %+v", next)
+	}
+
+	// a batch whose member is taken on the underlying task manager is broken up as well
+	if err := btm.ClaimTask(second.GetTaskID(), uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+	third := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(3), w.GetGraph().Node(9))
+	fourth := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(4), w.GetGraph().Node(9))
+	btm.AddTasks([]common.Task{third, fourth})
+	if _, ok := btm.GetNextTask().(*task.BatchTask); !ok {
+		t.Fatalf("Expect the two new tasks to be batched")
+	}
+	if err := stm.ClaimTask(third.GetTaskID(), uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+	if btm.GetNextTask() != nil || btm.Pending() != 1 {
+		t.Errorf("Expect the batch with a member taken to be dropped")
+	}
+}
@@ -0,0 +1,209 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"io/ioutil"
+	"maze/common"
+	"maze/common/task"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+func TestDurableTaskManagerRecovers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maze-tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := task.OpenDurableTaskManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rid := uuid.New()
+	done := task.NewTimePriorityTaskWithParameter(simple.Node(1), simple.Node(2))
+	active := task.NewMultiStopTask(
+		common.TaskStop{Location: simple.Node(3), Type: common.PickupStop, Payload: 1},
+		common.TaskStop{Location: simple.Node(4), Type: common.DropStop, Payload: 1},
+	)
+	d.AddTasks([]common.Task{done, active})
+	if err := d.ClaimTask(done.GetTaskID(), rid); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.TaskUpdate(done.GetTaskID(), common.Completed); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.ClaimTask(active.GetTaskID(), rid); err != nil {
+		t.Fatal(err)
+	}
+	waiting := task.NewTimePriorityTaskWithParameter(simple.Node(5), simple.Node(6))
+	d.AddTask(waiting)
+	d.Close()
+
+	// simulate a crash in the middle of writing an entry
+	wal, _ := os.OpenFile(filepath.Join(dir, "tasks.wal"), os.O_WRONLY|os.O_APPEND, 0644)
+	wal.WriteString(`{"seq":99,"op":"upd`)
+	wal.Close()
+
+	r, err := task.OpenDurableTaskManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.FinishedCount() != 1 || r.ActiveCount() != 1 || len(r.GetAllTasks()) != 1 {
+		t.Fatalf("Expect 1 finished, 1 active and 1 waiting task, got %d, %d, %d", r.FinishedCount(), r.ActiveCount(), len(r.GetAllTasks()))
+	}
+	if r.GetNextTask().GetTaskID() != waiting.GetTaskID() {
+		t.Errorf("Waiting task should be recovered")
+	}
+	if carrier, ok := r.Carrier(active.GetTaskID()); !ok || carrier != rid {
+		t.Errorf("Claim should be recovered, carrier %s", carrier)
+	}
+	if h, ok := r.History(done.GetTaskID()); !ok || len(h.Events) != 3 || h.Robot != rid {
+		t.Errorf("History should be recovered from the snapshot, actual %+v", h)
+	}
+	if err := r.TaskUpdate(active.GetTaskID(), common.Completed); err != nil {
+		t.Errorf("Recovered active multi-stop task should complete, %+v", err)
+	}
+	r.Close()
+	again, err := task.OpenDurableTaskManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer again.Close()
+	if again.FinishedCount() != 2 {
+		t.Errorf("Entries written after recovery should be recovered as well, finished %d", again.FinishedCount())
+	}
+}
+
+func TestDurableTaskManagerKeepsQueueOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maze-tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := task.OpenDurableTaskManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		d.AddTask(task.NewTimePriorityTaskWithParameter(simple.Node(i+1), simple.Node(i+2)))
+		if i == 9 {
+			if err := d.Compact(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	var expected []common.TaskID
+	for _, t := range d.GetAllTasks() {
+		expected = append(expected, t.GetTaskID())
+	}
+	d.Close()
+
+	for i := 0; i < 2; i++ {
+		r, err := task.OpenDurableTaskManager(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tasks := r.GetAllTasks()
+		if len(tasks) != len(expected) {
+			t.Fatalf("Expect %d waiting tasks, actual %d", len(expected), len(tasks))
+		}
+		for j, rt := range tasks {
+			if rt.GetTaskID() != expected[j] {
+				t.Errorf("recovery %d: expect task %d to keep its place in the queue", i, j)
+				break
+			}
+		}
+		r.Close()
+	}
+}
+
+func TestDurableTaskManagerKeepsStateOnLogFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maze-tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d, err := task.OpenDurableTaskManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := task.NewTimePriorityTaskWithParameter(simple.Node(1), simple.Node(2))
+	d.AddTask(waiting)
+	// writes to a closed log fail
+	d.Close()
+	if err := d.ClaimTask(waiting.GetTaskID(), uuid.New()); err == nil {
+		t.Errorf("Expect the claim to fail once it can't be logged")
+	}
+	if d.AddTask(task.NewTimePriorityTaskWithParameter(simple.Node(3), simple.Node(4))) {
+		t.Errorf("Expect the task not to be added once it can't be logged")
+	}
+	if tasks := d.GetAllTasks(); len(tasks) != 1 || tasks[0].GetTaskID() != waiting.GetTaskID() || d.ActiveCount() != 0 {
+		t.Errorf("Expect changes which can't be logged to leave the state as it was")
+	}
+}
+
+func TestDurableTaskManagerRestoresSavedState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "maze-tasks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	saved := task.CreateSimulatedTaskManager()
+	claimed := task.NewTimePriorityTaskWithParameter(simple.Node(1), simple.Node(2))
+	saved.AddTasks([]common.Task{claimed, task.NewTimePriorityTaskWithParameter(simple.Node(3), simple.Node(4))})
+	if err := saved.ClaimTask(claimed.GetTaskID(), uuid.New()); err != nil {
+		t.Fatal(err)
+	}
+	state, err := saved.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := task.OpenDurableTaskManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.AddTask(task.NewTimePriorityTaskWithParameter(simple.Node(5), simple.Node(6)))
+	if err := d.Restore(state); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	r, err := task.OpenDurableTaskManager(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	recovered, err := r.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recovered.Tasks) != 2 || r.ActiveCount() != 1 || len(r.GetAllTasks()) != 1 {
+		t.Errorf("Expect the restored state to replace the logged one, got %+v", recovered)
+	}
+}
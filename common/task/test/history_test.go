@@ -0,0 +1,130 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/task"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestTaskHistoryQuery(t *testing.T) {
+	setup()
+	clock := &fakeClock{time.Date(2019, 11, 1, 0, 0, 0, 0, time.UTC)}
+	stm.Now = clock.Now
+	addT1()
+	addT2()
+	rid := uuid.New()
+	clock.now = clock.now.Add(time.Minute)
+	stm.ClaimTask(t1.GetTaskID(), rid)
+	clock.now = clock.now.Add(time.Minute)
+	stm.TaskUpdate(t1.GetTaskID(), common.Completed)
+
+	h, ok := stm.History(t1.GetTaskID())
+	if !ok || len(h.Events) != 3 || h.Robot != rid || h.Status != common.Completed {
+		t.Fatalf("Expect add, claim and completion events on t1, actual %+v", h)
+	}
+	if h.Events[1].Status != common.Assigned || h.Events[1].Robot != rid {
+		t.Errorf("Claim event should name the robot, actual %+v", h.Events[1])
+	}
+	if h.Events[2].Robot != rid {
+		t.Errorf("Completion event should name the robot, actual %+v", h.Events[2])
+	}
+
+	if r := stm.Query(task.TaskQuery{}.WithStatus(common.Completed)); len(r) != 1 || r[0].Task != t1 {
+		t.Errorf("Expect t1 as the only completed task, actual %+v", r)
+	}
+	if r := stm.Query(task.TaskQuery{Robot: rid}); len(r) != 1 {
+		t.Errorf("Expect 1 task carried by the robot, actual %d", len(r))
+	}
+	if r := stm.Query(task.TaskQuery{Destination: w.GetGraph().Node(6)}); len(r) != 1 || r[0].Task != t2 {
+		t.Errorf("Expect t2 as the only task to node 6, actual %+v", r)
+	}
+	if r := stm.Query(task.TaskQuery{Origin: w.GetGraph().Node(1)}); len(r) != 2 {
+		t.Errorf("Expect both tasks from node 1, actual %d", len(r))
+	}
+	if r := stm.Query(task.TaskQuery{From: clock.now.Add(-30 * time.Second)}); len(r) != 1 || r[0].Task != t1 {
+		t.Errorf("Expect only t1 to have events in the last 30 seconds, actual %+v", r)
+	}
+}
+
+func TestArchiveRetention(t *testing.T) {
+	setup()
+	clock := &fakeClock{time.Now()}
+	stm.Now = clock.Now
+	stm.Retention = task.ArchiveRetention{MaxAge: time.Hour, MaxEntries: 2}
+	var tasks []*task.TimePriorityTask
+	for i := 0; i < 3; i++ {
+		tk := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(2))
+		stm.AddTask(tk)
+		stm.TaskUpdate(tk.GetTaskID(), common.Assigned)
+		stm.TaskUpdate(tk.GetTaskID(), common.Completed)
+		tasks = append(tasks, tk)
+		clock.now = clock.now.Add(time.Minute)
+	}
+	if stm.ArchivedCount() != 2 || stm.FinishedCount() != 3 {
+		t.Errorf("Expect 2 of 3 finished tasks retained, actual %d of %d", stm.ArchivedCount(), stm.FinishedCount())
+	}
+	if _, ok := stm.History(tasks[0].GetTaskID()); ok {
+		t.Errorf("Oldest completed task should be dropped from the archive")
+	}
+	clock.now = clock.now.Add(2 * time.Hour)
+	last := task.NewTimePriorityTaskWithParameter(w.GetGraph().Node(1), w.GetGraph().Node(2))
+	stm.AddTask(last)
+	stm.TaskUpdate(last.GetTaskID(), common.Assigned)
+	stm.TaskUpdate(last.GetTaskID(), common.Completed)
+	if stm.ArchivedCount() != 1 {
+		t.Errorf("Completed tasks older than max age should expire, archived %d", stm.ArchivedCount())
+	}
+}
+
+func TestArchiveRetentionOnRead(t *testing.T) {
+	setup()
+	clock := &fakeClock{time.Now()}
+	stm.Now = clock.Now
+	stm.Retention = task.ArchiveRetention{MaxAge: time.Hour}
+	addT1()
+	stm.TaskUpdate(t1.GetTaskID(), common.Assigned)
+	stm.TaskUpdate(t1.GetTaskID(), common.Completed)
+	clock.now = clock.now.Add(2 * time.Hour)
+	if _, ok := stm.History(t1.GetTaskID()); ok {
+		t.Errorf("Completed task older than max age should expire without another completion")
+	}
+	if r := stm.Query(task.TaskQuery{}); len(r) != 0 {
+		t.Errorf("Expect no history past max age, actual %+v", r)
+	}
+}
+
+func TestAddTaskRejectsTrackedIDs(t *testing.T) {
+	setup()
+	addT1()
+	rid := uuid.New()
+	stm.ClaimTask(t1.GetTaskID(), rid)
+	if stm.AddTask(t1) {
+		t.Errorf("Expect an active task not to be added again")
+	}
+	stm.TaskUpdate(t1.GetTaskID(), common.Completed)
+	t1.Status = common.Unassigned
+	if stm.AddTask(t1) {
+		t.Errorf("Expect an archived task not to be added again")
+	}
+	if h, _ := stm.History(t1.GetTaskID()); h.Status != common.Completed || h.Robot != rid {
+		t.Errorf("Expect the history of the task to be kept, actual %+v", h)
+	}
+}
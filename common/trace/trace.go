@@ -26,6 +26,8 @@ type MoveTrace struct {
 	Source    graph.Node
 	Target    graph.Node
 	Timestamp int
+	// Heading is where the robot faces after the move, NoHeading for robots which don't track it
+	Heading common.Heading
 }
 
 func (m *MoveTrace) GetType() common.TraceType {
@@ -62,3 +64,198 @@ func (m TaskExecutionTrace) GetType() common.TraceType {
 func (m TaskExecutionTrace) GetContent() interface{} {
 	return m
 }
+
+// PayloadTrace records a pick (positive Payload) or a drop (negative Payload), and the load of the robot afterwards. Item is the picked item, if any
+type PayloadTrace struct {
+	RobotID   common.RobotID
+	Location  graph.Node
+	Payload   int
+	Item      string
+	Load      int
+	Timestamp int
+}
+
+var PayloadTraceType common.TraceType = 3
+
+func (m *PayloadTrace) GetType() common.TraceType {
+	return PayloadTraceType
+}
+func (m *PayloadTrace) GetContent() interface{} {
+	return m
+}
+
+// DispatchTrace records a round of the global dispatcher. Cost is the total travel of the applied assignment, OptimalCost and GreedyCost are the totals both strategies would reach
+type DispatchTrace struct {
+	Timestamp   int
+	Assigned    int
+	Cost        float64
+	OptimalCost float64
+	GreedyCost  float64
+	// OptimalAssigned and GreedyAssigned are the pairs both strategies would assign, their costs only compare when they are equal
+	OptimalAssigned int
+	GreedyAssigned  int
+}
+
+var DispatchTraceType common.TraceType = 4
+
+func (m *DispatchTrace) GetType() common.TraceType {
+	return DispatchTraceType
+}
+func (m *DispatchTrace) GetContent() interface{} {
+	return m
+}
+
+// ChargeEvent enumerates what happens to the battery of a robot
+type ChargeEvent int
+
+const (
+	// ChargeQueued is emitted while the robot waits for a free slot at a charger
+	ChargeQueued ChargeEvent = iota
+	// ChargeCharging is emitted for every tick spent charging
+	ChargeCharging
+	// ChargeFull is emitted when the robot leaves the charger with a full battery
+	ChargeFull
+	// ChargeDepleted is emitted when the robot can't move for lack of energy
+	ChargeDepleted
+)
+
+// ChargeTrace records battery events of a robot
+type ChargeTrace struct {
+	RobotID   common.RobotID
+	Location  graph.Node
+	Event     ChargeEvent
+	Level     float64
+	Timestamp int
+}
+
+var ChargeTraceType common.TraceType = 5
+
+func (m *ChargeTrace) GetType() common.TraceType {
+	return ChargeTraceType
+}
+func (m *ChargeTrace) GetContent() interface{} {
+	return m
+}
+
+// FaultEvent enumerates what happens to a robot breaking down
+type FaultEvent int
+
+const (
+	// FaultStarted is emitted when the robot breaks down
+	FaultStarted FaultEvent = iota
+	// FaultOngoing is emitted for every tick the robot can't work because of its failure
+	FaultOngoing
+	// FaultRepaired is emitted when the robot is back to work
+	FaultRepaired
+)
+
+// FaultTrace records breakdowns and repairs of a robot
+type FaultTrace struct {
+	RobotID   common.RobotID
+	Location  graph.Node
+	Mode      common.FaultMode
+	Event     FaultEvent
+	Timestamp int
+}
+
+var FaultTraceType common.TraceType = 6
+
+func (m *FaultTrace) GetType() common.TraceType {
+	return FaultTraceType
+}
+func (m *FaultTrace) GetContent() interface{} {
+	return m
+}
+
+// ActionTrace records a tick spent on an action lasting several ticks, before it ends
+type ActionTrace struct {
+	RobotID   common.RobotID
+	Location  graph.Node
+	Action    common.ActionType
+	Status    common.ActionStatus
+	Remaining int
+	Timestamp int
+}
+
+var ActionTraceType common.TraceType = 7
+
+func (m *ActionTrace) GetType() common.TraceType {
+	return ActionTraceType
+}
+func (m *ActionTrace) GetContent() interface{} {
+	return m
+}
+
+// WaitTrace records a tick spent waiting in place. Until is the tick the robot waits for, 0 when it waits a number of ticks
+type WaitTrace struct {
+	RobotID   common.RobotID
+	Location  graph.Node
+	Remaining int
+	Until     int
+	Timestamp int
+}
+
+var WaitTraceType common.TraceType = 8
+
+func (m *WaitTrace) GetType() common.TraceType {
+	return WaitTraceType
+}
+func (m *WaitTrace) GetContent() interface{} {
+	return m
+}
+
+// DockEvent enumerates what happens to a robot docking at a station
+type DockEvent int
+
+const (
+	// DockQueued is emitted while the robot waits for a free slot at the station
+	DockQueued DockEvent = iota
+	// Docking is emitted for every tick spent docking
+	Docking
+	// Docked is emitted when the robot is docked
+	Docked
+	// Undocked is emitted when the robot leaves the station, which takes a tick
+	Undocked
+)
+
+// DockTrace records a robot docking at, or leaving, a station
+type DockTrace struct {
+	RobotID   common.RobotID
+	Location  graph.Node
+	Event     DockEvent
+	Remaining int
+	Timestamp int
+}
+
+var DockTraceType common.TraceType = 9
+
+func (m *DockTrace) GetType() common.TraceType {
+	return DockTraceType
+}
+func (m *DockTrace) GetContent() interface{} {
+	return m
+}
+
+// ETATrace records the predicted completion of a task against the tick it actually completed on.
+// Predicted is the first prediction for the robot carrying it, Latest the last one before completion
+type ETATrace struct {
+	TaskID    common.TaskID
+	RobotID   common.RobotID
+	Predicted int
+	Latest    int
+	Actual    int
+}
+
+var ETATraceType common.TraceType = 10
+
+func (m *ETATrace) GetType() common.TraceType {
+	return ETATraceType
+}
+func (m *ETATrace) GetContent() interface{} {
+	return m
+}
+
+// Error returns how many ticks late the task completed against its first prediction, negative when early
+func (m *ETATrace) Error() int {
+	return m.Actual - m.Predicted
+}
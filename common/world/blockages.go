@@ -0,0 +1,94 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package world
+
+import (
+	"maze/common"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// Blockages tracks the nodes of a world blocked by robots, a node stays blocked until every robot blocking it lets go
+type Blockages struct {
+	nodes map[int64]map[common.RobotID]bool
+	index map[int64]graph.Node
+	m     sync.Mutex
+}
+
+func CreateBlockages() *Blockages {
+	return &Blockages{nodes: make(map[int64]map[common.RobotID]bool), index: make(map[int64]graph.Node)}
+}
+
+// Block marks the node as blocked by the robot
+func (b *Blockages) Block(n graph.Node, by common.RobotID) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if _, ok := b.nodes[n.ID()]; !ok {
+		b.nodes[n.ID()] = make(map[common.RobotID]bool)
+		b.index[n.ID()] = n
+	}
+	b.nodes[n.ID()][by] = true
+}
+
+// Unblock lifts the blockage of the robot on the node
+func (b *Blockages) Unblock(n graph.Node, by common.RobotID) {
+	b.m.Lock()
+	defer b.m.Unlock()
+	if robots, ok := b.nodes[n.ID()]; ok {
+		delete(robots, by)
+		if len(robots) == 0 {
+			delete(b.nodes, n.ID())
+			delete(b.index, n.ID())
+		}
+	}
+}
+
+// IsBlocked checks whether any robot blocks the node
+func (b *Blockages) IsBlocked(n graph.Node) bool {
+	b.m.Lock()
+	defer b.m.Unlock()
+	_, ok := b.nodes[n.ID()]
+	return ok
+}
+
+// Blocked returns the blocked nodes ordered by ID
+func (b *Blockages) Blocked() []graph.Node {
+	b.m.Lock()
+	defer b.m.Unlock()
+	var nodes []graph.Node
+	for _, n := range b.index {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID() < nodes[j].ID() })
+	return nodes
+}
+
+// Blockers returns the robots blocking every blocked node, ordered by ID
+func (b *Blockages) Blockers() map[int64][]common.RobotID {
+	b.m.Lock()
+	defer b.m.Unlock()
+	blockers := make(map[int64][]common.RobotID)
+	for id, robots := range b.nodes {
+		for r := range robots {
+			blockers[id] = append(blockers[id], r)
+		}
+		sort.Slice(blockers[id], func(i, j int) bool { return blockers[id][i].String() < blockers[id][j].String() })
+	}
+	return blockers
+}
@@ -0,0 +1,130 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package world
+
+import (
+	"maze/common"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// ChargingStation is a charger on a node of the world, with a limited number of slots. Rate is the energy restored per tick
+type ChargingStation struct {
+	Node      graph.Node
+	Slots     int
+	Rate      float64
+	occupants map[common.RobotID]bool
+}
+
+// ChargingNetwork tracks the charging stations of a world and which robots occupy their slots
+type ChargingNetwork struct {
+	stations map[int64]*ChargingStation
+	m        sync.Mutex
+}
+
+func CreateChargingNetwork() *ChargingNetwork {
+	return &ChargingNetwork{stations: make(map[int64]*ChargingStation)}
+}
+
+// AddStation places a charger with the given slots and charge rate on a node
+func (c *ChargingNetwork) AddStation(n graph.Node, slots int, rate float64) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	c.stations[n.ID()] = &ChargingStation{n, slots, rate, make(map[common.RobotID]bool)}
+}
+
+// Stations returns the charging stations ordered by node ID
+func (c *ChargingNetwork) Stations() []*ChargingStation {
+	c.m.Lock()
+	defer c.m.Unlock()
+	var stations []*ChargingStation
+	for _, s := range c.stations {
+		stations = append(stations, s)
+	}
+	sort.Slice(stations, func(i, j int) bool { return stations[i].Node.ID() < stations[j].Node.ID() })
+	return stations
+}
+
+// At returns the charging station on a node, nil if there is none
+func (c *ChargingNetwork) At(n graph.Node) *ChargingStation {
+	c.m.Lock()
+	defer c.m.Unlock()
+	return c.stations[n.ID()]
+}
+
+// Reserve takes a slot of the station on the node for the robot. It returns false when all slots are taken
+func (c *ChargingNetwork) Reserve(n graph.Node, rid common.RobotID) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	s, ok := c.stations[n.ID()]
+	if !ok {
+		return false
+	}
+	if s.occupants[rid] {
+		return true
+	}
+	if len(s.occupants) >= s.Slots {
+		return false
+	}
+	s.occupants[rid] = true
+	return true
+}
+
+// Release frees the slot the robot holds on the node
+func (c *ChargingNetwork) Release(n graph.Node, rid common.RobotID) {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if s, ok := c.stations[n.ID()]; ok {
+		delete(s.occupants, rid)
+	}
+}
+
+// Occupied returns the number of slots taken on the node
+func (c *ChargingNetwork) Occupied(n graph.Node) int {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if s, ok := c.stations[n.ID()]; ok {
+		return len(s.occupants)
+	}
+	return 0
+}
+
+// Holds checks whether the robot takes a slot of the station on the node
+func (c *ChargingNetwork) Holds(n graph.Node, rid common.RobotID) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+	if s, ok := c.stations[n.ID()]; ok {
+		return s.occupants[rid]
+	}
+	return false
+}
+
+// Occupants returns the robots taking a slot of every occupied station, ordered by ID
+func (c *ChargingNetwork) Occupants() map[int64][]common.RobotID {
+	c.m.Lock()
+	defer c.m.Unlock()
+	occupants := make(map[int64][]common.RobotID)
+	for id, s := range c.stations {
+		for r := range s.occupants {
+			occupants[id] = append(occupants[id], r)
+		}
+		sort.Slice(occupants[id], func(i, j int) bool { return occupants[id][i].String() < occupants[id][j].String() })
+	}
+	return occupants
+}
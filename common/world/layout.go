@@ -0,0 +1,66 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package world
+
+import (
+	"math"
+	"maze/common"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// Point is the position of a node on the floor, X grows eastwards and Y southwards
+type Point struct {
+	X int
+	Y int
+}
+
+// Layout places the nodes of a world on the floor, so robots know which way they face
+type Layout map[int64]Point
+
+// WarehouseLayout is the layout of the 12 node worlds, three columns of four nodes
+//
+//	1	- 	5	-	9
+//	|	X	|		|
+//	2	-	6		10
+//	|		|		|
+//	3		7		11
+//	|		|		|
+//	4	- 	8 	-	12
+func WarehouseLayout() Layout {
+	l := make(Layout)
+	for i := int64(0); i < 12; i++ {
+		l[i+1] = Point{int(i / 4), int(i % 4)}
+	}
+	return l
+}
+
+// Heading returns the direction from one node to the other, false when either node is not on the layout or both are at the same place
+func (l Layout) Heading(from, to graph.Node) (common.Heading, bool) {
+	a, ok := l[from.ID()]
+	if !ok {
+		return common.NoHeading, false
+	}
+	b, ok := l[to.ID()]
+	if !ok || a == b {
+		return common.NoHeading, false
+	}
+	// angle clockwise from north, Y grows southwards
+	angle := math.Atan2(float64(b.X-a.X), float64(a.Y-b.Y))
+	step := int(math.Round(angle/(math.Pi/4)+8)) % 8
+	return common.North + common.Heading(step), true
+}
@@ -0,0 +1,447 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package world
+
+import (
+	"maze/common"
+	"maze/common/action"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// ChangeKind enumerates the changes of the world published to the robots
+type ChangeKind int
+
+const (
+	// RobotMoved carries the last known state of a robot
+	RobotMoved ChangeKind = iota
+	// TaskAdded announces a task available for claim
+	TaskAdded
+	// TaskRemoved announces a task no longer available, claimed or completed
+	TaskRemoved
+	NodeBlocked
+	NodeUnblocked
+	// Synced closes a publication, the robots are up to date with the world as of its tick
+	Synced
+	// ClockTick moves the clock of the robots forward, delivering the changes due
+	ClockTick
+)
+
+// ChangeEvent is a change of the world at a tick
+type ChangeEvent struct {
+	Kind  ChangeKind
+	Tick  int
+	Robot *RemoteRobot
+	Task  common.Task
+	Node  graph.Node
+}
+
+// RemoteRobot is the last known state of a robot, as seen in a local world model
+type RemoteRobot struct {
+	id       common.RobotID
+	typ      common.RobotType
+	location graph.Node
+	act      common.Action
+	task     common.Task
+}
+
+// snapshotRobot copies the state of a robot. The action chain is copied too, the robot goes on changing its own
+func snapshotRobot(r common.Robot) *RemoteRobot {
+	act, t := r.GetStatus()
+	return &RemoteRobot{r.ID(), r.Type(), r.Location(), copyPlan(act), t}
+}
+
+// copyPlan copies an action chain through its serializable form. A chain which can't be copied is left out, the robot is only known by its location
+func copyPlan(a common.Action) common.Action {
+	if a == nil {
+		return action.Null()
+	}
+	p, err := action.EncodePlan(a)
+	if err != nil {
+		return action.Null()
+	}
+	act, err := action.DecodePlan(p)
+	if err != nil {
+		return action.Null()
+	}
+	return act
+}
+
+func (r *RemoteRobot) ID() common.RobotID {
+	return r.id
+}
+func (r *RemoteRobot) Type() common.RobotType {
+	return r.typ
+}
+func (r *RemoteRobot) Capabilities() []common.Capability {
+	if r.typ == nil {
+		return nil
+	}
+	return r.typ.GetCapabilities()
+}
+func (r *RemoteRobot) Init() bool {
+	return true
+}
+
+// Run does nothing, a remote robot only mirrors the state of the robot
+func (r *RemoteRobot) Run() common.Trace {
+	return nil
+}
+func (r *RemoteRobot) Location() graph.Node {
+	return r.location
+}
+func (r *RemoteRobot) Plan() {
+}
+func (r *RemoteRobot) Execute() common.Trace {
+	return nil
+}
+func (r *RemoteRobot) GetStatus() (common.Action, common.Task) {
+	return r.act, r.task
+}
+
+// SyncDriver publishes the changes of a world to the local world models of the robots. It compares the world with the last
+// publication every Interval ticks, and moves the clock of the local worlds forward on every tick
+type SyncDriver struct {
+	Source    common.World
+	Interval  int
+	robots    map[common.RobotID]int64
+	tasks     map[common.TaskID]common.Task
+	blocked   map[int64]graph.Node
+	observers []common.Observer
+	m         sync.Mutex
+}
+
+func CreateSyncDriver(source common.World, interval int) *SyncDriver {
+	if interval < 1 {
+		interval = 1
+	}
+	return &SyncDriver{
+		Source:   source,
+		Interval: interval,
+		robots:   make(map[common.RobotID]int64),
+		tasks:    make(map[common.TaskID]common.Task),
+		blocked:  make(map[int64]graph.Node),
+	}
+}
+
+func (d *SyncDriver) Register(o common.Observer) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.observers = append(d.observers, o)
+}
+
+func (d *SyncDriver) Deregister(o common.Observer) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	for i, other := range d.observers {
+		if other == o {
+			d.observers = append(d.observers[:i], d.observers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Notify hands the event to every local world
+func (d *SyncDriver) Notify(e common.Event) {
+	d.m.Lock()
+	observers := append([]common.Observer{}, d.observers...)
+	d.m.Unlock()
+	for _, o := range observers {
+		o.Notify(e)
+	}
+}
+
+// Publish notifies the changes of the world since the last publication when one is due at the tick, then the tick itself.
+// It returns the changes published
+func (d *SyncDriver) Publish(tick int) []ChangeEvent {
+	var changes []ChangeEvent
+	if tick%d.Interval == 0 {
+		changes = d.diff(tick)
+		for _, c := range changes {
+			d.Notify(c)
+		}
+		d.Notify(ChangeEvent{Kind: Synced, Tick: tick})
+	}
+	d.Notify(ChangeEvent{Kind: ClockTick, Tick: tick})
+	return changes
+}
+
+// diff compares the world with the last publication, changes come in a stable order
+func (d *SyncDriver) diff(tick int) []ChangeEvent {
+	var changes []ChangeEvent
+	// sort a copy, the source world keeps its robots in the order they were added
+	robots := append([]common.Robot{}, d.Source.GetRobots()...)
+	sort.Slice(robots, func(i, j int) bool { return robots[i].ID().String() < robots[j].ID().String() })
+	for _, r := range robots {
+		if last, ok := d.robots[r.ID()]; !ok || last != r.Location().ID() {
+			d.robots[r.ID()] = r.Location().ID()
+			changes = append(changes, ChangeEvent{Kind: RobotMoved, Tick: tick, Robot: snapshotRobot(r)})
+		}
+	}
+
+	available := make(map[common.TaskID]common.Task)
+	for _, t := range d.Source.GetAllTasks() {
+		available[t.GetTaskID()] = t
+	}
+	for _, id := range sortedTaskIDs(available) {
+		if _, ok := d.tasks[id]; !ok {
+			changes = append(changes, ChangeEvent{Kind: TaskAdded, Tick: tick, Task: available[id]})
+		}
+	}
+	for _, id := range sortedTaskIDs(d.tasks) {
+		if _, ok := available[id]; !ok {
+			changes = append(changes, ChangeEvent{Kind: TaskRemoved, Tick: tick, Task: d.tasks[id]})
+		}
+	}
+	d.tasks = available
+
+	if ow, ok := d.Source.(common.ObstructedWorld); ok {
+		blocked := make(map[int64]graph.Node)
+		for _, n := range ow.Blocked() {
+			blocked[n.ID()] = n
+			if _, ok := d.blocked[n.ID()]; !ok {
+				changes = append(changes, ChangeEvent{Kind: NodeBlocked, Tick: tick, Node: n})
+			}
+		}
+		var lifted []graph.Node
+		for id, n := range d.blocked {
+			if _, ok := blocked[id]; !ok {
+				lifted = append(lifted, n)
+			}
+		}
+		sort.Slice(lifted, func(i, j int) bool { return lifted[i].ID() < lifted[j].ID() })
+		for _, n := range lifted {
+			changes = append(changes, ChangeEvent{Kind: NodeUnblocked, Tick: tick, Node: n})
+		}
+		d.blocked = blocked
+	}
+	return changes
+}
+
+func sortedTaskIDs(tasks map[common.TaskID]common.Task) []common.TaskID {
+	var ids []common.TaskID
+	for id := range tasks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	return ids
+}
+
+// LocalWorld is the copy of the world a robot plans on. It learns about changes from a sync driver, Delay ticks after they happen,
+// while claims, task updates and blockages go straight to the source world
+type LocalWorld struct {
+	source  common.World
+	Delay   int
+	pending []ChangeEvent
+	tasks   []common.Task
+	robots  map[common.RobotID]*RemoteRobot
+	blocked *Blockages
+	clock   int
+	synced  int
+	// conflicts counts the claims refused by the source world, because the local view was out of date
+	conflicts int
+	m         sync.Mutex
+}
+
+func CreateLocalWorld(source common.World, delay int) *LocalWorld {
+	return &LocalWorld{
+		source:  source,
+		Delay:   delay,
+		robots:  make(map[common.RobotID]*RemoteRobot),
+		blocked: CreateBlockages(),
+		synced:  -1,
+	}
+}
+
+// Notify queues the change events of the sync driver, and applies the ones due when the clock ticks
+func (l *LocalWorld) Notify(data interface{}) {
+	e, ok := data.(ChangeEvent)
+	if !ok {
+		return
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	if e.Kind != ClockTick {
+		l.pending = append(l.pending, e)
+		return
+	}
+	l.clock = e.Tick
+	i := 0
+	for ; i < len(l.pending) && l.pending[i].Tick+l.Delay <= l.clock; i++ {
+		l.apply(l.pending[i])
+	}
+	l.pending = l.pending[i:]
+}
+
+func (l *LocalWorld) GetChannel() chan interface{} {
+	return nil
+}
+
+func (l *LocalWorld) apply(e ChangeEvent) {
+	switch e.Kind {
+	case RobotMoved:
+		l.robots[e.Robot.ID()] = e.Robot
+	case TaskAdded:
+		l.tasks = append(l.tasks, e.Task)
+	case TaskRemoved:
+		l.remove(e.Task.GetTaskID())
+	case NodeBlocked:
+		l.blocked.Block(e.Node, common.RobotID{})
+	case NodeUnblocked:
+		l.blocked.Unblock(e.Node, common.RobotID{})
+	case Synced:
+		l.synced = e.Tick
+	}
+}
+
+func (l *LocalWorld) remove(id common.TaskID) {
+	for i, t := range l.tasks {
+		if t.GetTaskID() == id {
+			l.tasks = append(l.tasks[:i], l.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Staleness returns the age in ticks of the view of the world, -1 before the first sync
+func (l *LocalWorld) Staleness() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if l.synced < 0 {
+		return -1
+	}
+	return l.clock - l.synced
+}
+
+// Conflicts returns the number of claims refused because the local view was out of date
+func (l *LocalWorld) Conflicts() int {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return l.conflicts
+}
+
+func (l *LocalWorld) GetBroadcastInfo() interface{} {
+	return struct{}{}
+}
+
+// GetAllTasks returns the tasks known to be available
+func (l *LocalWorld) GetAllTasks() []common.Task {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return append([]common.Task{}, l.tasks...)
+}
+
+func (l *LocalWorld) GetNextTask() common.Task {
+	l.m.Lock()
+	defer l.m.Unlock()
+	if len(l.tasks) == 0 {
+		return nil
+	}
+	return l.tasks[0]
+}
+
+func (l *LocalWorld) GetTasks(n int) []common.Task {
+	tasks := l.GetAllTasks()
+	if n < len(tasks) {
+		return tasks[:n]
+	}
+	return tasks
+}
+
+func (l *LocalWorld) HasTasks() bool {
+	l.m.Lock()
+	defer l.m.Unlock()
+	return len(l.tasks) > 0
+}
+
+// TaskUpdate goes to the source world
+func (l *LocalWorld) TaskUpdate(taskID common.TaskID, status common.TaskStatus) error {
+	return l.source.TaskUpdate(taskID, status)
+}
+
+// AddTask goes to the source world, the task shows up locally with the next sync
+func (l *LocalWorld) AddTask(t common.Task) bool {
+	return l.source.AddTask(t)
+}
+
+func (l *LocalWorld) AddTasks(tasks []common.Task) bool {
+	return l.source.AddTasks(tasks)
+}
+
+// ClaimTask claims the task on the source world, which fails when the local view is out of date
+func (l *LocalWorld) ClaimTask(tid common.TaskID, rid common.RobotID) (bool, error) {
+	success, err := l.source.ClaimTask(tid, rid)
+	l.m.Lock()
+	defer l.m.Unlock()
+	// the task is gone either way
+	l.remove(tid)
+	if !success {
+		l.conflicts++
+	}
+	return success, err
+}
+
+// GetGraph returns the graph of the source world, the layout doesn't change
+func (l *LocalWorld) GetGraph() graph.Graph {
+	return l.source.GetGraph()
+}
+
+// GetRobots returns the last known state of the robots, ordered by ID
+func (l *LocalWorld) GetRobots() []common.Robot {
+	l.m.Lock()
+	defer l.m.Unlock()
+	var robots []common.Robot
+	for _, r := range l.robots {
+		robots = append(robots, r)
+	}
+	sort.Slice(robots, func(i, j int) bool { return robots[i].ID().String() < robots[j].ID().String() })
+	return robots
+}
+
+func (l *LocalWorld) AddRobot(r common.Robot) bool {
+	return l.source.AddRobot(r)
+}
+
+func (l *LocalWorld) UpdateRobot(r common.Robot) bool {
+	return l.source.UpdateRobot(r)
+}
+
+// Block goes to the source world, and is applied locally right away
+func (l *LocalWorld) Block(n graph.Node, by common.RobotID) {
+	if ow, ok := l.source.(common.ObstructedWorld); ok {
+		ow.Block(n, by)
+	}
+	l.blocked.Block(n, by)
+}
+
+// Unblock goes to the source world, and is applied locally right away
+func (l *LocalWorld) Unblock(n graph.Node, by common.RobotID) {
+	if ow, ok := l.source.(common.ObstructedWorld); ok {
+		ow.Unblock(n, by)
+	}
+	l.blocked.Unblock(n, by)
+}
+
+func (l *LocalWorld) IsBlocked(n graph.Node) bool {
+	return l.blocked.IsBlocked(n)
+}
+
+func (l *LocalWorld) Blocked() []graph.Node {
+	return l.blocked.Blocked()
+}
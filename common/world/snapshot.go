@@ -0,0 +1,295 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package world
+
+import (
+	"fmt"
+	"maze/common"
+	"maze/common/action"
+	"maze/common/task"
+	"sort"
+
+	"gonum.org/v1/gonum/graph"
+)
+
+// RemoteRobotState is the serializable form of the last known state of a robot. The type is the one of the robot in the source world
+type RemoteRobotState struct {
+	ID       common.RobotID    `json:"id"`
+	Location int64             `json:"location"`
+	Plan     action.PlanRecord `json:"plan"`
+	Task     *task.TaskRecord  `json:"task,omitempty"`
+}
+
+// ChangeState is the serializable form of a change event, nodes are kept as their IDs
+type ChangeState struct {
+	Kind  ChangeKind        `json:"kind"`
+	Tick  int               `json:"tick"`
+	Robot *RemoteRobotState `json:"robot,omitempty"`
+	Task  *task.TaskRecord  `json:"task,omitempty"`
+	Node  *int64            `json:"node,omitempty"`
+}
+
+// SyncDriverState is the serializable state of a sync driver, the world as of its last publication
+type SyncDriverState struct {
+	Robots  map[common.RobotID]int64 `json:"robots,omitempty"`
+	Tasks   []task.TaskRecord        `json:"tasks,omitempty"`
+	Blocked []int64                  `json:"blocked,omitempty"`
+}
+
+// LocalWorldState is the serializable state of a local world: the changes on their way, and the view of the world they arrived at
+type LocalWorldState struct {
+	Pending   []ChangeState              `json:"pending,omitempty"`
+	Tasks     []task.TaskRecord          `json:"tasks,omitempty"`
+	Robots    []RemoteRobotState         `json:"robots,omitempty"`
+	Blocked   map[int64][]common.RobotID `json:"blocked,omitempty"`
+	Clock     int                        `json:"clock"`
+	Synced    int                        `json:"synced"`
+	Conflicts int                        `json:"conflicts,omitempty"`
+}
+
+// TaskLookup finds a task by its ID, so a restored state shares its tasks with the task manager
+type TaskLookup func(common.TaskID) (common.Task, bool)
+
+// Snapshot saves the world as of the last publication
+func (d *SyncDriver) Snapshot() (SyncDriverState, error) {
+	d.m.Lock()
+	defer d.m.Unlock()
+	s := SyncDriverState{Robots: make(map[common.RobotID]int64)}
+	for id, n := range d.robots {
+		s.Robots[id] = n
+	}
+	for _, id := range sortedTaskIDs(d.tasks) {
+		r, err := task.EncodeTask(d.tasks[id])
+		if err != nil {
+			return SyncDriverState{}, err
+		}
+		s.Tasks = append(s.Tasks, r)
+	}
+	for id := range d.blocked {
+		s.Blocked = append(s.Blocked, id)
+	}
+	sort.Slice(s.Blocked, func(i, j int) bool { return s.Blocked[i] < s.Blocked[j] })
+	return s, nil
+}
+
+// Restore puts the driver back in a saved state, the local worlds registered stay
+func (d *SyncDriver) Restore(s SyncDriverState, lookup TaskLookup) error {
+	g := d.Source.GetGraph()
+	robots := make(map[common.RobotID]int64)
+	for id, n := range s.Robots {
+		robots[id] = n
+	}
+	tasks := make(map[common.TaskID]common.Task)
+	for i := range s.Tasks {
+		t, err := restoreTask(&s.Tasks[i], lookup)
+		if err != nil {
+			return err
+		}
+		tasks[t.GetTaskID()] = t
+	}
+	blocked := make(map[int64]graph.Node)
+	for _, id := range s.Blocked {
+		n, err := nodeOf(g, id)
+		if err != nil {
+			return err
+		}
+		blocked[id] = n
+	}
+	d.m.Lock()
+	defer d.m.Unlock()
+	d.robots, d.tasks, d.blocked = robots, tasks, blocked
+	return nil
+}
+
+// Snapshot saves the view of the world and the changes on their way to it
+func (l *LocalWorld) Snapshot() (LocalWorldState, error) {
+	l.m.Lock()
+	defer l.m.Unlock()
+	s := LocalWorldState{Clock: l.clock, Synced: l.synced, Conflicts: l.conflicts}
+	for _, e := range l.pending {
+		c, err := snapshotChange(e)
+		if err != nil {
+			return LocalWorldState{}, err
+		}
+		s.Pending = append(s.Pending, c)
+	}
+	for _, t := range l.tasks {
+		r, err := task.EncodeTask(t)
+		if err != nil {
+			return LocalWorldState{}, err
+		}
+		s.Tasks = append(s.Tasks, r)
+	}
+	var ids []common.RobotID
+	for id := range l.robots {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+	for _, id := range ids {
+		r, err := l.robots[id].snapshot()
+		if err != nil {
+			return LocalWorldState{}, err
+		}
+		s.Robots = append(s.Robots, r)
+	}
+	if blocked := l.blocked.Blockers(); len(blocked) > 0 {
+		s.Blocked = blocked
+	}
+	return s, nil
+}
+
+// Restore puts the local world back in a saved state
+func (l *LocalWorld) Restore(s LocalWorldState, lookup TaskLookup) error {
+	g := l.source.GetGraph()
+	types := make(map[common.RobotID]common.RobotType)
+	for _, r := range l.source.GetRobots() {
+		types[r.ID()] = r.Type()
+	}
+	var pending []ChangeEvent
+	for _, c := range s.Pending {
+		e, err := restoreChange(c, g, types, lookup)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, e)
+	}
+	var tasks []common.Task
+	for i := range s.Tasks {
+		t, err := restoreTask(&s.Tasks[i], lookup)
+		if err != nil {
+			return err
+		}
+		tasks = append(tasks, t)
+	}
+	robots := make(map[common.RobotID]*RemoteRobot)
+	for _, rs := range s.Robots {
+		r, err := restoreRobot(rs, g, types, lookup)
+		if err != nil {
+			return err
+		}
+		robots[r.id] = r
+	}
+	blocked := CreateBlockages()
+	for id, blockers := range s.Blocked {
+		n, err := nodeOf(g, id)
+		if err != nil {
+			return err
+		}
+		for _, by := range blockers {
+			blocked.Block(n, by)
+		}
+	}
+	l.m.Lock()
+	defer l.m.Unlock()
+	l.pending, l.tasks, l.robots, l.blocked = pending, tasks, robots, blocked
+	l.clock, l.synced, l.conflicts = s.Clock, s.Synced, s.Conflicts
+	return nil
+}
+
+func (r *RemoteRobot) snapshot() (RemoteRobotState, error) {
+	plan, err := action.EncodePlan(r.act)
+	if err != nil {
+		return RemoteRobotState{}, err
+	}
+	s := RemoteRobotState{ID: r.id, Location: r.location.ID(), Plan: plan}
+	if r.task != nil {
+		t, err := task.EncodeTask(r.task)
+		if err != nil {
+			return RemoteRobotState{}, err
+		}
+		s.Task = &t
+	}
+	return s, nil
+}
+
+func restoreRobot(s RemoteRobotState, g graph.Graph, types map[common.RobotID]common.RobotType, lookup TaskLookup) (*RemoteRobot, error) {
+	location, err := nodeOf(g, s.Location)
+	if err != nil {
+		return nil, err
+	}
+	act, err := action.DecodePlan(s.Plan)
+	if err != nil {
+		return nil, err
+	}
+	var t common.Task
+	if s.Task != nil {
+		if t, err = restoreTask(s.Task, lookup); err != nil {
+			return nil, err
+		}
+	}
+	return &RemoteRobot{s.ID, types[s.ID], location, act, t}, nil
+}
+
+func snapshotChange(e ChangeEvent) (ChangeState, error) {
+	c := ChangeState{Kind: e.Kind, Tick: e.Tick}
+	if e.Robot != nil {
+		r, err := e.Robot.snapshot()
+		if err != nil {
+			return ChangeState{}, err
+		}
+		c.Robot = &r
+	}
+	if e.Task != nil {
+		t, err := task.EncodeTask(e.Task)
+		if err != nil {
+			return ChangeState{}, err
+		}
+		c.Task = &t
+	}
+	if e.Node != nil {
+		id := e.Node.ID()
+		c.Node = &id
+	}
+	return c, nil
+}
+
+func restoreChange(c ChangeState, g graph.Graph, types map[common.RobotID]common.RobotType, lookup TaskLookup) (ChangeEvent, error) {
+	e := ChangeEvent{Kind: c.Kind, Tick: c.Tick}
+	var err error
+	if c.Robot != nil {
+		if e.Robot, err = restoreRobot(*c.Robot, g, types, lookup); err != nil {
+			return ChangeEvent{}, err
+		}
+	}
+	if c.Task != nil {
+		if e.Task, err = restoreTask(c.Task, lookup); err != nil {
+			return ChangeEvent{}, err
+		}
+	}
+	if c.Node != nil {
+		if e.Node, err = nodeOf(g, *c.Node); err != nil {
+			return ChangeEvent{}, err
+		}
+	}
+	return e, nil
+}
+
+// restoreTask finds the task through the lookup, and decodes it from its record when the lookup doesn't know it
+func restoreTask(r *task.TaskRecord, lookup TaskLookup) (common.Task, error) {
+	if t, ok := lookup(r.ID); ok {
+		return t, nil
+	}
+	return task.DecodeTask(*r)
+}
+
+func nodeOf(g graph.Graph, id int64) (graph.Node, error) {
+	n := g.Node(id)
+	if n == nil {
+		return nil, fmt.Errorf("unknown node %d", id)
+	}
+	return n, nil
+}
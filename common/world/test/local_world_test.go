@@ -0,0 +1,117 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package test
+
+import (
+	"maze/common"
+	"maze/common/action"
+	"maze/common/robot"
+	"maze/common/task"
+	"maze/common/world"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLocalWorldSeesChangesAfterDelay(t *testing.T) {
+	source := world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManager())
+	driver := world.CreateSyncDriver(source, 1)
+	local := world.CreateLocalWorld(source, 2)
+	driver.Register(local)
+	source.AddRobot(robot.NewSimpleWarehouseRobot(uuid.New(), source.GetGraph().Node(3), source))
+	source.AddTask(task.NewTimePriorityTaskWithParameter(source.GetGraph().Node(1), source.GetGraph().Node(2)))
+
+	if changes := driver.Publish(0); len(changes) != 2 {
+		t.Errorf("Expect a robot and a task change, got %+v", changes)
+	}
+	driver.Publish(1)
+	if local.HasTasks() || len(local.GetRobots()) != 0 || local.Staleness() != -1 {
+		t.Errorf("Expect the changes to be delayed by 2 ticks")
+	}
+	driver.Publish(2)
+	if !local.HasTasks() || len(local.GetRobots()) != 1 || local.GetRobots()[0].Location().ID() != 3 {
+		t.Errorf("Expect the changes to arrive after 2 ticks")
+	}
+	if local.Staleness() != 2 {
+		t.Errorf("Expect the view to be 2 ticks old, actual %d", local.Staleness())
+	}
+}
+
+func TestStaleLocalWorldClaimConflicts(t *testing.T) {
+	source := world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManager())
+	driver := world.CreateSyncDriver(source, 5)
+	first, second := world.CreateLocalWorld(source, 0), world.CreateLocalWorld(source, 0)
+	driver.Register(first)
+	driver.Register(second)
+	tk := task.NewTimePriorityTaskWithParameter(source.GetGraph().Node(1), source.GetGraph().Node(2))
+	source.AddTask(tk)
+	driver.Publish(0)
+
+	if ok, _ := first.ClaimTask(tk.GetTaskID(), uuid.New()); !ok || first.HasTasks() {
+		t.Errorf("Expect the first claim to succeed and the task to leave the local view")
+	}
+	if !second.HasTasks() {
+		t.Errorf("Expect the second view to still show the task until the next sync")
+	}
+	if ok, _ := second.ClaimTask(tk.GetTaskID(), uuid.New()); ok || second.Conflicts() != 1 {
+		t.Errorf("Expect the stale claim to be refused as a conflict")
+	}
+}
+
+func TestLocalWorldForwardsBlockages(t *testing.T) {
+	source := world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManager())
+	driver := world.CreateSyncDriver(source, 1)
+	local, other := world.CreateLocalWorld(source, 0), world.CreateLocalWorld(source, 1)
+	driver.Register(local)
+	driver.Register(other)
+	var ow common.ObstructedWorld = local
+	ow.Block(source.GetGraph().Node(4), uuid.New())
+	if !source.IsBlocked(source.GetGraph().Node(4)) || !local.IsBlocked(source.GetGraph().Node(4)) {
+		t.Errorf("Expect the blockage to reach the source world right away")
+	}
+	driver.Publish(0)
+	if other.IsBlocked(source.GetGraph().Node(4)) {
+		t.Errorf("Expect other robots to learn about the blockage after the delay")
+	}
+	driver.Publish(1)
+	if !other.IsBlocked(source.GetGraph().Node(4)) {
+		t.Errorf("Expect other robots to learn about the blockage")
+	}
+}
+
+func TestLocalWorldKeepsPublishedPlan(t *testing.T) {
+	source := world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManager())
+	driver := world.CreateSyncDriver(source, 1)
+	local := world.CreateLocalWorld(source, 0)
+	driver.Register(local)
+	r := robot.NewSimpleWarehouseRobot(uuid.New(), source.GetGraph().Node(1), source)
+	source.AddRobot(r)
+	source.AddTask(task.NewTimePriorityTaskWithParameter(source.GetGraph().Node(2), source.GetGraph().Node(4)))
+	r.Run()
+	driver.Publish(0)
+	act, _ := local.GetRobots()[0].GetStatus()
+	published := action.Format(act)
+
+	// the robot carries on with its plan, the local world keeps the plan as it was published
+	r.Run()
+	r.Run()
+	if act, _ := local.GetRobots()[0].GetStatus(); action.Format(act) != published {
+		t.Errorf("Expect the published plan %s to stay, actual %s", published, action.Format(act))
+	}
+	if live, _ := r.GetStatus(); live == act {
+		t.Errorf("Expect the local world to hold a copy of the plan")
+	}
+}
@@ -27,6 +27,9 @@ type WarehouseWorld struct {
 	graph  *simple.UndirectedGraph
 	robots map[common.RobotID]common.Robot
 	tm     common.TaskManager
+	*Blockages
+	// order keeps the robots in the order they were added
+	order []common.RobotID
 }
 
 //	1	- 	5	-	9
@@ -42,6 +45,8 @@ func CreateWarehouseWorld() *WarehouseWorld {
 		simple.NewUndirectedGraph(),
 		make(map[common.RobotID]common.Robot),
 		task.CreateSimulatedTaskManager(),
+		CreateBlockages(),
+		nil,
 	}
 
 	for i := 1; i < 13; i++ {
@@ -72,6 +77,8 @@ func CreateWarehouseWorldWithTaskManager(stm common.TaskManager) *WarehouseWorld
 		simple.NewUndirectedGraph(),
 		make(map[common.RobotID]common.Robot),
 		stm,
+		CreateBlockages(),
+		nil,
 	}
 
 	for i := 1; i < 13; i++ {
@@ -128,7 +135,11 @@ func (w *WarehouseWorld) HasTasks() bool {
 }
 
 func (w *WarehouseWorld) ClaimTask(tid common.TaskID, rid common.RobotID) (success bool, err error) {
-	err = w.tm.TaskUpdate(tid, common.Assigned)
+	if ptm, ok := w.tm.(common.PassiveTaskManager); ok {
+		err = ptm.ClaimTask(tid, rid)
+	} else {
+		err = w.tm.TaskUpdate(tid, common.Assigned)
+	}
 	if err != nil {
 		return false, err
 	} else {
@@ -143,8 +154,8 @@ func (w *WarehouseWorld) GetGraph() graph.Graph {
 
 func (w *WarehouseWorld) GetRobots() []common.Robot {
 	var values []common.Robot
-	for _, value := range w.robots {
-		values = append(values, value)
+	for _, id := range w.order {
+		values = append(values, w.robots[id])
 	}
 
 	return values
@@ -160,6 +171,7 @@ func (w *WarehouseWorld) AddRobot(r common.Robot) bool {
 		return false
 	}
 	w.robots[r.ID()] = r
+	w.order = append(w.order, r.ID())
 	return true
 }
 func (w *WarehouseWorld) UpdateRobot(r common.Robot) bool {
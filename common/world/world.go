@@ -32,7 +32,7 @@ import (
 
 //CreateWorld generates a network of 12 nodes
 func CreateWorld(tm common.TaskManager) common.World {
-	w := simpleWorld{}
+	w := simpleWorld{Blockages: CreateBlockages()}
 	var g = simple.NewWeightedUndirectedGraph(1, 10000000)
 	for i := 1; i < 13; i++ {
 		g.AddNode(simple.Node(i))
@@ -58,11 +58,29 @@ func CreateWorld(tm common.TaskManager) common.World {
 	return &w
 }
 
+// CreateWorldWithEdges generates a network from its edges, all of unit weight. The nodes are the ends of the edges
+func CreateWorldWithEdges(tm common.TaskManager, edges [][2]int64) common.World {
+	w := simpleWorld{Blockages: CreateBlockages()}
+	var g = simple.NewWeightedUndirectedGraph(1, 10000000)
+	for _, e := range edges {
+		for _, id := range e {
+			if g.Node(id) == nil {
+				g.AddNode(simple.Node(id))
+			}
+		}
+		g.SetWeightedEdge(g.NewWeightedEdge(simple.Node(e[0]), simple.Node(e[1]), 1))
+	}
+	w.grid = g
+	w.tm = tm
+	return &w
+}
+
 // simpleWorld is the base implementation of a fully visible world, backed with Gonum Simple Graph
 type simpleWorld struct {
 	robots []common.Robot
 	tm     common.TaskManager
 	grid   *simple.WeightedUndirectedGraph
+	*Blockages
 }
 
 func (s *simpleWorld) TaskUpdate(taskID common.TaskID, status common.TaskStatus) error {
@@ -92,7 +110,11 @@ func (s *simpleWorld) GetGraph() graph.Graph {
 
 // ClaimTask defines the mechanism that a Robot can claim a given task from the world
 func (s *simpleWorld) ClaimTask(tid common.TaskID, rid common.RobotID) (success bool, err error) {
-	err = s.tm.TaskUpdate(tid, common.Assigned)
+	if ptm, ok := s.tm.(common.PassiveTaskManager); ok {
+		err = ptm.ClaimTask(tid, rid)
+	} else {
+		err = s.tm.TaskUpdate(tid, common.Assigned)
+	}
 	if err != nil {
 		return false, err
 	} else {
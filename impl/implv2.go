@@ -18,13 +18,14 @@ package impl
 
 import (
 	"github.com/AsynkronIT/protoactor-go/actor"
-	"github.com/google/uuid"
 	"log"
 	"maze/common"
 	"maze/common/methods"
 	"maze/common/robot"
+	"maze/common/simulation"
 	"maze/common/task"
 	"maze/common/world"
+	"time"
 )
 
 type ShutdownMessageV1 struct {
@@ -33,6 +34,8 @@ type RobotActorV1 struct {
 	robot   common.Robot
 	stopSig bool
 	stopped bool
+	// finish is checked after every run of the robot
+	finish *simulation.Finish
 }
 
 func (state *RobotActorV1) Receive(ctx actor.Context) {
@@ -60,12 +63,13 @@ func (state *RobotActorV1) Run(ctx actor.Context) {
 			break
 		} else {
 			log.Printf("%+v", state.robot.Run())
+			state.finish.Check()
 		}
 	}
 }
 
 func NewSystemActorV2(done chan bool) *SystemActorV2 {
-	return &SystemActorV2{done, nil, nil, Uninitialized}
+	return &SystemActorV2{done, nil, nil, Uninitialized, 0, nil, nil, nil, nil}
 }
 
 type SystemState int
@@ -82,6 +86,14 @@ type SystemActorV2 struct {
 	robots []*actor.PID
 	w      common.World
 	state  SystemState
+	// Seed drives the tasks and robot IDs of the system
+	Seed   int64
+	source *simulation.Source
+	// StopWhen holds once the system may shut down after an end message. Robots run freely, so the tick is not counted,
+	// and the wall time counts from Init. When nil, the system waits for every task to be claimed
+	StopWhen simulation.StopCondition
+	tm       common.TaskManager
+	finish   *simulation.Finish
 }
 
 func (sys *SystemActorV2) Receive(context actor.Context) {
@@ -100,10 +112,18 @@ func (sys *SystemActorV2) Receive(context actor.Context) {
 }
 func (sys *SystemActorV2) Init(ctx actor.Context) {
 	stm := task.CreateSimulatedTaskManagerSync()
+	sys.tm = stm
 	sys.w = world.CreateWarehouseWorldWithTaskManager(stm)
+	stop := sys.StopWhen
+	if stop == nil {
+		stop = simulation.NoTasksWaiting()
+	}
+	start := time.Now()
+	sys.finish = simulation.CreateFinish(stop, func() simulation.Progress { return simulation.ProgressOf(sys.tm, 0, start) })
 	props := actor.PropsFromProducer(sys.SpawnRobotActor)
+	sys.source = simulation.CreateSource(sys.Seed)
 
-	sys.w.AddTasks(methods.TaskGenerator(500, sys.w))
+	sys.w.AddTasks(methods.TaskGenerator(sys.source.Stream("tasks"), 500, sys.w))
 	log.Printf("Ingested %d tasks", len(sys.w.GetAllTasks()))
 	for i := 0; i < 50; i++ {
 		sys.robots = append(sys.robots, ctx.Spawn(props))
@@ -115,7 +135,7 @@ func (sys *SystemActorV2) Init(ctx actor.Context) {
 	sys.state = Initialized
 }
 func (sys *SystemActorV2) SpawnRobotActor() actor.Actor {
-	return &RobotActorV1{robot.NewSimpleWarehouseRobot(uuid.New(), sys.w.GetGraph().Node(1), sys.w), false, false}
+	return &RobotActorV1{robot.NewSimpleWarehouseRobot(sys.source.NewID(), sys.w.GetGraph().Node(1), sys.w), false, false, sys.finish}
 }
 func (sys *SystemActorV2) Shutdown(ctx actor.Context) {
 	for _, a := range sys.robots {
@@ -125,15 +145,8 @@ func (sys *SystemActorV2) Shutdown(ctx actor.Context) {
 	sys.state = Stopped
 }
 func (sys *SystemActorV2) Stop(ctx actor.Context) {
-	for {
-		if sys.w.HasTasks() {
-
-		} else {
-			break
-		}
-	}
+	sys.finish.Wait()
 	sys.Shutdown(ctx)
-
 }
 
 func (sys *SystemActorV2) Run(ctx actor.Context) {
@@ -22,14 +22,18 @@ import (
 	"log"
 	"maze/common"
 	"maze/common/robot"
+	"maze/common/simulation"
 	"maze/common/task"
 	"maze/common/world"
+	"time"
 )
 
 type RobotActorV2 struct {
 	robot   common.Robot
 	stopSig bool
 	stopped bool
+	// finish is checked after every run of the robot
+	finish *simulation.Finish
 }
 
 func (state *RobotActorV2) Receive(ctx actor.Context) {
@@ -64,21 +68,33 @@ func (state *RobotActorV2) Run(ctx actor.Context) {
 		} else {
 			//log.Printf("%+v", state.robot.Run())
 			state.robot.Run()
+			state.finish.Check()
 		}
 	}
 }
 
 func NewSystemActorV3() *SystemActorV3 {
-	return &SystemActorV3{actor.PIDSet{}, nil}
+	return &SystemActorV3{actor.PIDSet{}, nil, nil, nil, nil, time.Time{}}
 }
 
 type SystemActorV3 struct {
 	actors actor.PIDSet
 	w      common.World
+	// StopWhen ends the run. Robots run freely, so the tick is not counted. When nil, the run ends once every task is claimed
+	StopWhen simulation.StopCondition
+	tm       common.TaskManager
+	finish   *simulation.Finish
+	start    time.Time
 }
 
 func (sys *SystemActorV3) Init(ctx actor.Context) {
-	sys.w = world.CreateWarehouseWorldWithTaskManager(task.CreateSimulatedTaskManagerSync())
+	sys.tm = task.CreateSimulatedTaskManagerSync()
+	sys.w = world.CreateWarehouseWorldWithTaskManager(sys.tm)
+	stop := sys.StopWhen
+	if stop == nil {
+		stop = simulation.NoTasksWaiting()
+	}
+	sys.finish = simulation.CreateFinish(stop, func() simulation.Progress { return simulation.ProgressOf(sys.tm, 0, sys.start) })
 	props := actor.PropsFromProducer(sys.SpawnRobotActor)
 	for i := 0; i < 5; i++ {
 		sys.actors.Add(ctx.Spawn(props))
@@ -86,7 +102,7 @@ func (sys *SystemActorV3) Init(ctx actor.Context) {
 	log.Println("System Initialized")
 }
 func (sys *SystemActorV3) SpawnRobotActor() actor.Actor {
-	return &RobotActorV2{robot.NewSimpleWarehouseRobot(uuid.New(), sys.w.GetGraph().Node(1), sys.w), false, false}
+	return &RobotActorV2{robot.NewSimpleWarehouseRobot(uuid.New(), sys.w.GetGraph().Node(1), sys.w), false, false, sys.finish}
 }
 
 func (sys *SystemActorV3) Receive(ctx actor.Context) {
@@ -110,20 +126,15 @@ func (sys *SystemActorV3) Receive(ctx actor.Context) {
 }
 func (sys *SystemActorV3) Run(ctx actor.Context) {
 	log.Println("Running")
+	sys.start = time.Now()
 	sys.actors.ForEach(
 		func(i int, pid actor.PID) {
 
 			ctx.Send(&pid, StartMessageV1{})
 		})
-	for {
-		if sys.w.HasTasks() {
-
-		} else {
-			ctx.Respond("Done")
-			sys.Stop(ctx)
-			break
-		}
-	}
+	sys.finish.Wait()
+	ctx.Respond("Done")
+	sys.Stop(ctx)
 }
 func (sys *SystemActorV3) Stop(ctx actor.Context) {
 	sys.actors.ForEach(func(i int, pid actor.PID) {
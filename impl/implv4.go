@@ -0,0 +1,190 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package impl
+
+import (
+	"github.com/AsynkronIT/protoactor-go/actor"
+	"log"
+	"maze/common"
+	"maze/common/auction"
+	"maze/common/methods"
+	"maze/common/robot"
+	"maze/common/simulation"
+	"maze/common/task"
+	"maze/common/world"
+	"sort"
+	"time"
+)
+
+// AnnounceTaskMessage asks a robot actor for its bid on a task
+type AnnounceTaskMessage struct {
+	Task common.Task
+}
+
+// BidMessage is the response of a robot actor to a task announcement
+type BidMessage struct {
+	Robot common.RobotID
+	Cost  float64
+	OK    bool
+}
+
+// AwardMessage hands an auctioned task to the winning robot actor
+type AwardMessage struct {
+	Task common.Task
+}
+
+// StatusRequestMessage asks a robot actor whether it is idle
+type StatusRequestMessage struct {
+}
+
+// TickMessage asks a robot actor to run one step, the response is the trace of the step
+type TickMessage struct {
+}
+
+// BidderActor wraps a bidding robot, which only acts upon messages
+type BidderActor struct {
+	robot common.Bidder
+}
+
+func (state *BidderActor) Receive(ctx actor.Context) {
+	switch msg := ctx.Message().(type) {
+	case InitMessageV1:
+		state.robot.Init()
+	case AnnounceTaskMessage:
+		cost, ok := state.robot.Bid(msg.Task)
+		ctx.Respond(BidMessage{state.robot.ID(), cost, ok})
+	case AwardMessage:
+		ctx.Respond(state.robot.Assign(msg.Task))
+	case StatusRequestMessage:
+		ctx.Respond(auction.Idle(state.robot))
+	case TickMessage:
+		ctx.Respond(state.robot.Run())
+	}
+}
+
+// actorMarket is an auction market where the robots are reached through messages
+type actorMarket struct {
+	ctx     actor.Context
+	pids    map[common.RobotID]*actor.PID
+	order   []common.RobotID
+	timeout time.Duration
+}
+
+func (m *actorMarket) Participants(idleOnly bool) []common.RobotID {
+	var ids []common.RobotID
+	for _, id := range m.order {
+		if idleOnly {
+			idle, err := m.ctx.RequestFuture(m.pids[id], StatusRequestMessage{}, m.timeout).Result()
+			if err != nil || !idle.(bool) {
+				continue
+			}
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (m *actorMarket) RequestBid(rid common.RobotID, t common.Task) (float64, bool) {
+	res, err := m.ctx.RequestFuture(m.pids[rid], AnnounceTaskMessage{t}, m.timeout).Result()
+	if err != nil {
+		log.Printf("Robot %s failed to bid: %+v", rid, err)
+		return 0, false
+	}
+	bid := res.(BidMessage)
+	return bid.Cost, bid.OK
+}
+
+func (m *actorMarket) Award(rid common.RobotID, t common.Task) bool {
+	res, err := m.ctx.RequestFuture(m.pids[rid], AwardMessage{t}, m.timeout).Result()
+	return err == nil && res.(bool)
+}
+
+func NewSystemActorV4(mode auction.Mode) *SystemActorV4 {
+	return &SystemActorV4{auctioneer: auction.CreateAuctioneer(mode), timeout: time.Second}
+}
+
+// SystemActorV4 allocates tasks to robot actors by auction, then steps every robot, until all tasks are done
+type SystemActorV4 struct {
+	market     *actorMarket
+	w          common.World
+	auctioneer *auction.Auctioneer
+	timeout    time.Duration
+	// Seed drives the tasks and robot IDs of the system
+	Seed int64
+	// StopWhen ends the run, checked before every round. When nil, the run ends once all tasks are done
+	StopWhen simulation.StopCondition
+	tm       common.TaskManager
+}
+
+func (sys *SystemActorV4) Init(ctx actor.Context) {
+	sys.tm = task.CreateSimulatedTaskManagerSync()
+	sys.w = world.CreateWarehouseWorldWithTaskManager(sys.tm)
+	source := simulation.CreateSource(sys.Seed)
+	sys.w.AddTasks(methods.TaskGenerator(source.Stream("tasks"), 20, sys.w))
+	sys.market = &actorMarket{ctx, make(map[common.RobotID]*actor.PID), nil, sys.timeout}
+	for i := 0; i < 5; i++ {
+		r := robot.NewSimpleWarehouseRobot(source.NewID(), sys.w.GetGraph().Node(1), sys.w)
+		r.SetSelfClaim(false)
+		sys.w.AddRobot(r)
+		pid := ctx.Spawn(actor.PropsFromProducer(func() actor.Actor { return &BidderActor{r} }))
+		sys.market.pids[r.ID()] = pid
+		sys.market.order = append(sys.market.order, r.ID())
+		ctx.Send(pid, InitMessageV1{})
+	}
+	sort.Slice(sys.market.order, func(i, j int) bool { return sys.market.order[i].String() < sys.market.order[j].String() })
+	log.Println("System Initialized")
+}
+
+func (sys *SystemActorV4) Receive(ctx actor.Context) {
+	switch ctx.Message().(type) {
+	case *actor.Started:
+		sys.Init(ctx)
+	case StartMessageV1:
+		sys.Run(ctx)
+	case *actor.Stopping:
+		sys.Stop(ctx)
+	}
+}
+
+// Run alternates auction rounds and steps of all robots, and responds "Done" once the stop condition holds
+func (sys *SystemActorV4) Run(ctx actor.Context) {
+	stop := sys.StopWhen
+	if stop == nil {
+		stop = simulation.AllTasksDone()
+	}
+	start := time.Now()
+	for tick := 0; !stop.Done(simulation.ProgressOf(sys.tm, tick, start)); tick++ {
+		sys.auctioneer.Hold(sys.w, sys.market)
+		var futures []*actor.Future
+		for _, id := range sys.market.order {
+			futures = append(futures, ctx.RequestFuture(sys.market.pids[id], TickMessage{}, sys.timeout))
+		}
+		for _, f := range futures {
+			if err := f.Wait(); err != nil {
+				ctx.Respond(err)
+				return
+			}
+		}
+	}
+	ctx.Respond("Done")
+}
+
+func (sys *SystemActorV4) Stop(ctx actor.Context) {
+	for _, pid := range sys.market.pids {
+		ctx.Stop(pid)
+	}
+}
@@ -0,0 +1,41 @@
+/*
+ *  Copyright (c) 2019 Zhijie (Bill) Wang
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *   http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package impl_test
+
+import (
+	"github.com/AsynkronIT/protoactor-go/actor"
+	"maze/common/auction"
+	"maze/impl"
+	"testing"
+	"time"
+)
+
+func TestV4AuctionRun(t *testing.T) {
+	for _, mode := range []auction.Mode{auction.SingleItem, auction.Sequential} {
+		ctx := actor.EmptyRootContext
+		props := actor.PropsFromProducer(func() actor.Actor {
+			return impl.NewSystemActorV4(mode)
+		})
+		pid := ctx.Spawn(props)
+
+		msg, err := ctx.RequestFuture(pid, impl.StartMessageV1{}, 10*time.Second).Result()
+		if err != nil || msg != "Done" {
+			t.Errorf("Auction mode %d should carry out all tasks, response %+v, err %+v", mode, msg, err)
+		}
+		ctx.Stop(pid)
+	}
+}